@@ -6,57 +6,126 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"net"
 	"os"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/DusanKasan/parsemail"
-	"github.com/PuerkitoBio/goquery"
+	"github.com/cjdenio/temp-email/pkg/blocklist"
 	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/domains"
+	"github.com/cjdenio/temp-email/pkg/ingest"
 	"github.com/cjdenio/temp-email/pkg/schedule"
+	"github.com/cjdenio/temp-email/pkg/search"
 	"github.com/cjdenio/temp-email/pkg/slackevents"
-	"github.com/cjdenio/temp-email/pkg/util"
+	"github.com/cjdenio/temp-email/pkg/spam"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/webhooks"
 	"github.com/emersion/go-smtp"
-	"github.com/slack-go/slack"
-	"gorm.io/gorm"
 
-	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/joho/godotenv"
 )
 
 type Session struct {
+	Stores   store.Stores
+	RemoteIP net.IP
 	FromAddr string
 	ToAddr   string
+
+	// BounceTo is the original sender of forwarded mail that's bouncing
+	// back to its SRS address
+	BounceTo string
+}
+
+// rejectGlobal is returned when mail matches the global blocklist
+var rejectGlobal = &smtp.SMTPError{
+	Code:         550,
+	EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+	Message:      "Message rejected by policy",
 }
 
 func (s *Session) Reset() {
 	s.FromAddr = ""
 	s.ToAddr = ""
+	s.BounceTo = ""
 }
 func (s *Session) Logout() error { return nil }
 func (s *Session) Mail(from string, opts smtp.MailOptions) error {
+	if blocklist.Check(s.Stores.GlobalRules, blocklist.Message{IP: s.RemoteIP, Sender: from}) != nil {
+		return rejectGlobal
+	}
+
 	s.FromAddr = from
 	return nil
 }
 func (s *Session) Rcpt(to string) error {
+	if original, err := ingest.BounceRecipient(to); err != ingest.ErrNotBounce {
+		if err != nil {
+			log.Printf("REJECT: Invalid SRS address %s: %v", to, err)
+			return &smtp.SMTPError{
+				Code:         550,
+				EnhancedCode: smtp.EnhancedCode{5, 1, 1},
+				Message:      "No such forwarded message",
+			}
+		}
+
+		// Real bounces (DSNs) come from the null sender; anything else sent
+		// to an SRS address would have us relay arbitrary mail
+		if s.FromAddr != "" {
+			log.Printf("REJECT: Non-bounce mail from %s to SRS address %s", s.FromAddr, to)
+			return &smtp.SMTPError{
+				Code:         550,
+				EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+				Message:      "Only bounces are accepted for forwarded mail",
+			}
+		}
+
+		s.BounceTo = original
+		return nil
+	}
+
+	// Turn away senders the address owner has blocked before taking the
+	// message. Allowlists are checked in Data, once the From header is known.
+	address, _, err := ingest.FindAddress(s.Stores, to)
+	if err == nil && s.FromAddr != "" {
+		if blocked, reason := ingest.SenderBlocked(s.Stores.Senders, address.ID, s.FromAddr); blocked {
+			ingest.LogBlocked(s.Stores.Senders, address.ID, s.FromAddr, "", reason)
+			return &smtp.SMTPError{
+				Code:         550,
+				EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+				Message:      "Sender not accepted by this address",
+			}
+		}
+	}
+
 	s.ToAddr = to
 	return nil
 }
 func (s *Session) Data(r io.Reader) error {
-	split := strings.Split(s.ToAddr, "@")
+	if s.BounceTo != "" {
+		// A forwarded message bounced; pass it back to whoever sent it
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err := ingest.RelayBounce(s.BounceTo, raw); err != nil {
+			log.Printf("ERROR: Failed to relay bounce to %s: %v", s.BounceTo, err)
+			return errors.New("couldn't relay bounce")
+		}
 
-	if len(split) < 2 {
-		return errors.New("invalid address")
+		log.Printf("SUCCESS: Relayed bounce to %s", s.BounceTo)
+		return nil
 	}
 
-	var address db.Address
-	tx := db.DB.Where("id = ? AND expires_at > NOW()", split[0]).First(&address)
-	if tx.Error == gorm.ErrRecordNotFound {
-		log.Printf("REJECT: Address not found or expired: %s (from: %s)", split[0], s.FromAddr)
+	address, tag, err := ingest.FindAddress(s.Stores, s.ToAddr)
+	if err == ingest.ErrInvalidRecipient {
+		return err
+	} else if err == store.ErrNotFound {
+		log.Printf("REJECT: Address not found or expired: %s (from: %s)", s.ToAddr, s.FromAddr)
 		return errors.New("address not found")
-	} else if tx.Error != nil {
-		log.Printf("ERROR: Database query failed for address %s: %v", split[0], tx.Error)
+	} else if err != nil {
+		log.Printf("ERROR: Database query failed for address %s: %v", s.ToAddr, err)
 		return nil
 	}
 	
@@ -72,51 +141,59 @@ func (s *Session) Data(r io.Reader) error {
 		log.Println(err)
 	}
 
+	from := s.FromAddr
+	if len(email.From) > 0 {
+		from = email.From[0].Address
+	}
+
+	if blocklist.Check(s.Stores.GlobalRules, blocklist.Message{Sender: from, Subject: email.Subject}) != nil {
+		return rejectGlobal
+	}
+
+	if ok, reason := ingest.SenderAllowed(s.Stores.Senders, address.ID, from, s.FromAddr); !ok {
+		ingest.LogBlocked(s.Stores.Senders, address.ID, from, email.Subject, reason)
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      "Sender not accepted by this address",
+		}
+	}
+
 	savedEmail := &db.Email{
-		ID:        util.GenerateEmailAddress(),
-		AddressID: address.ID,
-		Content:   string(rawEmail),
+		AddressID:    address.ID,
+		Tag:          tag,
+		Content:      string(rawEmail),
+		EnvelopeFrom: s.FromAddr,
+		Subject:      email.Subject,
+		Sender:       from,
+		BodyText:     search.PlainText(email.TextBody, email.HTMLBody),
 	}
 
-	db.DB.Create(&savedEmail)
+	if ingest.ScoreSpam(savedEmail) == spam.ActionReject {
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      "Message rejected as spam",
+		}
+	}
 
-	subject := email.Subject
-	if subject == "" {
-		subject = "_no subject_"
-	} else {
-		subject = fmt.Sprintf("subject: *%s*", email.Subject)
+	if err := ingest.ScanForViruses(savedEmail, len(email.Attachments)+len(email.EmbeddedFiles) > 0); err != nil {
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+			Message:      "Virus scan unavailable, try again later",
+		}
+	}
+
+	if err := ingest.SaveEmail(s.Stores, savedEmail); err != nil {
+		log.Printf("ERROR: Failed to save email for %s: %v", address.ID, err)
+		return errors.New("error saving message")
 	}
 
 	body := ""
 
 	if email.HTMLBody != "" {
-		converter := md.NewConverter("", true, &md.Options{
-			StrongDelimiter: "*",
-			EmDelimiter:     "_",
-		})
-
-		converter.AddRules(
-			md.Rule{
-				Filter: []string{"a"},
-				Replacement: func(content string, selec *goquery.Selection, options *md.Options) *string {
-					return md.String(fmt.Sprintf("<%s|%s>", selec.AttrOr("href", content), content))
-				},
-			},
-			md.Rule{
-				Filter: []string{"h1", "h2", "h3", "h4", "h5", "h6"},
-				Replacement: func(content string, selec *goquery.Selection, options *md.Options) *string {
-					return md.String("\n\n*" + content + "*\n\n")
-				},
-			},
-			md.Rule{
-				Filter: []string{"img"},
-				Replacement: func(content string, selec *goquery.Selection, options *md.Options) *string {
-					return md.String("")
-				},
-			},
-		)
-
-		body, err = converter.ConvertString(email.HTMLBody)
+		body, err = ingest.Markdown(email.HTMLBody)
 		if err != nil {
 			return errors.New("error parsing message")
 		}
@@ -124,50 +201,96 @@ func (s *Session) Data(r io.Reader) error {
 		body = email.TextBody
 	}
 
-	_, _, err = slackevents.Client.PostMessage(
-		os.Getenv("SLACK_CHANNEL"),
-		slack.MsgOptionDisableLinkUnfurl(),
-		slack.MsgOptionDisableMediaUnfurl(),
-		slack.MsgOptionTS(address.Timestamp),
-		slack.MsgOptionBlocks(
-			slack.NewSectionBlock(
-				slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("message from `%s`\n%s", email.From[0].Address, util.SanitizeInput(subject)), false, false),
-				nil,
-				nil,
-			),
-			slack.NewDividerBlock(),
-			slack.NewSectionBlock(
-				slack.NewTextBlockObject("mrkdwn", util.SanitizeInput(body), false, false),
-				nil,
-				nil,
-			),
-			slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("Not rendering properly? Click <%s/%s|here> to view this email in your browser.", os.Getenv("APP_DOMAIN"), savedEmail.ID), false, false)),
-		),
-	)
-	if err != nil {
-		log.Println(err)
-	}
+	ingest.Notify(s.Stores, address, *savedEmail, from, email.Subject, body)
 
 	return nil
 }
 
-type Backend struct{}
+type Backend struct {
+	Stores store.Stores
+}
 
 func (b Backend) Login(state *smtp.ConnectionState, username, password string) (smtp.Session, error) {
 	return nil, smtp.ErrAuthUnsupported
 }
 
 func (b Backend) AnonymousLogin(state *smtp.ConnectionState) (smtp.Session, error) {
-	return &Session{}, nil
+	session := &Session{Stores: b.Stores}
+	if addr, ok := state.RemoteAddr.(*net.TCPAddr); ok {
+		session.RemoteIP = addr.IP
+	}
+
+	return session, nil
+}
+
+// runMigrate handles "temp-email migrate [up|down [n]|status]"
+func runMigrate(args []string) {
+	db.Open()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		count, err := db.MigrateUp()
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		log.Printf("SUCCESS: Applied %d migrations", count)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatalf("ERROR: Invalid number of migrations to revert: %s", args[1])
+			}
+			steps = n
+		}
+
+		count, err := db.MigrateDown(steps)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		log.Printf("SUCCESS: Reverted %d migrations", count)
+	case "status":
+		states, err := db.MigrationStatus()
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", state.Version, state.Name, applied)
+		}
+	default:
+		log.Fatalf("Usage: %s migrate [up|down [n]|status]", os.Args[0])
+	}
 }
 
 func main() {
 	godotenv.Load()
-	rand.Seed(time.Now().UnixNano())
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
 
 	db.Connect()
+	stores := store.Gorm(db.DB)
+	domains.Seed(stores)
+
+	if err := blocklist.Reload(stores.GlobalRules); err != nil {
+		log.Printf("ERROR: Failed to load global blocklist: %v", err)
+	}
+
+	go search.Backfill(db.DB)
+	webhooks.Start(stores.Webhooks)
 
-	backend := Backend{}
+	backend := Backend{Stores: stores}
 	server := smtp.NewServer(backend)
 
 	server.Addr = ":3000"
@@ -184,8 +307,8 @@ func main() {
 	}()
 
 	// Start the scheduler
-	schedule.Start()
+	schedule.Start(stores)
 
 	// Start listening for Slack events
-	slackevents.Start()
+	slackevents.Start(stores)
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/notify"
+	"github.com/cjdenio/temp-email/pkg/srs"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/emersion/go-smtp"
+)
+
+// recorder is a notifier that remembers the mail it's told about
+type recorder struct {
+	mu       sync.Mutex
+	received []notify.Received
+}
+
+func (r *recorder) AddressCreated(db.Address) error          { return nil }
+func (r *recorder) Expiring(db.Address, time.Duration) error { return nil }
+func (r *recorder) Expired(db.Address) error                 { return nil }
+func (r *recorder) EmailReceived(_ db.Address, email notify.Received) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.received = append(r.received, email)
+	return nil
+}
+
+// newStores returns in-memory stores with an enabled temp.example domain,
+// an active inbox@, an expired old@ and spare@ on the disabled off.example,
+// all notifying a fresh recorder
+func newStores(t *testing.T) (store.Stores, *recorder) {
+	t.Helper()
+
+	rec := &recorder{}
+	notify.Register("test", rec)
+
+	stores := store.Memory()
+	stores.Domains.Create(&db.Domain{Name: "temp.example", Pool: "default", Enabled: true, Verified: true})
+	stores.Domains.Create(&db.Domain{Name: "off.example", Pool: "default", Verified: true})
+
+	now := time.Now()
+	for _, address := range []db.Address{
+		{ID: "inbox", Domain: "temp.example", CreatedAt: now, ExpiresAt: now.Add(time.Hour), Notifier: "test"},
+		{ID: "old", Domain: "temp.example", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour), Notifier: "test"},
+		{ID: "spare", Domain: "off.example", CreatedAt: now, ExpiresAt: now.Add(time.Hour), Notifier: "test"},
+	} {
+		address := address
+		if err := stores.Addresses.Save(&address); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return stores, rec
+}
+
+// deliver runs one SMTP transaction through a fresh session
+func deliver(stores store.Stores, from, to, message string) error {
+	s := &Session{Stores: stores}
+	if err := s.Mail(from, smtp.MailOptions{}); err != nil {
+		return err
+	}
+	if err := s.Rcpt(to); err != nil {
+		return err
+	}
+
+	return s.Data(strings.NewReader(message))
+}
+
+func message(from, subject string) string {
+	return "From: " + from + "\r\nTo: inbox@temp.example\r\nSubject: " + subject + "\r\n\r\nHello there\r\n"
+}
+
+func TestSessionDeliversToActiveAddress(t *testing.T) {
+	stores, rec := newStores(t)
+	hook := db.Webhook{URL: "http://hooks.example/"}
+	stores.Webhooks.Create(&hook)
+
+	err := deliver(stores, "bounces@mailer.example", "Inbox+News@temp.example", message("Shop <hi@shop.example>", "Your order"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails, _ := stores.Emails.List("inbox", nil)
+	if len(emails) != 1 {
+		t.Fatalf("inbox has %d emails, want 1", len(emails))
+	}
+	email := emails[0]
+	if email.Tag != "news" || email.Subject != "Your order" || email.Sender != "hi@shop.example" || email.EnvelopeFrom != "bounces@mailer.example" || email.ThreadID == "" {
+		t.Errorf("saved email = %+v", email)
+	}
+
+	if len(rec.received) != 1 || rec.received[0].Email.ID != email.ID {
+		t.Errorf("owner told about %+v, want the saved email", rec.received)
+	}
+	if deliveries, _ := stores.Webhooks.Deliveries(hook.ID, 10); len(deliveries) != 1 || deliveries[0].EmailID != email.ID {
+		t.Errorf("webhook deliveries = %+v, want one for the saved email", deliveries)
+	}
+}
+
+func TestSessionRejectsInactiveAddresses(t *testing.T) {
+	stores, rec := newStores(t)
+
+	for _, to := range []string{"old@temp.example", "nobody@temp.example", "spare@off.example", "inbox@elsewhere.example"} {
+		if err := deliver(stores, "a@b.example", to, message("a@b.example", "Hi")); err == nil {
+			t.Errorf("mail to %s was accepted", to)
+		}
+	}
+
+	if count, _ := stores.Emails.Count(); count != 0 {
+		t.Errorf("%d emails saved, want 0", count)
+	}
+	if len(rec.received) != 0 {
+		t.Errorf("owner notified about rejected mail: %+v", rec.received)
+	}
+}
+
+func TestSessionAppliesSenderRules(t *testing.T) {
+	stores, _ := newStores(t)
+	stores.Senders.AddRule(&db.SenderRule{AddressID: "inbox", Pattern: "spam.example"})
+
+	// Block rules turn the envelope sender away at RCPT
+	err := deliver(stores, "promo@spam.example", "inbox@temp.example", message("promo@spam.example", "Deals"))
+	if smtpErr, ok := err.(*smtp.SMTPError); !ok || smtpErr.Code != 550 {
+		t.Fatalf("blocked envelope sender got %v, want a 550", err)
+	}
+
+	// and the From header once the message arrives
+	err = deliver(stores, "bounce@esp.example", "inbox@temp.example", message("promo@spam.example", "More deals"))
+	if smtpErr, ok := err.(*smtp.SMTPError); !ok || smtpErr.Code != 550 {
+		t.Fatalf("blocked From got %v, want a 550", err)
+	}
+
+	blocked, _ := stores.Senders.Blocked("inbox", 10)
+	if len(blocked) != 2 || blocked[0].Subject != "More deals" {
+		t.Errorf("blocked log = %+v, want both attempts, newest first", blocked)
+	}
+
+	// With an allow rule, anything not on it is turned away
+	stores.Senders.AddRule(&db.SenderRule{AddressID: "inbox", Pattern: "shop.example", Allow: true})
+	if err := deliver(stores, "bounce@esp.example", "inbox@temp.example", message("hi@other.example", "Hi")); err == nil {
+		t.Error("sender not on the allowlist was accepted")
+	}
+	if err := deliver(stores, "bounce@esp.example", "inbox@temp.example", message("hi@shop.example", "Hi")); err != nil {
+		t.Errorf("allowlisted sender was rejected: %v", err)
+	}
+}
+
+func TestSessionOnlyAcceptsBouncesForSRSAddresses(t *testing.T) {
+	t.Setenv("SMTP_RELAY_ADDR", "127.0.0.1:2525")
+	t.Setenv("SRS_SECRET", "srs-secret")
+	stores, _ := newStores(t)
+	bounce := srs.Forward("srs-secret", "a@shop.example", "temp.example")
+
+	// A DSN comes from the null sender and is passed back
+	s := &Session{Stores: stores}
+	s.Mail("", smtp.MailOptions{})
+	if err := s.Rcpt(bounce); err != nil || s.BounceTo != "a@shop.example" {
+		t.Errorf("bounce got %v (BounceTo %q), want it accepted for a@shop.example", err, s.BounceTo)
+	}
+
+	// Anything else would turn the SRS address into an open relay
+	s = &Session{Stores: stores}
+	s.Mail("spammer@bad.example", smtp.MailOptions{})
+	err := s.Rcpt(bounce)
+	if smtpErr, ok := err.(*smtp.SMTPError); !ok || smtpErr.Code != 550 {
+		t.Errorf("mail with a sender got %v, want a 550", err)
+	}
+	if s.BounceTo != "" {
+		t.Errorf("BounceTo = %q after rejecting", s.BounceTo)
+	}
+}
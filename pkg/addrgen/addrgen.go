@@ -0,0 +1,210 @@
+package addrgen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cjdenio/temp-email/pkg/util"
+)
+
+// Address styles users can pick from
+const (
+	// StyleRandom is a run of random characters, e.g. x7q2k9
+	StyleRandom = "random"
+	// StyleWords is an adjective, a noun and some digits, e.g. brave-otter-4821
+	StyleWords = "words"
+	// StyleSyllables is a pronounceable string of syllables, e.g. bakotumide
+	StyleSyllables = "syllables"
+	// StyleNamed is a user-supplied name plus a random suffix, e.g. github-x7q2k9
+	StyleNamed = "named"
+)
+
+const (
+	defaultAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	defaultLength   = 6
+
+	defaultMinEntropy = 30
+
+	consonants = "bdfghjklmnprstvz"
+	vowels     = "aeiou"
+
+	maxNameLength = 32
+
+	// How many times to redraw a candidate that hits the blocklist
+	maxBlockedRedraws = 100
+)
+
+// Styles lists every style, in the order they should be offered
+var Styles = []string{StyleRandom, StyleWords, StyleSyllables, StyleNamed}
+
+// Generator returns a fresh candidate local part on every call
+type Generator func() string
+
+// ErrUnknownStyle is returned for a style that isn't in Styles
+var ErrUnknownStyle = errors.New("unknown address style")
+
+// minEntropy is the number of random bits every style must guarantee, set with
+// ADDRESS_MIN_ENTROPY_BITS
+func minEntropy() float64 {
+	bits, err := strconv.Atoi(os.Getenv("ADDRESS_MIN_ENTROPY_BITS"))
+	if err != nil || bits <= 0 {
+		bits = defaultMinEntropy
+	}
+
+	return float64(bits)
+}
+
+// charsFor returns how many draws from an alphabet of size n are needed for
+// the given number of bits
+func charsFor(bits float64, n int) int {
+	return int(math.Ceil(bits / math.Log2(float64(n))))
+}
+
+// IsStyle reports whether style is one of Styles
+func IsStyle(style string) bool {
+	for _, s := range Styles {
+		if s == style {
+			return true
+		}
+	}
+
+	return false
+}
+
+// New returns a generator for the given style. An empty style means
+// StyleNamed if a name is given and StyleRandom otherwise.
+func New(style, name string) (Generator, error) {
+	if style == "" {
+		style = StyleRandom
+		if name != "" {
+			style = StyleNamed
+		}
+	}
+
+	var gen Generator
+
+	switch style {
+	case StyleRandom:
+		gen = randomChars()
+	case StyleWords:
+		gen = words()
+	case StyleSyllables:
+		gen = syllables()
+	case StyleNamed:
+		// The name was checked on its own, so only the suffix is redrawn
+		return named(name)
+	default:
+		return nil, ErrUnknownStyle
+	}
+
+	return withoutBlocked(gen), nil
+}
+
+// withoutBlocked redraws candidates that are reserved or contain a profane
+// word
+func withoutBlocked(gen Generator) Generator {
+	return func() string {
+		candidate := gen()
+		for i := 0; i < maxBlockedRedraws && (Blocked(candidate) || containsProfanity(candidate)); i++ {
+			candidate = gen()
+		}
+
+		return candidate
+	}
+}
+
+func randomChars() Generator {
+	alphabet := os.Getenv("ADDRESS_ALPHABET")
+	if alphabet == "" {
+		alphabet = defaultAlphabet
+	}
+
+	length, err := strconv.Atoi(os.Getenv("ADDRESS_LENGTH"))
+	if err != nil || length <= 0 {
+		length = defaultLength
+	}
+	if min := charsFor(minEntropy(), len([]rune(alphabet))); length < min {
+		length = min
+	}
+
+	return func() string {
+		return util.RandomString(alphabet, length)
+	}
+}
+
+func words() Generator {
+	wordBits := math.Log2(float64(len(adjectives))) + math.Log2(float64(len(nouns)))
+
+	digits := 4
+	if needed := charsFor(minEntropy()-wordBits, 10); needed > digits {
+		digits = needed
+	}
+
+	return func() string {
+		adjective := adjectives[util.RandomInt(len(adjectives))]
+		noun := nouns[util.RandomInt(len(nouns))]
+
+		return fmt.Sprintf("%s-%s-%s", adjective, noun, util.RandomString("0123456789", digits))
+	}
+}
+
+func syllables() Generator {
+	count := charsFor(minEntropy(), len(consonants)*len(vowels))
+
+	return func() string {
+		var b strings.Builder
+		for i := 0; i < count; i++ {
+			b.WriteString(util.RandomString(consonants, 1))
+			b.WriteString(util.RandomString(vowels, 1))
+		}
+
+		return b.String()
+	}
+}
+
+func named(name string) (Generator, error) {
+	if name == "" {
+		return nil, errors.New("named addresses need a name.")
+	}
+
+	name = SanitizeName(name)
+	if name == "" {
+		return nil, errors.New("that name doesn't have any usable characters. try letters and numbers.")
+	}
+	if Blocked(name) {
+		return nil, fmt.Errorf("the name %q isn't allowed. try another one.", name)
+	}
+
+	length := charsFor(minEntropy(), len(defaultAlphabet))
+
+	return func() string {
+		suffix := util.RandomString(defaultAlphabet, length)
+		for i := 0; i < maxBlockedRedraws && containsProfanity(suffix); i++ {
+			suffix = util.RandomString(defaultAlphabet, length)
+		}
+
+		return name + "-" + suffix
+	}, nil
+}
+
+// SanitizeName lowercases a user-supplied name and strips anything that
+// isn't safe in a local part
+func SanitizeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+
+	sanitized := strings.Trim(b.String(), "-_.")
+	if len(sanitized) > maxNameLength {
+		sanitized = sanitized[:maxNameLength]
+	}
+
+	return sanitized
+}
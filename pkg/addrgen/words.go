@@ -0,0 +1,97 @@
+package addrgen
+
+import "strings"
+
+var adjectives = []string{
+	"able", "amber", "ample", "azure", "bold", "brave", "breezy", "bright",
+	"brisk", "calm", "candid", "cheery", "chill", "clever", "cosmic", "cozy",
+	"crisp", "curly", "dapper", "daring", "dusty", "eager", "early", "easy",
+	"elated", "epic", "fancy", "fast", "fluffy", "fond", "fresh", "frosty",
+	"fuzzy", "gentle", "giant", "glad", "golden", "grand", "green", "happy",
+	"hardy", "hazel", "humble", "icy", "jolly", "jumpy", "keen", "kind",
+	"lively", "lucky", "lunar", "magic", "mellow", "merry", "mighty", "misty",
+	"modest", "neat", "nimble", "noble", "odd", "olive", "plucky", "polite",
+	"proud", "quick", "quiet", "rapid", "rosy", "royal", "rustic", "sandy",
+	"shiny", "silent", "silky", "silver", "sleepy", "smooth", "snowy", "solar",
+	"sporty", "spry", "steady", "stormy", "sunny", "swift", "tidy", "tiny",
+	"tough", "vivid", "warm", "wavy", "wild", "windy", "witty", "zesty",
+}
+
+var nouns = []string{
+	"acorn", "anchor", "apple", "badger", "banjo", "beacon", "birch", "bison",
+	"breeze", "brook", "cactus", "canyon", "cedar", "comet", "coral", "cricket",
+	"daisy", "delta", "dingo", "dolphin", "dune", "eagle", "ember", "falcon",
+	"fern", "fjord", "flame", "forest", "fox", "gecko", "glacier", "grove",
+	"harbor", "hawk", "heron", "hill", "iris", "island", "jaguar", "jasper",
+	"kayak", "kettle", "koala", "lagoon", "lantern", "lemur", "lily", "lotus",
+	"maple", "meadow", "meteor", "moose", "nebula", "newt", "oak", "ocean",
+	"orbit", "otter", "owl", "panda", "pebble", "pepper", "pine", "planet",
+	"pond", "puffin", "quail", "quartz", "rabbit", "raven", "reef", "river",
+	"robin", "rocket", "saddle", "salmon", "sparrow", "spruce", "squid", "star",
+	"summit", "swan", "thistle", "tiger", "toucan", "tulip", "valley", "walnut",
+	"walrus", "willow", "wombat", "yak", "zebra", "zephyr", "pixel", "violet",
+}
+
+// Local parts with a special meaning for mail systems or the service itself
+var reserved = []string{
+	"abuse", "admin", "administrator", "billing", "daemon", "help",
+	"hostmaster", "info", "mailer-daemon", "noc", "no-reply", "noreply",
+	"postmaster", "root", "security", "support", "sysadmin", "webmaster",
+}
+
+// Profane words. User-supplied names are checked word by word, while
+// generated text is checked for them anywhere.
+var profanity = []string{
+	"anal", "anus", "arse", "ass", "bitch", "boob", "butt", "cock", "crap",
+	"cum", "cunt", "damn", "dick", "dildo", "fag", "fuck", "jizz", "kike",
+	"nazi", "nigga", "nigger", "penis", "piss", "porn", "pube", "rape", "sex",
+	"shit", "slut", "spic", "tit", "twat", "vagina", "wank", "whore",
+}
+
+func profane(word string) bool {
+	for _, p := range profanity {
+		if word == p || word == p+"s" || word == p+"es" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Blocked reports whether a user-supplied local part is a reserved name or
+// has a profane word in it. Words are split on dots, hyphens, underscores
+// and digits, so "class" and "sussex" are fine but "sex-tips" isn't.
+func Blocked(local string) bool {
+	local = strings.ToLower(local)
+
+	for _, word := range reserved {
+		if local == word {
+			return true
+		}
+	}
+
+	words := strings.FieldsFunc(local, func(r rune) bool {
+		return r < 'a' || r > 'z'
+	})
+	for _, word := range words {
+		if profane(word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsProfanity reports whether generated text has a profane word
+// anywhere in it. Random text has no word boundaries to go by, and a false
+// positive only costs a redraw.
+func containsProfanity(s string) bool {
+	s = strings.ToLower(s)
+	for _, word := range profanity {
+		if strings.Contains(s, word) {
+			return true
+		}
+	}
+
+	return false
+}
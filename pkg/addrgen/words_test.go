@@ -0,0 +1,45 @@
+package addrgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlocked(t *testing.T) {
+	for _, name := range []string{
+		"class", "password", "title", "document", "analytics", "sussex",
+		"cucumber", "scunthorpe", "jane.doe", "shopping_2024",
+	} {
+		if Blocked(name) {
+			t.Errorf("Blocked(%q) = true, want false", name)
+		}
+	}
+
+	for _, name := range []string{
+		"postmaster", "Abuse", "sex", "sex-tips", "my.ass", "shit_happens",
+		"porn4u", "boobs", "asses",
+	} {
+		if !Blocked(name) {
+			t.Errorf("Blocked(%q) = false, want true", name)
+		}
+	}
+}
+
+func TestWordListsAreClean(t *testing.T) {
+	for _, word := range append(append([]string{}, adjectives...), nouns...) {
+		if containsProfanity(word) {
+			t.Errorf("word list entry %q contains profanity, so it would always be redrawn", word)
+		}
+	}
+}
+
+func TestNamedKeepsName(t *testing.T) {
+	gen, err := New(StyleNamed, "Class")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := gen(); !strings.HasPrefix(got, "class-") {
+		t.Errorf("named address %q doesn't start with the name", got)
+	}
+}
@@ -0,0 +1,195 @@
+package blocklist
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+// Kinds of global rule
+const (
+	KindSender  = "sender"  // an exact sender address
+	KindDomain  = "domain"  // a sender domain and its subdomains
+	KindIP      = "ip"      // a connecting IP or CIDR range (SMTP only)
+	KindSubject = "subject" // a case-insensitive regular expression
+)
+
+// Kinds lists every rule kind
+var Kinds = []string{KindSender, KindDomain, KindIP, KindSubject}
+
+// ErrInvalidRule is returned for a rule whose pattern doesn't suit its kind
+var ErrInvalidRule = errors.New("invalid rule")
+
+type rule struct {
+	db.GlobalRule
+	network *net.IPNet
+	subject *regexp.Regexp
+}
+
+var (
+	mu    sync.RWMutex
+	rules []rule
+)
+
+// Normalize checks a pattern against its kind and returns it in the form it
+// is stored and matched in
+func Normalize(kind, pattern string) (string, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return "", ErrInvalidRule
+	}
+
+	switch kind {
+	case KindSender:
+		pattern = strings.ToLower(pattern)
+		if !strings.Contains(pattern, "@") {
+			return "", fmt.Errorf("%w: sender rules need a full address", ErrInvalidRule)
+		}
+	case KindDomain:
+		pattern = strings.TrimPrefix(strings.ToLower(pattern), "@")
+		if pattern == "" || strings.Contains(pattern, "@") {
+			return "", fmt.Errorf("%w: domain rules take a bare domain", ErrInvalidRule)
+		}
+	case KindIP:
+		if _, err := parseNetwork(pattern); err != nil {
+			return "", fmt.Errorf("%w: %s is not an IP or CIDR range", ErrInvalidRule, pattern)
+		}
+	case KindSubject:
+		if _, err := regexp.Compile(pattern); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	default:
+		return "", fmt.Errorf("%w: unknown kind %q", ErrInvalidRule, kind)
+	}
+
+	return pattern, nil
+}
+
+// parseNetwork accepts either a CIDR range or a single address
+func parseNetwork(pattern string) (*net.IPNet, error) {
+	if !strings.Contains(pattern, "/") {
+		ip := net.ParseIP(pattern)
+		if ip == nil {
+			return nil, ErrInvalidRule
+		}
+		if ip.To4() != nil {
+			pattern += "/32"
+		} else {
+			pattern += "/128"
+		}
+	}
+
+	_, network, err := net.ParseCIDR(pattern)
+	return network, err
+}
+
+// Reload replaces the in-memory rules with those in the database. It's
+// called whenever rules change, and periodically to pick up changes made by
+// other instances.
+func Reload(source store.GlobalRuleStore) error {
+	stored, err := source.List()
+	if err != nil {
+		return err
+	}
+
+	loaded := make([]rule, 0, len(stored))
+	for _, r := range stored {
+		compiled := rule{GlobalRule: r}
+
+		switch r.Kind {
+		case KindIP:
+			network, err := parseNetwork(r.Pattern)
+			if err != nil {
+				log.Printf("ERROR: Skipping global rule %d: bad IP range %q", r.ID, r.Pattern)
+				continue
+			}
+			compiled.network = network
+		case KindSubject:
+			re, err := regexp.Compile("(?i)" + r.Pattern)
+			if err != nil {
+				log.Printf("ERROR: Skipping global rule %d: bad regex %q", r.ID, r.Pattern)
+				continue
+			}
+			compiled.subject = re
+		}
+
+		loaded = append(loaded, compiled)
+	}
+
+	mu.Lock()
+	rules = loaded
+	mu.Unlock()
+
+	return nil
+}
+
+// Message describes what is known about a message at the point it's checked.
+// Empty fields are skipped.
+type Message struct {
+	IP      net.IP
+	Sender  string
+	Subject string
+}
+
+// Check returns the first global rule the message matches, or nil. Matches
+// are counted against the rule and logged with its running hit count.
+func Check(source store.GlobalRuleStore, m Message) *db.GlobalRule {
+	sender := strings.ToLower(strings.TrimSpace(m.Sender))
+	domain := ""
+	if at := strings.LastIndex(sender, "@"); at >= 0 {
+		domain = sender[at+1:]
+	}
+
+	var matched *db.GlobalRule
+
+	mu.RLock()
+	for _, r := range rules {
+		if (r.network != nil && m.IP != nil && r.network.Contains(m.IP)) ||
+			(r.Kind == KindSender && sender != "" && sender == r.Pattern) ||
+			(r.Kind == KindDomain && domain != "" && (domain == r.Pattern || strings.HasSuffix(domain, "."+r.Pattern))) ||
+			(r.subject != nil && m.Subject != "" && r.subject.MatchString(m.Subject)) {
+			found := r.GlobalRule
+			matched = &found
+			break
+		}
+	}
+	mu.RUnlock()
+
+	if matched == nil {
+		return nil
+	}
+
+	matched.Hits = recordHit(source, matched.ID)
+	log.Printf("REJECT: Global %s rule %d (%q) matched mail from %s [%s] (%d hits)", matched.Kind, matched.ID, matched.Pattern, m.Sender, m.IP, matched.Hits)
+
+	return matched
+}
+
+// recordHit bumps a rule's hit count in both the database and the cache, and
+// returns the new count
+func recordHit(source store.GlobalRuleStore, id uint) int64 {
+	now := time.Now()
+	if err := source.RecordHit(id, now); err != nil {
+		log.Printf("ERROR: Failed to count hit on global rule %d: %v", id, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range rules {
+		if rules[i].ID == id {
+			rules[i].Hits++
+			rules[i].LastHitAt = &now
+			return rules[i].Hits
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,155 @@
+package blocklist
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+// load stores the given rules, loads them and empties the cache again once
+// the test is done, so no test sees another's rules
+func load(t *testing.T, stored ...db.GlobalRule) store.GlobalRuleStore {
+	t.Helper()
+	t.Cleanup(func() {
+		mu.Lock()
+		rules = nil
+		mu.Unlock()
+	})
+
+	source := store.NewMemoryGlobalRules()
+	for _, r := range stored {
+		r := r
+		if err := source.Create(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Reload(source); err != nil {
+		t.Fatal(err)
+	}
+
+	return source
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		kind, pattern string
+		want          string
+		ok            bool
+	}{
+		{KindSender, " Promo@Shop.Example ", "promo@shop.example", true},
+		{KindSender, "shop.example", "", false},
+		{KindDomain, "@Shop.Example", "shop.example", true},
+		{KindDomain, "promo@shop.example", "", false},
+		{KindDomain, "@", "", false},
+		{KindIP, "192.0.2.1", "192.0.2.1", true},
+		{KindIP, "192.0.2.0/24", "192.0.2.0/24", true},
+		{KindIP, "2001:db8::1", "2001:db8::1", true},
+		{KindIP, "2001:db8::/32", "2001:db8::/32", true},
+		{KindIP, "192.0.2.300", "", false},
+		{KindIP, "192.0.2.0/33", "", false},
+		{KindSubject, "(?:win|won) a prize", "(?:win|won) a prize", true},
+		{KindSubject, "([unclosed", "", false},
+		{KindSender, "   ", "", false},
+		{"header", "x-spam", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.kind, tt.pattern)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("Normalize(%q, %q) = %q, %v, want %q, ok %v", tt.kind, tt.pattern, got, err, tt.want, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("Normalize(%q, %q) error %v isn't ErrInvalidRule", tt.kind, tt.pattern, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	source := load(t,
+		db.GlobalRule{Kind: KindIP, Pattern: "192.0.2.0/24"},
+		db.GlobalRule{Kind: KindIP, Pattern: "198.51.100.7"},
+		db.GlobalRule{Kind: KindIP, Pattern: "2001:db8:bad::/48"},
+		db.GlobalRule{Kind: KindDomain, Pattern: "example.com"},
+		db.GlobalRule{Kind: KindSender, Pattern: "promo@shop.example"},
+		db.GlobalRule{Kind: KindSubject, Pattern: "you(?:'ve)? won"},
+	)
+
+	tests := []struct {
+		name string
+		m    Message
+		want string // pattern of the matching rule, or empty
+	}{
+		{"IP in range", Message{IP: net.ParseIP("192.0.2.200")}, "192.0.2.0/24"},
+		{"IP outside range", Message{IP: net.ParseIP("192.0.3.1")}, ""},
+		{"single IP", Message{IP: net.ParseIP("198.51.100.7")}, "198.51.100.7"},
+		{"single IP's neighbour", Message{IP: net.ParseIP("198.51.100.8")}, ""},
+		{"IPv6 in range", Message{IP: net.ParseIP("2001:db8:bad:1::25")}, "2001:db8:bad::/48"},
+		{"IPv6 outside range", Message{IP: net.ParseIP("2001:db8:beef::25")}, ""},
+		{"domain", Message{Sender: "a@example.com"}, "example.com"},
+		{"subdomain", Message{Sender: "a@mail.Example.com"}, "example.com"},
+		{"lookalike domain", Message{Sender: "a@evilexample.com"}, ""},
+		{"domain as a prefix", Message{Sender: "a@example.com.evil.test"}, ""},
+		{"sender", Message{Sender: " Promo@Shop.example "}, "promo@shop.example"},
+		{"other sender at the same domain", Message{Sender: "hi@shop.example"}, ""},
+		{"subject ignores case", Message{Subject: "YOU'VE WON a cruise"}, "you(?:'ve)? won"},
+		{"subject no match", Message{Subject: "Your receipt"}, ""},
+		{"nothing known", Message{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if matched := Check(source, tt.m); matched != nil {
+				got = matched.Pattern
+			}
+			if got != tt.want {
+				t.Errorf("Check(%+v) matched %q, want %q", tt.m, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReloadSkipsBadRules(t *testing.T) {
+	source := load(t,
+		db.GlobalRule{Kind: KindSubject, Pattern: "([unclosed"},
+		db.GlobalRule{Kind: KindIP, Pattern: "not an ip"},
+		db.GlobalRule{Kind: KindSubject, Pattern: "lottery"},
+	)
+
+	if len(rules) != 1 || rules[0].Pattern != "lottery" {
+		t.Errorf("loaded %+v, want only the good rule", rules)
+	}
+	if matched := Check(source, Message{Subject: "Lottery winner"}); matched == nil {
+		t.Error("the good rule stopped matching")
+	}
+}
+
+func TestCheckCountsHits(t *testing.T) {
+	source := load(t,
+		db.GlobalRule{Kind: KindDomain, Pattern: "spam.example"},
+		db.GlobalRule{Kind: KindDomain, Pattern: "other.example"},
+	)
+
+	for i := 1; i <= 3; i++ {
+		matched := Check(source, Message{Sender: "a@spam.example"})
+		if matched == nil || matched.Hits != int64(i) {
+			t.Fatalf("hit %d: matched %+v", i, matched)
+		}
+	}
+
+	stored, _ := source.List()
+	if stored[0].Hits != 3 || stored[0].LastHitAt == nil || stored[1].Hits != 0 {
+		t.Errorf("stored rules = %+v, want 3 hits on the first and none on the second", stored)
+	}
+
+	// Counts survive a reload, since they're kept in the store too
+	if err := Reload(source); err != nil {
+		t.Fatal(err)
+	}
+	if matched := Check(source, Message{Sender: "a@spam.example"}); matched == nil || matched.Hits != 4 {
+		t.Errorf("after reloading, matched %+v, want hit 4", matched)
+	}
+}
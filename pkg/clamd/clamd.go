@@ -0,0 +1,119 @@
+package clamd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chunkSize is how much of the message is sent per INSTREAM chunk
+const chunkSize = 64 * 1024
+
+// ErrProtocol is returned when clamd's reply can't be understood
+var ErrProtocol = errors.New("unexpected response from clamd")
+
+// Result is clamd's verdict on a stream
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Client talks to a clamd daemon over TCP or a unix socket
+type Client struct {
+	Network string
+	Addr    string
+	Timeout time.Duration
+}
+
+// FromEnv returns a client for CLAMD_ADDR, either "host:port" or
+// "unix:/path/to/clamd.sock", or nil if virus scanning is off
+func FromEnv() *Client {
+	addr := os.Getenv("CLAMD_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	seconds, err := strconv.Atoi(os.Getenv("CLAMD_TIMEOUT_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = 30
+	}
+
+	client := &Client{Network: "tcp", Addr: addr, Timeout: time.Duration(seconds) * time.Second}
+	if strings.HasPrefix(addr, "unix:") {
+		client.Network, client.Addr = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+
+	return client
+}
+
+// Scan streams r to clamd with the INSTREAM command
+func (c *Client) Scan(r io.Reader) (Result, error) {
+	conn, err := net.DialTimeout(c.Network, c.Addr, c.Timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, err
+	}
+
+	// Each chunk is prefixed with its length; a zero length ends the stream
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return Result{}, err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return Result{}, err
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return Result{}, err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return Result{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return Result{}, err
+	}
+
+	return parseReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseReply reads "stream: OK", "stream: <signature> FOUND" or
+// "<message> ERROR"
+func parseReply(reply string) (Result, error) {
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.Index(signature, ": "); i >= 0 {
+			signature = signature[i+2:]
+		}
+		return Result{Infected: true, Signature: signature}, nil
+	case strings.HasSuffix(reply, " OK"):
+		return Result{}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return Result{}, fmt.Errorf("clamd error: %s", reply)
+	}
+
+	return Result{}, ErrProtocol
+}
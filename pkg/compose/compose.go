@@ -0,0 +1,200 @@
+package compose
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/DusanKasan/parsemail"
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/dkim"
+	"github.com/cjdenio/temp-email/pkg/outbound"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/util"
+)
+
+// ErrNotConfigured is returned when there's no outbound transport to send with
+var ErrNotConfigured = errors.New("sending needs SMTP_RELAY_ADDR, or MAILGUN_API_KEY and MAILGUN_DOMAIN, to be set")
+
+// ErrInvalidRecipient is returned when a draft's To can't be parsed
+var ErrInvalidRecipient = errors.New("invalid recipient")
+
+// ErrExpired is returned when sending from an address that has expired
+var ErrExpired = errors.New("this address has expired, so it can't send mail")
+
+// transport picks what composed mail is sent through; tests can swap in a
+// local stand-in
+var transport = outbound.Default
+
+// Draft is a message being written from a temporary address
+type Draft struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+
+	// InReplyTo is the ID of the email being replied to, if any
+	InReplyTo string `json:"inReplyTo,omitempty"`
+}
+
+// ReplyTo drafts a reply to email, addressed to its Reply-To or From and
+// quoting its text
+func ReplyTo(email db.Email) Draft {
+	subject := email.Subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	draft := Draft{InReplyTo: email.ID, Subject: strings.TrimSpace(subject)}
+
+	msg, err := mail.ReadMessage(strings.NewReader(email.Content))
+	if err != nil {
+		draft.To = email.Sender
+		return draft
+	}
+
+	draft.To = msg.Header.Get("Reply-To")
+	if draft.To == "" {
+		draft.To = msg.Header.Get("From")
+	}
+	if addrs, err := mail.ParseAddressList(draft.To); err == nil && len(addrs) > 0 {
+		var to []string
+		for _, a := range addrs {
+			to = append(to, a.Address)
+		}
+		draft.To = strings.Join(to, ", ")
+	} else {
+		draft.To = email.Sender
+	}
+
+	text := email.BodyText
+	if parsed, err := parsemail.Parse(strings.NewReader(email.Content)); err == nil && parsed.TextBody != "" {
+		text = parsed.TextBody
+	}
+
+	var quoted strings.Builder
+	fmt.Fprintf(&quoted, "\n\nOn %s, %s wrote:\n", email.CreatedAt.Format("Mon, Jan 2, 2006 at 3:04 PM"), email.Sender)
+	for _, line := range strings.Split(strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n") {
+		quoted.WriteString("> " + line + "\n")
+	}
+	draft.Body = quoted.String()
+
+	return draft
+}
+
+// threadHeaders returns the Message-ID and References of a received email
+func threadHeaders(email db.Email) (string, string) {
+	msg, err := mail.ReadMessage(strings.NewReader(email.Content))
+	if err != nil {
+		return "", ""
+	}
+
+	return strings.TrimSpace(msg.Header.Get("Message-ID")), strings.TrimSpace(msg.Header.Get("References"))
+}
+
+// oneLine stops header values from smuggling in extra headers
+func oneLine(s string) string {
+	return strings.TrimSpace(strings.NewReplacer("\r", " ", "\n", " ").Replace(s))
+}
+
+// Build renders a draft as a MIME message from address, threaded under the
+// email it replies to, if any. It returns the recipients and the message's
+// Message-ID along with the message.
+func Build(address db.Address, draft Draft, original *db.Email) ([]byte, []string, string, error) {
+	rcpts, err := mail.ParseAddressList(draft.To)
+	if err != nil || len(rcpts) == 0 {
+		return nil, nil, "", ErrInvalidRecipient
+	}
+
+	var to, headerTo []string
+	for _, rcpt := range rcpts {
+		to = append(to, rcpt.Address)
+		headerTo = append(headerTo, rcpt.String())
+	}
+
+	from := address.ID + "@" + address.Domain
+	messageID := fmt.Sprintf("<%s@%s>", util.GenerateEmailID(), address.Domain)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(headerTo, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", oneLine(draft.Subject)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: %s\r\n", messageID)
+
+	if original != nil {
+		if parentID, references := threadHeaders(*original); parentID != "" {
+			fmt.Fprintf(&msg, "In-Reply-To: %s\r\n", parentID)
+			fmt.Fprintf(&msg, "References: %s\r\n", strings.TrimSpace(oneLine(references)+" "+parentID))
+		}
+	}
+
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	body := strings.ReplaceAll(strings.ReplaceAll(draft.Body, "\r\n", "\n"), "\n", "\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write([]byte(body))
+	qp.Close()
+	msg.WriteString("\r\n")
+
+	return msg.Bytes(), to, messageID, nil
+}
+
+// sign DKIM-signs message if the address's domain has a key
+func sign(domains store.DomainStore, domain string, message []byte) []byte {
+	d, err := domains.Get(domain)
+	if err != nil || d.DKIMPrivateKey == "" {
+		return message
+	}
+
+	key, err := dkim.ParseKey(d.DKIMPrivateKey)
+	if err != nil {
+		log.Printf("ERROR: DKIM key for %s is invalid, sending unsigned: %v", domain, err)
+		return message
+	}
+
+	selector := d.DKIMSelector
+	if selector == "" {
+		selector = dkim.DefaultSelector
+	}
+
+	signed, err := dkim.Sign(message, domain, selector, key)
+	if err != nil {
+		log.Printf("ERROR: Failed to DKIM-sign mail from %s, sending unsigned: %v", domain, err)
+		return message
+	}
+
+	return signed
+}
+
+// Send sends a draft from address, DKIM-signed if its domain has a key,
+// and returns the new message's Message-ID
+func Send(domains store.DomainStore, address db.Address, draft Draft, original *db.Email) (string, error) {
+	if !address.ExpiresAt.After(time.Now()) {
+		return "", ErrExpired
+	}
+
+	t := transport()
+	if t == nil {
+		return "", ErrNotConfigured
+	}
+
+	message, to, messageID, err := Build(address, draft, original)
+	if err != nil {
+		return "", err
+	}
+
+	from := address.ID + "@" + address.Domain
+	if err := t.Send(from, to, sign(domains, address.Domain, message)); err != nil {
+		return "", err
+	}
+
+	log.Printf("SUCCESS: Sent %s from %s to %s", messageID, from, strings.Join(to, ", "))
+	return messageID, nil
+}
@@ -0,0 +1,117 @@
+package compose
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/dkim"
+	"github.com/cjdenio/temp-email/pkg/outbound"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+// fakeTransport records what it's asked to send instead of sending it
+type fakeTransport struct {
+	from    string
+	to      []string
+	message string
+	sends   int
+	err     error
+}
+
+func (f *fakeTransport) Send(from string, to []string, message []byte) error {
+	f.sends++
+	f.from, f.to, f.message = from, to, string(message)
+	return f.err
+}
+
+// useTransport sends through fake for the rest of the test
+func useTransport(t *testing.T, fake outbound.Transport) {
+	previous := transport
+	transport = func() outbound.Transport { return fake }
+	t.Cleanup(func() { transport = previous })
+}
+
+var sender = db.Address{ID: "inbox", Domain: "temp.example", ExpiresAt: time.Now().Add(time.Hour)}
+
+func TestSendSignsAndThreadsReplies(t *testing.T) {
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	key, err := dkim.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	domains := store.NewMemoryDomains()
+	domains.Create(&db.Domain{Name: "temp.example", DKIMPrivateKey: key, DKIMSelector: "mail"})
+
+	original := db.Email{
+		ID:      "abc",
+		Content: "Message-ID: <1@shop.example>\r\nReferences: <0@shop.example>\r\nFrom: Shop <hi@shop.example>\r\nSubject: Order\r\n\r\nThanks\r\n",
+	}
+	draft := Draft{To: "Shop <hi@shop.example>, other@shop.example", Subject: "Re: Order", Body: "Got it\nthanks", InReplyTo: "abc"}
+
+	messageID, err := Send(domains, sender, draft, &original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.sends != 1 || fake.from != "inbox@temp.example" || strings.Join(fake.to, ",") != "hi@shop.example,other@shop.example" {
+		t.Errorf("sent from %q to %v (%d sends)", fake.from, fake.to, fake.sends)
+	}
+	if !strings.HasPrefix(fake.message, "DKIM-Signature: ") || !strings.Contains(fake.message, "d=temp.example") || !strings.Contains(fake.message, "s=mail") {
+		t.Errorf("message isn't signed for temp.example with selector mail:\n%s", fake.message)
+	}
+	for _, header := range []string{
+		"Message-ID: " + messageID + "\r\n",
+		"In-Reply-To: <1@shop.example>\r\n",
+		"References: <0@shop.example> <1@shop.example>\r\n",
+		"Got it\r\nthanks",
+	} {
+		if !strings.Contains(fake.message, header) {
+			t.Errorf("message is missing %q:\n%s", header, fake.message)
+		}
+	}
+}
+
+func TestSendWithoutKeyIsUnsigned(t *testing.T) {
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+
+	if _, err := Send(store.NewMemoryDomains(), sender, Draft{To: "hi@shop.example", Subject: "Hi"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fake.message, "From: inbox@temp.example\r\n") {
+		t.Errorf("message = %q, want it unsigned", fake.message)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	fake := &fakeTransport{}
+	useTransport(t, fake)
+	domains := store.NewMemoryDomains()
+
+	expired := sender
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := Send(domains, expired, Draft{To: "hi@shop.example"}, nil); err != ErrExpired {
+		t.Errorf("sending from an expired address = %v, want ErrExpired", err)
+	}
+	if _, err := Send(domains, sender, Draft{To: "not an address"}, nil); err != ErrInvalidRecipient {
+		t.Errorf("sending to a bad recipient = %v, want ErrInvalidRecipient", err)
+	}
+	if fake.sends != 0 {
+		t.Errorf("transport was used %d times for drafts that can't be sent", fake.sends)
+	}
+
+	fake.err = errors.New("relay down")
+	if _, err := Send(domains, sender, Draft{To: "hi@shop.example"}, nil); err != fake.err {
+		t.Errorf("send through a failing transport = %v, want its error", err)
+	}
+
+	useTransport(t, nil)
+	if _, err := Send(domains, sender, Draft{To: "hi@shop.example"}, nil); err != ErrNotConfigured {
+		t.Errorf("sending without a transport = %v, want ErrNotConfigured", err)
+	}
+}
@@ -3,20 +3,93 @@ package db
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
-func Connect() {
-	_db, err := gorm.Open(postgres.Open(os.Getenv("DATABASE_URL")))
+// Database dialects, chosen by the scheme of DATABASE_URL
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Dialect is the dialect of the open database
+var Dialect string
+
+// sqlitePath turns a DATABASE_URL like "sqlite:///var/lib/temp-email.db",
+// "sqlite://dev.db" or "sqlite::memory:" into a go-sqlite3 DSN. ok is false
+// for anything else.
+func sqlitePath(url string) (dsn string, ok bool) {
+	switch {
+	case strings.HasPrefix(url, "sqlite://"):
+		dsn = strings.TrimPrefix(url, "sqlite://")
+	case strings.HasPrefix(url, "sqlite:"):
+		dsn = strings.TrimPrefix(url, "sqlite:")
+	default:
+		return "", false
+	}
+
+	// Wait on locks rather than failing, and enforce foreign keys like
+	// Postgres does
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_busy_timeout=5000&_foreign_keys=on"
+	}
+
+	return dsn, true
+}
+
+// Open connects to the database in DATABASE_URL without touching the schema.
+// sqlite: URLs open a SQLite file; anything else is handed to Postgres.
+func Open() {
+	url := os.Getenv("DATABASE_URL")
+
+	var dialector gorm.Dialector
+	if dsn, ok := sqlitePath(url); ok {
+		Dialect = SQLite
+		dialector = sqlite.Open(dsn)
+	} else {
+		Dialect = Postgres
+		dialector = postgres.Open(url)
+	}
+
+	_db, err := gorm.Open(dialector)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// SQLite allows one writer at a time, and each connection to :memory:
+	// would otherwise get its own empty database
+	if Dialect == SQLite {
+		sqlDB, err := _db.DB()
+		if err != nil {
+			log.Fatal(err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+
 	DB = _db
+}
+
+// Connect opens the database and applies any pending migrations, unless
+// MIGRATE_ON_START is false
+func Connect() {
+	Open()
 
-	DB.AutoMigrate(&Address{}, &Email{})
+	if migrate, err := strconv.ParseBool(os.Getenv("MIGRATE_ON_START")); err == nil && !migrate {
+		return
+	}
+
+	count, err := MigrateUp()
+	if err != nil {
+		log.Fatalf("ERROR: Failed to migrate database: %v", err)
+	}
+	if count > 0 {
+		log.Printf("SUCCESS: Applied %d database migrations", count)
+	}
 }
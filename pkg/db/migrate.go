@@ -0,0 +1,234 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migrations live in migrations/<dialect>/ as pairs of NNNN_name.up.sql and
+// NNNN_name.down.sql files, embedded in the binary
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the advisory lock key held while migrating, so replicas
+// starting at the same time take turns
+const migrationLock = 7210403
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and whether it has been applied
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// SchemaMigration records an applied migration in schema_migrations
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// Migrations returns every embedded migration for the open database's
+// dialect in version order
+func Migrations() ([]Migration, error) {
+	dir := path.Join("migrations", Dialect)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		i := strings.Index(base, "_")
+		if i < 0 {
+			return nil, fmt.Errorf("migration %s isn't named NNNN_name", name)
+		}
+		version, err := strconv.Atoi(base[:i])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s isn't named NNNN_name", name)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: base[i+1:]}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// withMigrationLock runs fn in a transaction holding the migration lock.
+// DDL is transactional in both Postgres and SQLite, so a failed migration
+// leaves nothing behind. SQLite needs no lock since it only has one writer.
+func withMigrationLock(fn func(tx *gorm.DB, applied map[int]SchemaMigration) error) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if Dialect == Postgres {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text,
+			applied_at timestamp
+		)`).Error; err != nil {
+			return err
+		}
+
+		var rows []SchemaMigration
+		if err := tx.Order("version").Find(&rows).Error; err != nil {
+			return err
+		}
+
+		applied := map[int]SchemaMigration{}
+		for _, row := range rows {
+			applied[row.Version] = row
+		}
+
+		return fn(tx, applied)
+	})
+}
+
+// MigrateUp applies every pending migration and returns how many ran
+func MigrateUp() (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationLock(func(tx *gorm.DB, applied map[int]SchemaMigration) error {
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			if err := tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error; err != nil {
+				return err
+			}
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, up to steps of
+// them, and returns how many were reverted
+func MigrateDown(steps int) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationLock(func(tx *gorm.DB, applied map[int]SchemaMigration) error {
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %04d_%s can't be reverted", m.Version, m.Name)
+			}
+
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return fmt.Errorf("reverting migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			if err := tx.Delete(&SchemaMigration{}, m.Version).Error; err != nil {
+				return err
+			}
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MigrationStatus lists every migration along with when it was applied
+func MigrationStatus() ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	err = withMigrationLock(func(tx *gorm.DB, applied map[int]SchemaMigration) error {
+		for _, m := range migrations {
+			state := MigrationState{Migration: m}
+			if row, ok := applied[m.Version]; ok {
+				appliedAt := row.AppliedAt
+				state.AppliedAt = &appliedAt
+			}
+			states = append(states, state)
+		}
+
+		return nil
+	})
+
+	return states, err
+}
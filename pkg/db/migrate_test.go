@@ -0,0 +1,103 @@
+package db
+
+import (
+	"testing"
+)
+
+func openMemory(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "sqlite::memory:")
+	Open()
+	t.Cleanup(func() {
+		if sqlDB, err := DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	openMemory(t)
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no SQLite migrations embedded")
+	}
+
+	count, err := MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(migrations) {
+		t.Errorf("MigrateUp applied %d migrations, want %d", count, len(migrations))
+	}
+
+	tables := []string{"addresses", "emails", "domains", "sender_rules", "webhooks", "webhook_deliveries", "forward_rules"}
+	for _, table := range tables {
+		if !DB.Migrator().HasTable(table) {
+			t.Errorf("table %s missing after MigrateUp", table)
+		}
+	}
+	for _, column := range []string{"thread_id", "envelope_from"} {
+		if !DB.Migrator().HasColumn(&Email{}, column) {
+			t.Errorf("emails.%s missing after MigrateUp", column)
+		}
+	}
+
+	// Everything is applied, so a second run is a no-op
+	if count, err := MigrateUp(); err != nil || count != 0 {
+		t.Errorf("second MigrateUp = %d, %v; want 0, nil", count, err)
+	}
+
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			t.Errorf("migration %04d_%s not marked applied", state.Version, state.Name)
+		}
+	}
+
+	// Reverting the latest migration only touches its own columns
+	if count, err := MigrateDown(1); err != nil || count != 1 {
+		t.Fatalf("MigrateDown(1) = %d, %v; want 1, nil", count, err)
+	}
+	if DB.Migrator().HasColumn(&Email{}, "envelope_from") {
+		t.Error("emails.envelope_from still there after reverting the latest migration")
+	}
+	if !DB.Migrator().HasColumn(&Email{}, "thread_id") {
+		t.Error("emails.thread_id dropped by reverting the latest migration")
+	}
+	if !DB.Migrator().HasTable("emails") {
+		t.Error("emails dropped by reverting the latest migration")
+	}
+
+	states, err = MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := states[len(states)-1]; last.AppliedAt != nil {
+		t.Errorf("migration %04d_%s still marked applied", last.Version, last.Name)
+	}
+
+	count, err = MigrateDown(len(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(migrations)-1 {
+		t.Errorf("MigrateDown reverted %d migrations, want %d", count, len(migrations)-1)
+	}
+	for _, table := range tables {
+		if DB.Migrator().HasTable(table) {
+			t.Errorf("table %s still there after reverting every migration", table)
+		}
+	}
+
+	// And back up again from nothing
+	if count, err := MigrateUp(); err != nil || count != len(migrations) {
+		t.Errorf("MigrateUp after reverting = %d, %v; want %d, nil", count, err, len(migrations))
+	}
+}
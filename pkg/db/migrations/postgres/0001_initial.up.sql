@@ -0,0 +1,87 @@
+-- The schema as it stood under AutoMigrate. Everything is guarded so
+-- databases AutoMigrate already created are adopted as-is.
+
+CREATE TABLE IF NOT EXISTS addresses (
+    id text PRIMARY KEY,
+    created_at timestamptz,
+    expires_at timestamptz,
+    timestamp text,
+    "user" text,
+    expired_message_sent boolean DEFAULT false
+);
+
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS domain text;
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS channel text;
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS reactivations bigint DEFAULT 0;
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS warning_sent boolean DEFAULT false;
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS retention_days bigint;
+CREATE INDEX IF NOT EXISTS idx_addresses_domain ON addresses (domain);
+
+CREATE TABLE IF NOT EXISTS emails (
+    id text PRIMARY KEY,
+    created_at timestamptz,
+    address_id text,
+    content text,
+    CONSTRAINT fk_emails_address FOREIGN KEY (address_id) REFERENCES addresses (id)
+);
+
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS tag text;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS subject text;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS sender text;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS body_text text;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS search_vector tsvector;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS spam_score decimal;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS spam_symbols text;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS spam boolean DEFAULT false;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS quarantined boolean DEFAULT false;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS quarantine_reason text;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS virus text;
+CREATE INDEX IF NOT EXISTS idx_emails_tag ON emails (tag);
+CREATE INDEX IF NOT EXISTS idx_emails_sender ON emails (sender);
+CREATE INDEX IF NOT EXISTS idx_emails_search ON emails USING gin (search_vector);
+
+CREATE TABLE IF NOT EXISTS domains (
+    name text PRIMARY KEY,
+    created_at timestamptz,
+    pool text,
+    enabled boolean,
+    verified boolean,
+    verification_token text,
+    verified_at timestamptz,
+    last_checked_at timestamptz,
+    last_check_error text
+);
+CREATE INDEX IF NOT EXISTS idx_domains_pool ON domains (pool);
+
+CREATE TABLE IF NOT EXISTS sender_rules (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    address_id text,
+    pattern text,
+    allow boolean DEFAULT false
+);
+CREATE INDEX IF NOT EXISTS idx_sender_rules_address_id ON sender_rules (address_id);
+
+CREATE TABLE IF NOT EXISTS blocked_emails (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    address_id text,
+    sender text,
+    subject text,
+    reason text
+);
+CREATE INDEX IF NOT EXISTS idx_blocked_emails_address_id ON blocked_emails (address_id);
+
+CREATE TABLE IF NOT EXISTS global_rules (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    kind text,
+    pattern text,
+    hits bigint DEFAULT 0,
+    last_hit_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS seen_events (
+    event_id text PRIMARY KEY,
+    created_at timestamptz
+);
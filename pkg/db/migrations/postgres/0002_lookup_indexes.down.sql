@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_emails_address_id_created_at;
+DROP INDEX IF EXISTS idx_addresses_user;
+DROP INDEX IF EXISTS idx_addresses_expires_at;
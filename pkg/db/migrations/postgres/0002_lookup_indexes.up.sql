@@ -0,0 +1,4 @@
+-- Indexes for the queries ingest, expiry and the dashboard run constantly
+CREATE INDEX IF NOT EXISTS idx_addresses_expires_at ON addresses (expires_at);
+CREATE INDEX IF NOT EXISTS idx_addresses_user ON addresses ("user");
+CREATE INDEX IF NOT EXISTS idx_emails_address_id_created_at ON emails (address_id, created_at);
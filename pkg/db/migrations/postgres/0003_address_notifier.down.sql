@@ -0,0 +1,2 @@
+ALTER TABLE addresses DROP COLUMN IF EXISTS notify_target;
+ALTER TABLE addresses DROP COLUMN IF EXISTS notifier;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    address_id text,
+    url text,
+    secret text
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_address_id ON webhooks (address_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    webhook_id bigint,
+    email_id text,
+    payload text,
+    status text,
+    attempts bigint DEFAULT 0,
+    response_code bigint,
+    last_error text,
+    next_attempt_at timestamptz,
+    delivered_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt_at ON webhook_deliveries (next_attempt_at);
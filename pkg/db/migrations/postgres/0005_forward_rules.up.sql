@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS forward_rules (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    address_id text,
+    destination text,
+    confirm_token text,
+    confirmed_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_forward_rules_address_id ON forward_rules (address_id);
+CREATE INDEX IF NOT EXISTS idx_forward_rules_confirm_token ON forward_rules (confirm_token);
@@ -0,0 +1,2 @@
+ALTER TABLE domains DROP COLUMN IF EXISTS dkim_private_key;
+ALTER TABLE domains DROP COLUMN IF EXISTS dkim_selector;
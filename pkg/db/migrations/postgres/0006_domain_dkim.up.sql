@@ -0,0 +1,3 @@
+-- Optional DKIM key each domain signs outgoing mail with
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS dkim_selector text NOT NULL DEFAULT '';
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS dkim_private_key text NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Conversation threading by Message-ID, In-Reply-To and References
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS message_id text NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS in_reply_to text NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS reference_ids text NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS thread_id text NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS thread_subject text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_emails_address_id_message_id ON emails (address_id, message_id);
+CREATE INDEX IF NOT EXISTS idx_emails_address_id_thread_id ON emails (address_id, thread_id);
+CREATE INDEX IF NOT EXISTS idx_emails_address_id_thread_subject ON emails (address_id, thread_subject);
+-- Mail received before threading is each its own conversation
+UPDATE emails SET thread_id = id WHERE thread_id = '';
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS seen_events;
+DROP TABLE IF EXISTS global_rules;
+DROP TABLE IF EXISTS blocked_emails;
+DROP TABLE IF EXISTS sender_rules;
+DROP TABLE IF EXISTS domains;
+DROP TABLE IF EXISTS emails;
+DROP TABLE IF EXISTS addresses;
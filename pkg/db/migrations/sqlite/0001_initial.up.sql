@@ -0,0 +1,81 @@
+CREATE TABLE addresses (
+    id text PRIMARY KEY,
+    domain text,
+    created_at datetime,
+    expires_at datetime,
+    timestamp text,
+    "user" text,
+    channel text,
+    reactivations integer DEFAULT 0,
+    expired_message_sent numeric DEFAULT false,
+    warning_sent numeric DEFAULT false,
+    retention_days integer
+);
+CREATE INDEX idx_addresses_domain ON addresses (domain);
+
+CREATE TABLE emails (
+    id text PRIMARY KEY,
+    created_at datetime,
+    address_id text REFERENCES addresses (id),
+    tag text,
+    content text,
+    subject text,
+    sender text,
+    body_text text,
+    -- Full-text search is Postgres-only; the column keeps the schemas alike
+    search_vector text,
+    spam_score real,
+    spam_symbols text,
+    spam numeric DEFAULT false,
+    quarantined numeric DEFAULT false,
+    quarantine_reason text,
+    virus text
+);
+CREATE INDEX idx_emails_tag ON emails (tag);
+CREATE INDEX idx_emails_sender ON emails (sender);
+
+CREATE TABLE domains (
+    name text PRIMARY KEY,
+    created_at datetime,
+    pool text,
+    enabled numeric,
+    verified numeric,
+    verification_token text,
+    verified_at datetime,
+    last_checked_at datetime,
+    last_check_error text
+);
+CREATE INDEX idx_domains_pool ON domains (pool);
+
+CREATE TABLE sender_rules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    address_id text,
+    pattern text,
+    allow numeric DEFAULT false
+);
+CREATE INDEX idx_sender_rules_address_id ON sender_rules (address_id);
+
+CREATE TABLE blocked_emails (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    address_id text,
+    sender text,
+    subject text,
+    reason text
+);
+CREATE INDEX idx_blocked_emails_address_id ON blocked_emails (address_id);
+
+CREATE TABLE global_rules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    kind text,
+    pattern text,
+    hits integer DEFAULT 0,
+    last_hit_at datetime
+);
+
+CREATE TABLE seen_events (
+    event_id text PRIMARY KEY,
+    created_at datetime
+);
@@ -0,0 +1,2 @@
+ALTER TABLE addresses DROP COLUMN notify_target;
+ALTER TABLE addresses DROP COLUMN notifier;
@@ -0,0 +1,3 @@
+-- Where each address's notifications go. An empty notifier means Slack.
+ALTER TABLE addresses ADD COLUMN notifier text NOT NULL DEFAULT '';
+ALTER TABLE addresses ADD COLUMN notify_target text NOT NULL DEFAULT '';
@@ -0,0 +1,24 @@
+CREATE TABLE webhooks (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    address_id text,
+    url text,
+    secret text
+);
+CREATE INDEX idx_webhooks_address_id ON webhooks (address_id);
+
+CREATE TABLE webhook_deliveries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    webhook_id integer,
+    email_id text,
+    payload text,
+    status text,
+    attempts integer DEFAULT 0,
+    response_code integer,
+    last_error text,
+    next_attempt_at datetime,
+    delivered_at datetime
+);
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
+CREATE INDEX idx_webhook_deliveries_next_attempt_at ON webhook_deliveries (next_attempt_at);
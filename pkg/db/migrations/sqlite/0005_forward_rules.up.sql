@@ -0,0 +1,10 @@
+CREATE TABLE forward_rules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    address_id text,
+    destination text,
+    confirm_token text,
+    confirmed_at datetime
+);
+CREATE INDEX idx_forward_rules_address_id ON forward_rules (address_id);
+CREATE INDEX idx_forward_rules_confirm_token ON forward_rules (confirm_token);
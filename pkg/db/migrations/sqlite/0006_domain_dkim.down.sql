@@ -0,0 +1,2 @@
+ALTER TABLE domains DROP COLUMN dkim_private_key;
+ALTER TABLE domains DROP COLUMN dkim_selector;
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_emails_address_id_thread_subject;
+DROP INDEX IF EXISTS idx_emails_address_id_thread_id;
+DROP INDEX IF EXISTS idx_emails_address_id_message_id;
+ALTER TABLE emails DROP COLUMN thread_subject;
+ALTER TABLE emails DROP COLUMN thread_id;
+ALTER TABLE emails DROP COLUMN reference_ids;
+ALTER TABLE emails DROP COLUMN in_reply_to;
+ALTER TABLE emails DROP COLUMN message_id;
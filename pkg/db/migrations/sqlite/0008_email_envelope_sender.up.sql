@@ -0,0 +1,3 @@
+-- The SMTP MAIL FROM, which forwarding rewrites with SRS. Empty for
+-- bounces, which come from the null sender.
+ALTER TABLE emails ADD COLUMN envelope_from text NOT NULL DEFAULT '';
@@ -3,12 +3,29 @@ package db
 import "time"
 
 type Address struct {
+	// ID is the local part. It's unique across every domain, not just its
+	// own, because it alone names the address in URLs, the API and
+	// emails.address_id; a local part taken on any domain is redrawn.
 	ID                 string `gorm:"primaryKey"`
+	Domain             string `gorm:"index"`
 	CreatedAt          time.Time
 	ExpiresAt          time.Time
 	Timestamp          string
 	User               string
+	Channel            string
+	Reactivations      int  `gorm:"default:0"`
 	ExpiredMessageSent bool `gorm:"default:false"`
+	WarningSent        bool `gorm:"default:false"`
+
+	// Days to keep this address and its mail after it expires, overriding
+	// RETENTION_DAYS; 0 keeps them forever
+	RetentionDays *int
+
+	// Where notifications about this address go: "slack" (the default when
+	// empty), "discord", "teams" or "matrix". NotifyTarget is the webhook
+	// URL, channel or room for sinks other than Slack.
+	Notifier     string
+	NotifyTarget string
 }
 
 type Email struct {
@@ -16,5 +33,126 @@ type Email struct {
 	CreatedAt time.Time
 	Address   Address
 	AddressID string
+	Tag       string `gorm:"index"`
 	Content   string
+
+	// The envelope sender (MAIL FROM), empty for bounces. Sender is the From
+	// header.
+	EnvelopeFrom string `json:"-"`
+
+	// Pulled out of the message at ingest for search
+	Subject      string
+	Sender       string `gorm:"index"`
+	BodyText     string `json:"-"`
+	SearchVector string `gorm:"type:tsvector;index:idx_emails_search,type:gin;->:false" json:"-"`
+
+	// Spam check verdict. Quarantined mail is kept out of Slack and the
+	// public viewer and only shown in the dashboard.
+	SpamScore        float64
+	SpamSymbols      string
+	Spam             bool `gorm:"default:false"`
+	Quarantined      bool `gorm:"default:false"`
+	QuarantineReason string
+	Virus            string // clamd signature name, if infected
+
+	// Threading headers, with the angle brackets stripped. ReferenceIDs is
+	// the References header as a space-separated list.
+	MessageID    string
+	InReplyTo    string
+	ReferenceIDs string
+	// Emails in the same conversation share a ThreadID. ThreadSubject is the
+	// subject without any Re: or Fwd: prefixes.
+	ThreadID      string
+	ThreadSubject string
+}
+
+// Domain is a domain addresses can be created under. Custom domains stay
+// disabled until their DNS records have been verified.
+type Domain struct {
+	Name              string `gorm:"primaryKey"`
+	CreatedAt         time.Time
+	Pool              string `gorm:"index"`
+	Enabled           bool
+	Verified          bool
+	VerificationToken string
+	VerifiedAt        *time.Time
+	LastCheckedAt     *time.Time
+	LastCheckError    string
+
+	// Outgoing mail from the domain is DKIM-signed when it has a key
+	DKIMSelector   string
+	DKIMPrivateKey string `json:"-"`
+}
+
+// SenderRule allows or blocks a sender for a single address
+type SenderRule struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	AddressID string `gorm:"index"`
+	Pattern   string
+	Allow     bool `gorm:"default:false"`
+}
+
+// BlockedEmail is a record of mail rejected by an address's sender rules
+type BlockedEmail struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	AddressID string `gorm:"index"`
+	Sender    string
+	Subject   string
+	Reason    string
+}
+
+// GlobalRule blocks mail to every address by sender, domain, connecting IP
+// or subject; see the blocklist package
+type GlobalRule struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Kind      string
+	Pattern   string
+	Hits      int64 `gorm:"default:0"`
+	LastHitAt *time.Time
+}
+
+// SeenEvent records a Slack event ID so retried deliveries can be dropped
+type SeenEvent struct {
+	EventID   string `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+// Webhook receives a signed POST for each email delivered to its address, or
+// to every address when AddressID is empty
+type Webhook struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	AddressID string `gorm:"index"`
+	URL       string
+	Secret    string `json:"-"` // only shown once, when the webhook is created
+}
+
+// WebhookDelivery is one attempt (with retries) to deliver an email to a
+// webhook
+type WebhookDelivery struct {
+	ID            uint `gorm:"primaryKey"`
+	CreatedAt     time.Time
+	WebhookID     uint `gorm:"index"`
+	EmailID       string
+	Payload       string `json:"-"`
+	Status        string // pending, delivered or failed
+	Attempts      int    `gorm:"default:0"`
+	ResponseCode  int
+	LastError     string
+	NextAttemptAt *time.Time `gorm:"index"`
+	DeliveredAt   *time.Time
+}
+
+// ForwardRule re-sends an address's mail to a real mailbox once the owner of
+// that mailbox has confirmed it
+type ForwardRule struct {
+	ID           uint `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	AddressID    string `gorm:"index"`
+	Destination  string
+	ConfirmToken string `gorm:"index" json:"-"`
+	ConfirmedAt  *time.Time
 }
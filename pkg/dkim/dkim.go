@@ -0,0 +1,234 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIM signatures here use rsa-sha256 with relaxed/relaxed canonicalization
+// (RFC 6376), which survives the header rewrapping relays tend to do.
+
+// DefaultSelector is used when a domain's key is generated without one
+const DefaultSelector = "tempemail"
+
+// Headers signed when they're present, in this order
+var signedHeaders = []string{
+	"from", "to", "cc", "reply-to", "subject", "date", "message-id",
+	"in-reply-to", "references", "mime-version", "content-type",
+	"content-transfer-encoding",
+}
+
+// ValidSelector reports whether s can be used as a selector: a single DNS
+// label of letters, digits and hyphens
+func ValidSelector(s string) bool {
+	if s == "" || len(s) > 63 || strings.HasPrefix(s, "-") || strings.HasSuffix(s, "-") {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ErrInvalidKey is returned for a private key that isn't a PEM RSA key
+var ErrInvalidKey = errors.New("not a PEM-encoded RSA private key")
+
+// GenerateKey returns a new 2048-bit RSA private key, PEM-encoded
+func GenerateKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})), nil
+}
+
+// ParseKey reads a PEM-encoded PKCS #1 or PKCS #8 RSA private key
+func ParseKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+// TXTRecord returns the value to publish at <selector>._domainkey.<domain>
+func TXTRecord(key *rsa.PrivateKey) (string, error) {
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(public), nil
+}
+
+type header struct {
+	name  string
+	value string
+}
+
+// splitMessage splits a CRLF message into its unfolded headers and its body
+func splitMessage(message []byte) ([]header, []byte, error) {
+	end := bytes.Index(message, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, nil, errors.New("message has no body separator")
+	}
+
+	var headers []header
+	for _, line := range strings.Split(string(message[:end]), "\r\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(headers) > 0 {
+			headers[len(headers)-1].value += "\r\n" + line
+			continue
+		}
+
+		colon := strings.IndexByte(line, ':')
+		if colon <= 0 {
+			return nil, nil, fmt.Errorf("malformed header line %q", line)
+		}
+		headers = append(headers, header{name: line[:colon], value: line[colon+1:]})
+	}
+
+	return headers, message[end+4:], nil
+}
+
+// collapseSpace turns each run of spaces and tabs into a single space
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+
+	return b.String()
+}
+
+func relaxedHeader(h header) string {
+	value := strings.ReplaceAll(h.value, "\r\n", "")
+	value = strings.TrimSpace(collapseSpace(value))
+
+	return strings.ToLower(strings.TrimSpace(h.name)) + ":" + value
+}
+
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseSpace(line), " ")
+	}
+
+	// Trailing empty lines are dropped, and a non-empty body ends in CRLF
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// Sign returns message with a DKIM-Signature header for domain prepended.
+// The message must use CRLF line endings.
+func Sign(message []byte, domain, selector string, key *rsa.PrivateKey) ([]byte, error) {
+	headers, body, err := splitMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	var names []string
+	var canonical strings.Builder
+	for _, name := range signedHeaders {
+		// Only the last instance of a header is signed
+		for i := len(headers) - 1; i >= 0; i-- {
+			if strings.EqualFold(strings.TrimSpace(headers[i].name), name) {
+				names = append(names, name)
+				canonical.WriteString(relaxedHeader(headers[i]) + "\r\n")
+				break
+			}
+		}
+	}
+
+	signature := header{
+		name: "DKIM-Signature",
+		value: " v=1; a=rsa-sha256; c=relaxed/relaxed; d=" + domain +
+			"; s=" + selector +
+			"; t=" + strconv.FormatInt(time.Now().Unix(), 10) +
+			";\r\n h=" + strings.Join(names, ":") +
+			";\r\n bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) +
+			";\r\n b=",
+	}
+
+	// The signature header is hashed last, with b= empty and no trailing CRLF
+	canonical.WriteString(relaxedHeader(signature))
+	hashed := sha256.Sum256([]byte(canonical.String()))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, err
+	}
+
+	signature.value += foldBase64(base64.StdEncoding.EncodeToString(sig))
+
+	var signed bytes.Buffer
+	signed.WriteString(signature.name + ":" + signature.value + "\r\n")
+	signed.Write(message)
+
+	return signed.Bytes(), nil
+}
+
+// foldBase64 wraps a long base64 value so header lines stay short
+func foldBase64(s string) string {
+	const width = 72
+
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width] + "\r\n ")
+		s = s[width:]
+	}
+	b.WriteString(s)
+
+	return b.String()
+}
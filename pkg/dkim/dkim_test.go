@@ -0,0 +1,259 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The verifier below follows RFC 6376 on its own, rather than reusing the
+// canonicalization in dkim.go, so a mistake there can't cancel itself out.
+
+var (
+	wsp          = regexp.MustCompile(`[ \t]+`)
+	trailingWSP  = regexp.MustCompile(`[ \t]+\r\n`)
+	trailingCRLF = regexp.MustCompile(`(\r\n)+$`)
+	fold         = regexp.MustCompile(`\r\n([ \t])`)
+	emptyB       = regexp.MustCompile(`(^|;)([ \t\r\n]*b[ \t\r\n]*=)[^;]*`)
+)
+
+// canonicalBody is the relaxed body canonicalization of RFC 6376 3.4.4
+func canonicalBody(body string) string {
+	body = wsp.ReplaceAllString(body, " ")
+	body = trailingWSP.ReplaceAllString(body, "\r\n")
+	body = trailingCRLF.ReplaceAllString(body, "")
+	if body == "" {
+		return ""
+	}
+
+	return body + "\r\n"
+}
+
+// canonicalHeader is the relaxed header canonicalization of RFC 6376 3.4.2,
+// without the trailing CRLF
+func canonicalHeader(field string) string {
+	colon := strings.Index(field, ":")
+	name, value := field[:colon], field[colon+1:]
+
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Trim(wsp.ReplaceAllString(value, " "), " ")
+
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + value
+}
+
+// fields splits a message's header section into its header fields, each
+// still folded
+func fields(message string) ([]string, string) {
+	end := strings.Index(message, "\r\n\r\n")
+	headers := fold.ReplaceAllString(message[:end], "\x00$1")
+
+	var fields []string
+	for _, line := range strings.Split(headers, "\r\n") {
+		fields = append(fields, strings.ReplaceAll(line, "\x00", "\r\n"))
+	}
+
+	return fields, message[end+4:]
+}
+
+func tags(value string) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range strings.Split(value, ";") {
+		if eq := strings.Index(tag, "="); eq > 0 {
+			tags[strings.TrimSpace(tag[:eq])] = strings.TrimSpace(tag[eq+1:])
+		}
+	}
+
+	return tags
+}
+
+// verify checks the first DKIM-Signature on message against the key
+// published in txt
+func verify(message []byte, txt string) error {
+	all, body := fields(string(message))
+
+	var signature string
+	var rest []string
+	for i, field := range all {
+		if strings.HasPrefix(strings.ToLower(field), "dkim-signature:") && signature == "" {
+			signature = field
+			rest = append(append(rest, all[:i]...), all[i+1:]...)
+		}
+	}
+	if signature == "" {
+		return errors.New("no DKIM-Signature")
+	}
+
+	t := tags(signature[strings.Index(signature, ":")+1:])
+	if t["v"] != "1" || t["a"] != "rsa-sha256" || t["c"] != "relaxed/relaxed" {
+		return fmt.Errorf("unexpected signature tags %v", t)
+	}
+
+	bodyHash := sha256.Sum256([]byte(canonicalBody(body)))
+	if got := base64.StdEncoding.EncodeToString(bodyHash[:]); got != wsp.ReplaceAllString(strings.ReplaceAll(t["bh"], "\r\n", ""), "") {
+		return fmt.Errorf("body hash %s doesn't match bh=%s", got, t["bh"])
+	}
+
+	// Each name in h= takes the next instance of that header from the bottom
+	var hashed strings.Builder
+	used := map[int]bool{}
+	for _, name := range strings.Split(wsp.ReplaceAllString(strings.ReplaceAll(t["h"], "\r\n", ""), ""), ":") {
+		for i := len(rest) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(strings.TrimSpace(rest[i][:strings.Index(rest[i], ":")]), name) {
+				used[i] = true
+				hashed.WriteString(canonicalHeader(rest[i]) + "\r\n")
+				break
+			}
+		}
+	}
+	hashed.WriteString(canonicalHeader(emptyB.ReplaceAllString(signature, "$1$2")))
+
+	sig, err := base64.StdEncoding.DecodeString(wsp.ReplaceAllString(strings.ReplaceAll(t["b"], "\r\n", ""), ""))
+	if err != nil {
+		return err
+	}
+
+	der, err := base64.StdEncoding.DecodeString(tags(txt)["p"])
+	if err != nil {
+		return err
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(hashed.String()))
+	return rsa.VerifyPKCS1v15(public.(*rsa.PublicKey), crypto.SHA256, digest[:], sig)
+}
+
+func testKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	pemKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKey(pemKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt, err := TXTRecord(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, txt
+}
+
+const message = "Received: from relay.example by mx.example; Tue, 1 Oct 2024 10:00:00 +0000\r\n" +
+	"From: Someone <someone@temp.example>\r\n" +
+	"To:  friend@real.example\r\n" +
+	"Subject: A  long subject\r\n\tthat wraps\r\n" +
+	"Date: Tue, 1 Oct 2024 10:00:00 +0000\r\n" +
+	"Message-ID: <abc@temp.example>\r\n" +
+	"\r\n" +
+	"Hello  there,\t\r\n" +
+	"\r\n" +
+	"see you soon \r\n" +
+	"\r\n" +
+	"\r\n"
+
+func TestSignVerifiesIndependently(t *testing.T) {
+	key, txt := testKey(t)
+
+	signed, err := Sign([]byte(message), "temp.example", "sel", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(signed), message) {
+		t.Fatal("Sign changed the message itself")
+	}
+	if err := verify(signed, txt); err != nil {
+		t.Fatalf("signature doesn't verify: %v\n%s", err, signed)
+	}
+
+	sig, _ := fields(string(signed))
+	h := tags(sig[0])["h"]
+	for _, name := range []string{"from", "to", "subject", "date", "message-id"} {
+		if !strings.Contains(h, name) {
+			t.Errorf("h=%s doesn't cover %s", h, name)
+		}
+	}
+	if strings.Contains(h, "received") {
+		t.Errorf("h=%s covers Received, which relays add to", h)
+	}
+}
+
+func TestSignatureSurvivesRelaxedChanges(t *testing.T) {
+	key, txt := testKey(t)
+	signed, err := Sign([]byte(message), "temp.example", "sel", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, from, to string
+	}{
+		{"header refolded", "Subject: A  long subject\r\n\tthat wraps", "Subject:   A long\r\n  subject that   wraps  "},
+		{"header name case", "From: ", "FROM: "},
+		{"body whitespace", "Hello  there,\t\r\n", "Hello \t there,\r\n"},
+		{"trailing blank lines", "see you soon \r\n\r\n\r\n", "see you soon\r\n"},
+		{"relay header added", "Received: ", "X-Relay: seen\r\nReceived: "},
+	}
+	for _, tt := range tests {
+		changed := strings.Replace(string(signed), tt.from, tt.to, 1)
+		if changed == string(signed) {
+			t.Fatalf("%s: %q isn't in the message", tt.name, tt.from)
+		}
+		if err := verify([]byte(changed), txt); err != nil {
+			t.Errorf("%s: signature no longer verifies: %v", tt.name, err)
+		}
+	}
+}
+
+func TestSignatureCatchesTampering(t *testing.T) {
+	key, txt := testKey(t)
+	signed, err := Sign([]byte(message), "temp.example", "sel", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, from, to string
+	}{
+		{"body", "see you soon", "send money"},
+		{"subject", "that wraps", "that changed"},
+		{"sender", "someone@temp.example", "ceo@temp.example"},
+		// The last From is the one signed, so one added below takes its place
+		{"added From", "Message-ID: <abc@temp.example>\r\n", "Message-ID: <abc@temp.example>\r\nFrom: ceo@temp.example\r\n"},
+	}
+	for _, tt := range tests {
+		changed := strings.Replace(string(signed), tt.from, tt.to, 1)
+		if err := verify([]byte(changed), txt); err == nil {
+			t.Errorf("%s changed, but the signature still verifies", tt.name)
+		}
+	}
+
+	_, otherTXT := testKey(t)
+	if err := verify(signed, otherTXT); err == nil {
+		t.Error("signature verifies against another key")
+	}
+}
+
+func TestSignEmptyBody(t *testing.T) {
+	key, txt := testKey(t)
+
+	signed, err := Sign([]byte("From: someone@temp.example\r\nSubject: Hi\r\n\r\n"), "temp.example", "sel", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(signed, txt); err != nil {
+		t.Errorf("signature doesn't verify: %v", err)
+	}
+}
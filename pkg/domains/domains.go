@@ -0,0 +1,97 @@
+package domains
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/util"
+)
+
+// DefaultPool is the pool new domains join unless told otherwise
+const DefaultPool = "default"
+
+// ErrNoDomains is returned when a pool has no enabled domains
+var ErrNoDomains = errors.New("no receiving domains are enabled")
+
+// ErrUnknownDomain is returned when a requested domain isn't enabled
+var ErrUnknownDomain = errors.New("that domain isn't available")
+
+// Normalize lowercases a domain and strips any leading "@"
+func Normalize(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "@"))
+}
+
+// Seed makes sure the DOMAIN environment variable is registered as a
+// receiving domain, and assigns it to addresses created before domains were
+// tracked
+func Seed(stores store.Stores) {
+	name := Normalize(os.Getenv("DOMAIN"))
+	if name == "" {
+		return
+	}
+
+	domain, err := stores.Domains.Get(name)
+	if err == store.ErrNotFound {
+		err = stores.Domains.Create(&db.Domain{
+			Name:      name,
+			CreatedAt: time.Now(),
+			Pool:      DefaultPool,
+			Enabled:   true,
+			Verified:  true,
+		})
+	} else if err == nil && !domain.Verified {
+		// The configured domain is trusted without a DNS check
+		domain.Verified = true
+		err = stores.Domains.Save(&domain)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to register domain %s: %v", name, err)
+	}
+
+	if err := stores.Addresses.AssignDomain(name); err != nil {
+		log.Printf("ERROR: Failed to assign domain %s to older addresses: %v", name, err)
+	}
+}
+
+// Enabled reports whether mail for a domain should be accepted
+func Enabled(domains store.DomainStore, name string) bool {
+	domain, err := domains.Get(Normalize(name))
+
+	return err == nil && domain.Enabled && domain.Verified
+}
+
+// Pick chooses the domain for a new address: the named one if given, or else
+// a random enabled domain from the pool (DOMAIN_POOL, or DefaultPool if
+// that isn't set either)
+func Pick(domains store.DomainStore, name, pool string) (string, error) {
+	if name != "" {
+		name = Normalize(name)
+		if !Enabled(domains, name) {
+			return "", ErrUnknownDomain
+		}
+
+		return name, nil
+	}
+
+	if pool == "" {
+		pool = os.Getenv("DOMAIN_POOL")
+	}
+	if pool == "" {
+		pool = DefaultPool
+	}
+
+	candidates, err := domains.InPool(pool)
+	if err != nil {
+		return "", err
+	}
+	if len(candidates) == 0 {
+		return "", ErrNoDomains
+	}
+
+	return candidates[util.RandomInt(len(candidates))].Name, nil
+}
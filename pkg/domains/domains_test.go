@@ -0,0 +1,34 @@
+package domains
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+func TestSeedRegistersConfiguredDomain(t *testing.T) {
+	t.Setenv("DOMAIN", "Temp.Example")
+	stores := store.Memory()
+
+	legacy := db.Address{ID: "legacy", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := stores.Addresses.Save(&legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	Seed(stores)
+
+	if !Enabled(stores.Domains, "temp.example") {
+		t.Error("DOMAIN not enabled after Seed")
+	}
+	if picked, err := Pick(stores.Domains, "", ""); err != nil || picked != "temp.example" {
+		t.Errorf("Pick from the default pool = %q, %v; want temp.example", picked, err)
+	}
+	if address, _ := stores.Addresses.Get("legacy"); address.Domain != "temp.example" {
+		t.Errorf("older address got domain %q, want temp.example", address.Domain)
+	}
+	if _, err := Pick(stores.Domains, "", "elsewhere"); err != ErrNoDomains {
+		t.Errorf("Pick from an empty pool = %v, want ErrNoDomains", err)
+	}
+}
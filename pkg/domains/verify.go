@@ -0,0 +1,228 @@
+package domains
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/dkim"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/util"
+)
+
+// How long a single verification run may spend on DNS lookups
+const verifyTimeout = 10 * time.Second
+
+// Resolver is the subset of *net.Resolver used for verification, so a stub
+// can stand in for real DNS
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+var (
+	defaultResolver     Resolver
+	defaultResolverOnce sync.Once
+)
+
+// DefaultResolver queries DNS_RESOLVER (host:port) if set, and the system
+// resolver otherwise. It's built on first use, after .env has been loaded.
+func DefaultResolver() Resolver {
+	defaultResolverOnce.Do(func() {
+		defaultResolver = NewResolver(os.Getenv("DNS_RESOLVER"))
+	})
+
+	return defaultResolver
+}
+
+// NewResolver returns a resolver that sends every query to server, or the
+// system resolver if server is empty
+func NewResolver(server string) Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// Record is a DNS record a domain owner needs to publish
+type Record struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// Check is the outcome of looking up one Record
+type Check struct {
+	Record
+	OK    bool     `json:"ok"`
+	Found []string `json:"found"`
+	Error string   `json:"error,omitempty"`
+}
+
+// MXHost is the host custom domains should point their MX records at, set
+// with MX_HOST (default mail.$DOMAIN)
+func MXHost() string {
+	if host := os.Getenv("MX_HOST"); host != "" {
+		return Normalize(host)
+	}
+
+	return "mail." + Normalize(os.Getenv("DOMAIN"))
+}
+
+// NewVerificationToken returns a token for a domain's verification record
+func NewVerificationToken() string {
+	return util.RandomString("abcdefghijklmnopqrstuvwxyz0123456789", 32)
+}
+
+// Records lists the DNS records a domain needs before it can be verified
+func Records(domain db.Domain) []Record {
+	return []Record{
+		{Type: "MX", Name: domain.Name, Value: MXHost(), Priority: 10},
+		{Type: "TXT", Name: domain.Name, Value: "v=spf1 mx ~all"},
+		{Type: "TXT", Name: "_temp-email." + domain.Name, Value: "temp-email-verification=" + domain.VerificationToken},
+	}
+}
+
+// DKIMRecord returns the record publishing a domain's DKIM key, if it has
+// one. It isn't needed to receive mail, so verification doesn't check it.
+func DKIMRecord(domain db.Domain) (Record, bool) {
+	if domain.DKIMPrivateKey == "" {
+		return Record{}, false
+	}
+
+	key, err := dkim.ParseKey(domain.DKIMPrivateKey)
+	if err != nil {
+		return Record{}, false
+	}
+	value, err := dkim.TXTRecord(key)
+	if err != nil {
+		return Record{}, false
+	}
+
+	return Record{Type: "TXT", Name: domain.DKIMSelector + "._domainkey." + domain.Name, Value: value}, true
+}
+
+// Verify looks up each of a domain's required records, reporting whether all
+// of them are in place
+func Verify(ctx context.Context, r Resolver, domain db.Domain) ([]Check, bool) {
+	records := Records(domain)
+	checks := make([]Check, len(records))
+	verified := true
+
+	for i, record := range records {
+		check := Check{Record: record}
+
+		switch record.Type {
+		case "MX":
+			mxs, err := r.LookupMX(ctx, record.Name)
+			if err != nil {
+				check.Error = err.Error()
+			}
+			for _, mx := range mxs {
+				host := Normalize(strings.TrimSuffix(mx.Host, "."))
+				check.Found = append(check.Found, fmt.Sprintf("%d %s", mx.Pref, host))
+				if host == record.Value {
+					check.OK = true
+				}
+			}
+		case "TXT":
+			txts, err := r.LookupTXT(ctx, record.Name)
+			if err != nil {
+				check.Error = err.Error()
+			}
+			for _, txt := range txts {
+				check.Found = append(check.Found, txt)
+				if txtMatches(record.Value, txt) {
+					check.OK = true
+				}
+			}
+		}
+
+		verified = verified && check.OK
+		checks[i] = check
+	}
+
+	return checks, verified
+}
+
+// txtMatches compares TXT records, accepting any SPF record that authorizes
+// the domain's MX hosts in place of the exact suggested one
+func txtMatches(want, got string) bool {
+	got = strings.Join(strings.Fields(got), " ")
+	if strings.EqualFold(got, want) {
+		return true
+	}
+
+	if strings.HasPrefix(want, "v=spf1") && strings.HasPrefix(strings.ToLower(got), "v=spf1 ") {
+		for _, mechanism := range strings.Fields(strings.ToLower(got))[1:] {
+			if mechanism == "mx" || mechanism == "+mx" || mechanism == "a:"+MXHost() || mechanism == "include:"+MXHost() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// CheckAndSave verifies a domain and records the outcome, enabling the domain the
+// first time verification passes
+func CheckAndSave(domains store.DomainStore, r Resolver, domain *db.Domain) []Check {
+	if domain.VerificationToken == "" {
+		domain.VerificationToken = NewVerificationToken()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	checks, verified := Verify(ctx, r, *domain)
+
+	now := time.Now()
+	domain.LastCheckedAt = &now
+	domain.LastCheckError = ""
+	for _, check := range checks {
+		if !check.OK {
+			domain.LastCheckError = fmt.Sprintf("%s record for %s not found", check.Type, check.Name)
+			break
+		}
+	}
+
+	if verified && !domain.Verified {
+		domain.Verified = true
+		domain.VerifiedAt = &now
+		domain.Enabled = true
+		log.Printf("SUCCESS: Domain %s verified and enabled", domain.Name)
+	}
+
+	if err := domains.Save(domain); err != nil {
+		log.Printf("ERROR: Failed to save verification result for %s: %v", domain.Name, err)
+	}
+
+	return checks
+}
+
+// VerifyPending checks every domain still waiting on verification
+func VerifyPending(domains store.DomainStore, r Resolver) {
+	pending, err := domains.Unverified()
+	if err != nil {
+		log.Printf("ERROR: Failed to load unverified domains: %v", err)
+		return
+	}
+
+	for i := range pending {
+		CheckAndSave(domains, r, &pending[i])
+	}
+}
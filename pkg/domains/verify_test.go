@@ -0,0 +1,128 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+// stubResolver answers from fixed records instead of DNS
+type stubResolver struct {
+	mx  map[string][]*net.MX
+	txt map[string][]string
+}
+
+var errNoSuchHost = errors.New("no such host")
+
+func (r stubResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if mxs, ok := r.mx[name]; ok {
+		return mxs, nil
+	}
+	return nil, errNoSuchHost
+}
+
+func (r stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if txts, ok := r.txt[name]; ok {
+		return txts, nil
+	}
+	return nil, errNoSuchHost
+}
+
+func publishedFor(domain db.Domain) stubResolver {
+	return stubResolver{
+		mx: map[string][]*net.MX{
+			domain.Name: {{Host: "MAIL.Temp.Example.", Pref: 10}},
+		},
+		txt: map[string][]string{
+			domain.Name:                           {"google-site-verification=abc", "v=spf1 include:_spf.google.com mx -all"},
+			"_temp-email." + domain.Name:          {"temp-email-verification=" + domain.VerificationToken},
+			"unrelated._domainkey." + domain.Name: {"v=DKIM1; p=abc"},
+		},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Setenv("MX_HOST", "mail.temp.example")
+	domain := db.Domain{Name: "custom.example", VerificationToken: "tok123"}
+
+	checks, ok := Verify(context.Background(), publishedFor(domain), domain)
+	if !ok {
+		t.Fatalf("verification failed with every record published: %+v", checks)
+	}
+
+	// Each record missing on its own fails verification on that record only
+	for _, missing := range []string{"MX", "SPF", "token"} {
+		r := publishedFor(domain)
+		switch missing {
+		case "MX":
+			r.mx[domain.Name] = []*net.MX{{Host: "mx.elsewhere.example.", Pref: 10}}
+		case "SPF":
+			r.txt[domain.Name] = []string{"v=spf1 include:_spf.google.com -all"}
+		case "token":
+			delete(r.txt, "_temp-email."+domain.Name)
+		}
+
+		checks, ok := Verify(context.Background(), r, domain)
+		if ok {
+			t.Errorf("verification passed without the %s record", missing)
+		}
+
+		failed := 0
+		for _, check := range checks {
+			if !check.OK {
+				failed++
+			}
+		}
+		if failed != 1 {
+			t.Errorf("without the %s record, %d checks failed, want 1: %+v", missing, failed, checks)
+		}
+	}
+}
+
+func TestCheckAndSaveEnablesVerifiedDomain(t *testing.T) {
+	t.Setenv("MX_HOST", "mail.temp.example")
+	domains := store.NewMemoryDomains()
+
+	domain := db.Domain{Name: "custom.example", Pool: "custom"}
+	if err := domains.Create(&domain); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first check hands out a token, which isn't published yet
+	CheckAndSave(domains, stubResolver{}, &domain)
+	if domain.Verified || domain.Enabled || domain.LastCheckError == "" {
+		t.Fatalf("domain verified without records: %+v", domain)
+	}
+	if Enabled(domains, domain.Name) {
+		t.Fatal("unverified domain reported enabled")
+	}
+
+	CheckAndSave(domains, publishedFor(domain), &domain)
+	saved, err := domains.Get(domain.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.Verified || !saved.Enabled || saved.VerifiedAt == nil || saved.LastCheckError != "" {
+		t.Fatalf("domain not verified and enabled once records were published: %+v", saved)
+	}
+
+	if !Enabled(domains, "@Custom.Example") {
+		t.Error("verified domain not reported enabled")
+	}
+	if picked, err := Pick(domains, "", "custom"); err != nil || picked != domain.Name {
+		t.Errorf("Pick from its pool = %q, %v; want %q", picked, err, domain.Name)
+	}
+}
+
+func TestDefaultResolverReadsEnvOnFirstUse(t *testing.T) {
+	// Set after the package has loaded, as godotenv.Load does
+	t.Setenv("DNS_RESOLVER", "127.0.0.1:5353")
+
+	if DefaultResolver() == net.DefaultResolver {
+		t.Fatal("DNS_RESOLVER set before first use was ignored")
+	}
+}
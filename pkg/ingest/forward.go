@@ -0,0 +1,194 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/outbound"
+	"github.com/cjdenio/temp-email/pkg/srs"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/util"
+)
+
+// ForwardedHeader is added to every forwarded message, naming the address it
+// was forwarded from, so forwarding loops can be spotted
+const ForwardedHeader = "X-Temp-Email-Forwarded"
+
+// Messages already forwarded this many times aren't forwarded again
+const maxForwardHops = 3
+
+const tokenAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// relay picks the transport forwards go out through; tests can swap in a
+// local stand-in
+var relay = outbound.FromEnv
+
+// ErrForwardingDisabled is returned when the relay or SRS secret isn't set
+var ErrForwardingDisabled = errors.New("forwarding needs SMTP_RELAY_ADDR and SRS_SECRET to be set")
+
+// ErrNotBounce is returned by BounceRecipient for ordinary recipients
+var ErrNotBounce = errors.New("not an SRS address")
+
+func forwarding() (outbound.Transport, string, error) {
+	transport := relay()
+	secret := os.Getenv("SRS_SECRET")
+	if transport == nil || secret == "" {
+		return nil, "", ErrForwardingDisabled
+	}
+
+	return transport, secret, nil
+}
+
+// forwardLoops reports whether forwarding content from address would loop:
+// it has already passed through address, or through too many others
+func forwardLoops(content string, address db.Address) bool {
+	msg, err := mail.ReadMessage(strings.NewReader(content))
+	if err != nil {
+		return false
+	}
+
+	hops := msg.Header[textproto.CanonicalMIMEHeaderKey(ForwardedHeader)]
+	if len(hops) >= maxForwardHops {
+		return true
+	}
+
+	self := address.ID + "@" + address.Domain
+	for _, hop := range hops {
+		if strings.EqualFold(strings.TrimSpace(hop), self) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Forward re-sends an email to each confirmed forward destination of its
+// address. The envelope sender is rewritten with SRS so the relay passes SPF,
+// and bounces, which come from the null sender, are passed on with it.
+func Forward(forwards store.ForwardStore, address db.Address, email db.Email) {
+	rules, err := forwards.Confirmed(address.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load forward rules for %s: %v", address.ID, err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	transport, secret, err := forwarding()
+	if err != nil {
+		log.Printf("ERROR: Not forwarding email %s for %s: %v", email.ID, address.ID, err)
+		return
+	}
+
+	if forwardLoops(email.Content, address) {
+		log.Printf("REJECT: Not forwarding email %s for %s, it has already been forwarded here", email.ID, address.ID)
+		return
+	}
+
+	self := address.ID + "@" + address.Domain
+	from := srs.Forward(secret, email.EnvelopeFrom, address.Domain)
+	message := []byte(ForwardedHeader + ": " + self + "\r\n" + email.Content)
+
+	for _, rule := range rules {
+		if err := transport.Send(from, []string{rule.Destination}, message); err != nil {
+			log.Printf("ERROR: Failed to forward email %s for %s to %s: %v", email.ID, address.ID, rule.Destination, err)
+			continue
+		}
+
+		log.Printf("SUCCESS: Forwarded email %s for %s to %s", email.ID, address.ID, rule.Destination)
+	}
+}
+
+// AddForward creates an unconfirmed forward rule and emails its destination
+// a link to confirm it. Nothing is forwarded until it's confirmed from the
+// page that link opens.
+func AddForward(forwards store.ForwardStore, address db.Address, destination string) (db.ForwardRule, error) {
+	rule := db.ForwardRule{
+		CreatedAt:    time.Now(),
+		AddressID:    address.ID,
+		Destination:  destination,
+		ConfirmToken: util.RandomString(tokenAlphabet, 32),
+	}
+
+	transport, _, err := forwarding()
+	if err != nil {
+		return rule, err
+	}
+
+	if err := forwards.Create(&rule); err != nil {
+		return rule, err
+	}
+
+	from := "forwarding@" + address.Domain
+	message := fmt.Sprintf(
+		"From: temp-email <%s>\r\nTo: <%s>\r\nSubject: Confirm forwarding from %s@%s\r\nDate: %s\r\nMessage-ID: <%s@%s>\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n"+
+			"Someone asked for mail sent to %s@%s to be forwarded to this address.\r\n\r\n"+
+			"To start receiving it, open this link and press Confirm:\r\n%s/forward/confirm/%s\r\n\r\n"+
+			"If you weren't expecting this, ignore this email and nothing will be forwarded.\r\n",
+		from, destination, address.ID, address.Domain,
+		time.Now().Format(time.RFC1123Z),
+		util.GenerateEmailID(), address.Domain,
+		address.ID, address.Domain,
+		os.Getenv("APP_DOMAIN"), rule.ConfirmToken,
+	)
+
+	if err := transport.Send(from, []string{destination}, []byte(message)); err != nil {
+		forwards.Delete(rule.AddressID, rule.ID)
+		return rule, fmt.Errorf("couldn't send the confirmation email: %w", err)
+	}
+
+	return rule, nil
+}
+
+// ConfirmForward confirms the forward rule a confirmation link was sent for
+func ConfirmForward(forwards store.ForwardStore, token string) (db.ForwardRule, error) {
+	rule, err := forwards.FindByToken(token)
+	if err != nil {
+		return rule, err
+	}
+
+	if rule.ConfirmedAt == nil {
+		now := time.Now()
+		rule.ConfirmedAt = &now
+		if err := forwards.Save(&rule); err != nil {
+			return rule, err
+		}
+	}
+
+	return rule, nil
+}
+
+// BounceRecipient returns the original sender behind an SRS address that
+// forwarded mail bounced back to, or ErrNotBounce for any other recipient
+func BounceRecipient(recipient string) (string, error) {
+	recipient = strings.Trim(strings.TrimSpace(recipient), "<>")
+	if !srs.IsSRS(recipient) {
+		return "", ErrNotBounce
+	}
+
+	_, secret, err := forwarding()
+	if err != nil {
+		return "", err
+	}
+
+	return srs.Reverse(secret, recipient)
+}
+
+// RelayBounce passes a bounce for forwarded mail on to the original sender
+func RelayBounce(to string, message []byte) error {
+	transport, _, err := forwarding()
+	if err != nil {
+		return err
+	}
+
+	// Bounces are sent with the null sender so they can't bounce again
+	return transport.Send("", []string{to}, message)
+}
@@ -0,0 +1,198 @@
+package ingest
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/outbound"
+	"github.com/cjdenio/temp-email/pkg/srs"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+// sent is one message handed to the stand-in relay
+type sent struct {
+	From    string
+	To      []string
+	Message string
+}
+
+// fakeRelay records what it's asked to send instead of sending it
+type fakeRelay struct {
+	mu   sync.Mutex
+	sent []sent
+	err  error
+}
+
+func (f *fakeRelay) Send(from string, to []string, message []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, sent{From: from, To: to, Message: string(message)})
+	return nil
+}
+
+// useRelay sends forwards through a fresh fakeRelay for the rest of the test
+func useRelay(t *testing.T) *fakeRelay {
+	t.Setenv("SRS_SECRET", "srs-secret")
+
+	fake := &fakeRelay{}
+	previous := relay
+	relay = func() outbound.Transport { return fake }
+	t.Cleanup(func() { relay = previous })
+
+	return fake
+}
+
+var forwardingAddress = db.Address{ID: "inbox", Domain: "temp.example"}
+
+func TestForwardSendsToConfirmedDestinations(t *testing.T) {
+	fake := useRelay(t)
+	forwards := store.NewMemoryForwards()
+	now := time.Now()
+	forwards.Create(&db.ForwardRule{AddressID: "inbox", Destination: "me@real.example", ConfirmedAt: &now})
+	forwards.Create(&db.ForwardRule{AddressID: "inbox", Destination: "unconfirmed@real.example"})
+	forwards.Create(&db.ForwardRule{AddressID: "other", Destination: "other@real.example", ConfirmedAt: &now})
+
+	content := "From: a@shop.example\r\nSubject: Hi\r\n\r\nHello\r\n"
+	Forward(forwards, forwardingAddress, db.Email{ID: "abc", EnvelopeFrom: "bounces@esp.example", Sender: "a@shop.example", Content: content})
+
+	if len(fake.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1: %+v", len(fake.sent), fake.sent)
+	}
+	msg := fake.sent[0]
+	if len(msg.To) != 1 || msg.To[0] != "me@real.example" {
+		t.Errorf("sent to %v, want only the confirmed destination", msg.To)
+	}
+	if !srs.IsSRS(msg.From) || !strings.HasSuffix(msg.From, "@temp.example") {
+		t.Errorf("envelope sender = %q, want an SRS address at temp.example", msg.From)
+	}
+	// Bounces go back to the envelope sender, not whoever's in From
+	if original, err := srs.Reverse("srs-secret", msg.From); err != nil || original != "bounces@esp.example" {
+		t.Errorf("envelope sender reverses to %q, %v; want bounces@esp.example", original, err)
+	}
+	if want := ForwardedHeader + ": inbox@temp.example\r\n" + content; msg.Message != want {
+		t.Errorf("message = %q, want %q", msg.Message, want)
+	}
+}
+
+func TestForwardRewritesEnvelopeSender(t *testing.T) {
+	first := srs.Forward("other-secret", "a@shop.example", "forwarder.example")
+
+	tests := []struct {
+		name, envelopeFrom string
+		check              func(from string) bool
+	}{
+		{"null sender", "", func(from string) bool { return from == "" }},
+		{"already forwarded", first, func(from string) bool {
+			original, err := srs.Reverse("srs-secret", from)
+			return strings.HasPrefix(from, "SRS1=") && strings.HasSuffix(from, "@temp.example") &&
+				!strings.Contains(from, "SRS0=") && err == nil && original == first
+		}},
+	}
+	for _, tt := range tests {
+		fake := useRelay(t)
+		forwards := store.NewMemoryForwards()
+		now := time.Now()
+		forwards.Create(&db.ForwardRule{AddressID: "inbox", Destination: "me@real.example", ConfirmedAt: &now})
+
+		content := "From: postmaster@shop.example\r\nSubject: Undeliverable\r\n\r\nSorry\r\n"
+		Forward(forwards, forwardingAddress, db.Email{ID: "abc", EnvelopeFrom: tt.envelopeFrom, Sender: "postmaster@shop.example", Content: content})
+
+		if len(fake.sent) != 1 {
+			t.Fatalf("%s: sent %d messages, want 1", tt.name, len(fake.sent))
+		}
+		if from := fake.sent[0].From; !tt.check(from) {
+			t.Errorf("%s: envelope sender %q forwarded as %q", tt.name, tt.envelopeFrom, from)
+		}
+	}
+}
+
+func TestForwardSkipsLoops(t *testing.T) {
+	fake := useRelay(t)
+	forwards := store.NewMemoryForwards()
+	now := time.Now()
+	forwards.Create(&db.ForwardRule{AddressID: "inbox", Destination: "me@real.example", ConfirmedAt: &now})
+
+	content := ForwardedHeader + ": inbox@temp.example\r\nFrom: a@shop.example\r\n\r\nHello\r\n"
+	Forward(forwards, forwardingAddress, db.Email{ID: "abc", Sender: "a@shop.example", Content: content})
+
+	if len(fake.sent) != 0 {
+		t.Errorf("forwarded a message that had already passed through: %+v", fake.sent)
+	}
+}
+
+func TestAddForwardNeedsConfirming(t *testing.T) {
+	fake := useRelay(t)
+	forwards := store.NewMemoryForwards()
+
+	rule, err := AddForward(forwards, forwardingAddress, "me@real.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.ConfirmedAt != nil || rule.ConfirmToken == "" {
+		t.Errorf("new rule = %+v, want it unconfirmed with a token", rule)
+	}
+
+	if len(fake.sent) != 1 || fake.sent[0].To[0] != "me@real.example" || !strings.Contains(fake.sent[0].Message, "/forward/confirm/"+rule.ConfirmToken) {
+		t.Fatalf("confirmation = %+v, want a link with the token sent to the destination", fake.sent)
+	}
+	if confirmed, _ := forwards.Confirmed("inbox"); len(confirmed) != 0 {
+		t.Errorf("rule is confirmed before the link was opened: %+v", confirmed)
+	}
+
+	if _, err := ConfirmForward(forwards, rule.ConfirmToken); err != nil {
+		t.Fatal(err)
+	}
+	if confirmed, _ := forwards.Confirmed("inbox"); len(confirmed) != 1 {
+		t.Errorf("rule isn't confirmed after the link was opened")
+	}
+}
+
+func TestAddForwardDropsRuleWhenConfirmationFails(t *testing.T) {
+	fake := useRelay(t)
+	fake.err = errors.New("relay down")
+	forwards := store.NewMemoryForwards()
+
+	if _, err := AddForward(forwards, forwardingAddress, "me@real.example"); err == nil {
+		t.Fatal("AddForward succeeded with the relay down")
+	}
+	if rules, _ := forwards.List("inbox"); len(rules) != 0 {
+		t.Errorf("rules left = %+v, want none", rules)
+	}
+}
+
+func TestForwardingNeedsRelayAndSecret(t *testing.T) {
+	useRelay(t)
+	t.Setenv("SRS_SECRET", "")
+
+	if _, err := AddForward(store.NewMemoryForwards(), forwardingAddress, "me@real.example"); err != ErrForwardingDisabled {
+		t.Errorf("AddForward without SRS_SECRET = %v, want ErrForwardingDisabled", err)
+	}
+}
+
+func TestBouncesReachTheOriginalSender(t *testing.T) {
+	fake := useRelay(t)
+
+	bounce := srs.Forward("srs-secret", "a@shop.example", "temp.example")
+	original, err := BounceRecipient("<" + bounce + ">")
+	if err != nil || original != "a@shop.example" {
+		t.Fatalf("BounceRecipient = %q, %v", original, err)
+	}
+	if _, err := BounceRecipient("inbox@temp.example"); err != ErrNotBounce {
+		t.Errorf("BounceRecipient of an ordinary address = %v, want ErrNotBounce", err)
+	}
+
+	if err := RelayBounce(original, []byte("Subject: Undeliverable\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.sent) != 1 || fake.sent[0].From != "" || fake.sent[0].To[0] != "a@shop.example" {
+		t.Errorf("bounce relayed as %+v, want from the null sender to a@shop.example", fake.sent)
+	}
+}
@@ -0,0 +1,178 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/domains"
+	"github.com/cjdenio/temp-email/pkg/notify"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/threading"
+	"github.com/cjdenio/temp-email/pkg/util"
+	"github.com/cjdenio/temp-email/pkg/webhooks"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+)
+
+// Markdown converts an HTML email body to Slack mrkdwn
+func Markdown(html string) (string, error) {
+	converter := md.NewConverter("", true, &md.Options{
+		StrongDelimiter: "*",
+		EmDelimiter:     "_",
+	})
+
+	converter.AddRules(
+		md.Rule{
+			Filter: []string{"a"},
+			Replacement: func(content string, selec *goquery.Selection, options *md.Options) *string {
+				return md.String(fmt.Sprintf("<%s|%s>", selec.AttrOr("href", content), content))
+			},
+		},
+		md.Rule{
+			Filter: []string{"h1", "h2", "h3", "h4", "h5", "h6"},
+			Replacement: func(content string, selec *goquery.Selection, options *md.Options) *string {
+				return md.String("\n\n*" + content + "*\n\n")
+			},
+		},
+		md.Rule{
+			Filter: []string{"img"},
+			Replacement: func(content string, selec *goquery.Selection, options *md.Options) *string {
+				return md.String("")
+			},
+		},
+	)
+
+	return converter.ConvertString(html)
+}
+
+// Longest tag kept from a plus-address
+const maxTagLength = 64
+
+// ErrInvalidRecipient is returned for a recipient without a local part and
+// domain
+var ErrInvalidRecipient = errors.New("invalid address")
+
+// ParseRecipient splits a recipient such as "abc123+signup@domain" into the
+// address ID ("abc123"), the plus-address tag ("signup") and the domain
+func ParseRecipient(recipient string) (id, tag, domain string, err error) {
+	recipient = strings.Trim(strings.TrimSpace(recipient), "<>")
+
+	at := strings.LastIndex(recipient, "@")
+	if at <= 0 || at == len(recipient)-1 {
+		return "", "", "", ErrInvalidRecipient
+	}
+
+	local := strings.ToLower(recipient[:at])
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local, tag = local[:plus], local[plus+1:]
+	}
+	if local == "" {
+		return "", "", "", ErrInvalidRecipient
+	}
+
+	return local, sanitizeTag(tag), domains.Normalize(recipient[at+1:]), nil
+}
+
+// FindAddress looks up the active address a recipient delivers to, matching
+// on both local part and domain. It returns store.ErrNotFound if there isn't
+// one or its domain is disabled.
+func FindAddress(stores store.Stores, recipient string) (address db.Address, tag string, err error) {
+	id, tag, domain, err := ParseRecipient(recipient)
+	if err != nil {
+		return address, "", err
+	}
+
+	if !domains.Enabled(stores.Domains, domain) {
+		return address, tag, store.ErrNotFound
+	}
+
+	address, err = stores.Addresses.FindActive(id, domain, time.Now())
+
+	return address, tag, err
+}
+
+// sanitizeTag keeps only characters that are safe to show and filter on
+func sanitizeTag(tag string) string {
+	var b strings.Builder
+	for _, r := range tag {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+
+	sanitized := b.String()
+	if len(sanitized) > maxTagLength {
+		sanitized = sanitized[:maxTagLength]
+	}
+
+	return sanitized
+}
+
+// SaveEmail stores a received email under a fresh ID, places it in a
+// conversation and indexes it for search
+func SaveEmail(stores store.Stores, email *db.Email) error {
+	if err := threading.Assign(stores.Emails, email); err != nil {
+		// Still keep the email, just as a conversation of its own
+		log.Printf("ERROR: Failed to thread email for %s: %v", email.AddressID, err)
+		email.ThreadID = util.GenerateEmailID()
+	}
+
+	if err := stores.Emails.Create(email, util.GenerateEmailID); err != nil {
+		return err
+	}
+
+	if err := stores.Search.Index(email.ID); err != nil {
+		log.Printf("ERROR: Failed to index email %s for search: %v", email.ID, err)
+	}
+
+	return nil
+}
+
+// SenderAddress extracts the bare address from a From header such as
+// "Stripe <receipts@stripe.com>"
+func SenderAddress(from string) string {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return strings.TrimSpace(from)
+	}
+
+	return addr.Address
+}
+
+// Notify tells the address's notifier and webhooks about a received email.
+// Quarantined mail is held back, except for a warning about viruses.
+func Notify(stores store.Stores, address db.Address, email db.Email, from, subject, body string) error {
+	if email.Quarantined && email.Virus == "" {
+		log.Printf("Quarantined email %s for %s (%s), not notifying", email.ID, address.ID, email.QuarantineReason)
+		return nil
+	}
+
+	if !email.Quarantined {
+		webhooks.Enqueue(stores.Webhooks, address, email)
+		go Forward(stores.Forwards, address, email)
+	}
+
+	received := notify.Received{
+		Email:   email,
+		From:    from,
+		Subject: subject,
+		Body:    body,
+	}
+	if thread, err := stores.Emails.Thread(address.ID, email.ThreadID); err == nil && len(thread) > 1 {
+		received.Conversation = thread[0].Subject
+		received.ConversationSize = len(thread)
+	}
+
+	err := notify.For(address).EmailReceived(address, received)
+	if err != nil {
+		log.Printf("ERROR: Failed to notify %s about email %s: %v", address.ID, email.ID, err)
+	}
+
+	return err
+}
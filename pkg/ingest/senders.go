@@ -0,0 +1,122 @@
+package ingest
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+// NormalizePattern lowercases a sender rule pattern, which is either an exact
+// address ("billing@stripe.com") or a domain ("stripe.com" or "@stripe.com")
+func NormalizePattern(pattern string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(pattern)), "@")
+}
+
+// MatchSender reports whether a sender matches a rule pattern. Domain
+// patterns also match subdomains.
+func MatchSender(pattern, sender string) bool {
+	pattern = NormalizePattern(pattern)
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	if pattern == "" || sender == "" {
+		return false
+	}
+
+	if strings.Contains(pattern, "@") {
+		return sender == pattern
+	}
+
+	domain := sender[strings.LastIndex(sender, "@")+1:]
+
+	return domain == pattern || strings.HasSuffix(domain, "."+pattern)
+}
+
+func senderRules(senders store.SenderStore, addressID string) []db.SenderRule {
+	rules, err := senders.Rules(addressID)
+	if err != nil {
+		log.Printf("ERROR: Failed to load sender rules for %s: %v", addressID, err)
+		return nil
+	}
+
+	return rules
+}
+
+// blockedBy returns the first block rule matching any of senders
+func blockedBy(rules []db.SenderRule, senders []string) (db.SenderRule, bool) {
+	for _, rule := range rules {
+		if rule.Allow {
+			continue
+		}
+		for _, sender := range senders {
+			if MatchSender(rule.Pattern, sender) {
+				return rule, true
+			}
+		}
+	}
+
+	return db.SenderRule{}, false
+}
+
+// SenderAllowed applies an address's sender rules to a message's sender
+// identities, usually the header From and the envelope sender. Mail is
+// blocked if any identity matches a block rule. If the address has allow
+// rules, at least one identity must match one of them, so mail from an ESP
+// with its own bounce domain passes on its From. Empty identities are
+// skipped. The reason is empty when the mail is allowed.
+func SenderAllowed(senders store.SenderStore, addressID string, identities ...string) (bool, string) {
+	rules := senderRules(senders, addressID)
+
+	if rule, blocked := blockedBy(rules, identities); blocked {
+		return false, fmt.Sprintf("blocked by rule %q", rule.Pattern)
+	}
+
+	hasAllow := false
+	for _, rule := range rules {
+		if !rule.Allow {
+			continue
+		}
+		hasAllow = true
+		for _, sender := range identities {
+			if MatchSender(rule.Pattern, sender) {
+				return true, ""
+			}
+		}
+	}
+
+	if hasAllow {
+		return false, "not on the allowlist"
+	}
+
+	return true, ""
+}
+
+// SenderBlocked applies only an address's block rules, for when just one of
+// a message's identities is known yet. Allow rules have to wait for the
+// rest, since another identity might match them.
+func SenderBlocked(senders store.SenderStore, addressID, sender string) (bool, string) {
+	if rule, blocked := blockedBy(senderRules(senders, addressID), []string{sender}); blocked {
+		return true, fmt.Sprintf("blocked by rule %q", rule.Pattern)
+	}
+
+	return false, ""
+}
+
+// LogBlocked records mail turned away by a sender rule so the owner can see
+// it in the dashboard
+func LogBlocked(senders store.SenderStore, addressID, sender, subject, reason string) {
+	log.Printf("REJECT: Mail from %s to %s %s", sender, addressID, reason)
+
+	err := senders.LogBlocked(&db.BlockedEmail{
+		CreatedAt: time.Now(),
+		AddressID: addressID,
+		Sender:    sender,
+		Subject:   subject,
+		Reason:    reason,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to log blocked mail for %s: %v", addressID, err)
+	}
+}
@@ -0,0 +1,67 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+func TestMatchSender(t *testing.T) {
+	cases := []struct {
+		pattern, sender string
+		want            bool
+	}{
+		{"billing@stripe.com", "Billing@Stripe.com", true},
+		{"billing@stripe.com", "support@stripe.com", false},
+		{"stripe.com", "receipts@stripe.com", true},
+		{"@stripe.com", "receipts@mail.stripe.com", true},
+		{"stripe.com", "receipts@notstripe.com", false},
+		{"stripe.com", "", false},
+	}
+
+	for _, c := range cases {
+		if got := MatchSender(c.pattern, c.sender); got != c.want {
+			t.Errorf("MatchSender(%q, %q) = %v, want %v", c.pattern, c.sender, got, c.want)
+		}
+	}
+}
+
+func TestSenderAllowedEitherIdentity(t *testing.T) {
+	senders := store.NewMemorySenders()
+	senders.AddRule(&db.SenderRule{AddressID: "allowlisted", Pattern: "stripe.com", Allow: true})
+	senders.AddRule(&db.SenderRule{AddressID: "allowlisted", Pattern: "bounces.stripe.com"})
+	senders.AddRule(&db.SenderRule{AddressID: "blocklisted", Pattern: "sendgrid.net"})
+
+	cases := []struct {
+		address        string
+		from, envelope string
+		want           bool
+	}{
+		// An ESP bounce domain on the envelope doesn't stop an allowed From
+		{"allowlisted", "receipts@stripe.com", "bounce-123@sendgrid.net", true},
+		{"allowlisted", "spam@example.com", "bounce@stripe-mailer.com", false},
+		// Nor does an allowed envelope sender need a matching From
+		{"allowlisted", "Stripe <news@example.com>", "news@stripe.com", true},
+		// A block rule on either identity still wins
+		{"allowlisted", "receipts@stripe.com", "x@bounces.stripe.com", false},
+		{"blocklisted", "hello@shop.example", "bounce-1@sendgrid.net", false},
+		{"blocklisted", "promo@sendgrid.net", "", false},
+		{"blocklisted", "hello@shop.example", "bounce@shop.example", true},
+		{"norules", "anyone@example.com", "", true},
+	}
+
+	for _, c := range cases {
+		if got, reason := SenderAllowed(senders, c.address, SenderAddress(c.from), c.envelope); got != c.want {
+			t.Errorf("SenderAllowed(%s, %q, %q) = %v (%s), want %v", c.address, c.from, c.envelope, got, reason, c.want)
+		}
+	}
+
+	// At RCPT time only block rules apply
+	if blocked, _ := SenderBlocked(senders, "allowlisted", "bounce-123@sendgrid.net"); blocked {
+		t.Error("envelope sender not on the allowlist was blocked before the From header was seen")
+	}
+	if blocked, _ := SenderBlocked(senders, "blocklisted", "bounce-1@sendgrid.net"); !blocked {
+		t.Error("blocked envelope sender got past RCPT")
+	}
+}
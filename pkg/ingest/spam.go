@@ -0,0 +1,46 @@
+package ingest
+
+import (
+	"log"
+	"strings"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/spam"
+)
+
+// spamChecker picks the checker for each message; tests can swap in a stub
+var spamChecker = spam.FromEnv
+
+// ScoreSpam runs the configured spam checker over an email's content and
+// records the verdict on it. It returns the action to take; the caller
+// rejects the message for spam.ActionReject. If the checker can't be reached
+// the message is let through.
+func ScoreSpam(email *db.Email) string {
+	checker := spamChecker()
+	if checker == nil {
+		return spam.ActionNone
+	}
+
+	result, err := checker.Check([]byte(email.Content))
+	if err != nil {
+		log.Printf("ERROR: Spam check failed for mail to %s, accepting it: %v", email.AddressID, err)
+		return spam.ActionNone
+	}
+
+	action := spam.Action(result.Score)
+
+	email.SpamScore = result.Score
+	email.SpamSymbols = strings.Join(result.Symbols, ",")
+	switch action {
+	case spam.ActionTag:
+		email.Spam = true
+	case spam.ActionQuarantine:
+		email.Spam = true
+		email.Quarantined = true
+		email.QuarantineReason = "spam"
+	case spam.ActionReject:
+		log.Printf("REJECT: Mail to %s scored %.1f as spam (%s)", email.AddressID, result.Score, email.SpamSymbols)
+	}
+
+	return action
+}
@@ -0,0 +1,190 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/spam"
+)
+
+// fakeSpamd answers SYMBOLS requests like spamd, scoring each message by
+// the number in its "X-Test-Score" header
+func fakeSpamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+
+				length := 0
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimSpace(line)
+					if line == "" {
+						break
+					}
+					if strings.HasPrefix(strings.ToLower(line), "content-length:") {
+						length, _ = strconv.Atoi(strings.TrimSpace(line[len("content-length:"):]))
+					}
+				}
+
+				body := make([]byte, length)
+				if _, err := io.ReadFull(r, body); err != nil {
+					return
+				}
+
+				score := "0.0"
+				for _, line := range strings.Split(string(body), "\r\n") {
+					if strings.HasPrefix(line, "X-Test-Score: ") {
+						score = strings.TrimPrefix(line, "X-Test-Score: ")
+					}
+				}
+
+				fmt.Fprintf(conn, "SPAMD/1.1 0 EX_OK\r\nContent-length: 20\r\nSpam: True ; %s / 5.0\r\n\r\nBAYES_99,URIBL_BLACK", score)
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// unusedAddr returns an address nothing is listening on
+func unusedAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	return addr
+}
+
+func scoredEmail(score string) *db.Email {
+	return &db.Email{
+		AddressID: "abc",
+		Content:   "From: a@example.com\r\nX-Test-Score: " + score + "\r\nSubject: hi\r\n\r\nbody\r\n",
+	}
+}
+
+func setThresholds(t *testing.T) {
+	t.Setenv("SPAM_TAG_SCORE", "5")
+	t.Setenv("SPAM_QUARANTINE_SCORE", "10")
+	t.Setenv("SPAM_REJECT_SCORE", "20")
+}
+
+func TestScoreSpamThresholds(t *testing.T) {
+	setThresholds(t)
+	t.Setenv("SPAM_CHECKER", "spamd")
+	t.Setenv("SPAMD_ADDR", fakeSpamd(t))
+
+	cases := []struct {
+		score       string
+		action      string
+		spam        bool
+		quarantined bool
+	}{
+		{"1.5", spam.ActionNone, false, false},
+		{"5.0", spam.ActionTag, true, false},
+		{"12.3", spam.ActionQuarantine, true, true},
+		{"25", spam.ActionReject, false, false},
+	}
+
+	for _, c := range cases {
+		email := scoredEmail(c.score)
+		action := ScoreSpam(email)
+
+		if action != c.action {
+			t.Errorf("score %s: action %q, want %q", c.score, action, c.action)
+		}
+		if email.Spam != c.spam || email.Quarantined != c.quarantined {
+			t.Errorf("score %s: spam=%v quarantined=%v, want %v %v", c.score, email.Spam, email.Quarantined, c.spam, c.quarantined)
+		}
+		if c.quarantined && email.QuarantineReason != "spam" {
+			t.Errorf("score %s: quarantine reason %q, want spam", c.score, email.QuarantineReason)
+		}
+		if want, _ := strconv.ParseFloat(c.score, 64); email.SpamScore != want {
+			t.Errorf("score %s: recorded score %v", c.score, email.SpamScore)
+		}
+		if email.SpamSymbols != "BAYES_99,URIBL_BLACK" {
+			t.Errorf("score %s: symbols %q", c.score, email.SpamSymbols)
+		}
+	}
+}
+
+func TestScoreSpamRspamd(t *testing.T) {
+	setThresholds(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/checkv2" || r.Header.Get("Password") != "secret" {
+			http.Error(w, "unauthorized", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"score": 11.5, "symbols": {"R_SPF_FAIL": {"score": 1}, "BAYES_SPAM": {"score": 5}}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("SPAM_CHECKER", "rspamd")
+	t.Setenv("RSPAMD_URL", server.URL)
+	t.Setenv("RSPAMD_PASSWORD", "secret")
+
+	email := scoredEmail("0")
+	if action := ScoreSpam(email); action != spam.ActionQuarantine || !email.Quarantined {
+		t.Fatalf("action %q, quarantined %v; want quarantine", action, email.Quarantined)
+	}
+	if email.SpamSymbols != "BAYES_SPAM,R_SPF_FAIL" {
+		t.Errorf("symbols %q", email.SpamSymbols)
+	}
+
+	// A rejected request is a failed check, so the mail is let through
+	t.Setenv("RSPAMD_PASSWORD", "wrong")
+	email = scoredEmail("0")
+	if action := ScoreSpam(email); action != spam.ActionNone || email.Spam {
+		t.Errorf("failed check gave action %q, spam %v", action, email.Spam)
+	}
+}
+
+func TestScoreSpamUnreachable(t *testing.T) {
+	setThresholds(t)
+	t.Setenv("SPAM_CHECKER", "spamd")
+	t.Setenv("SPAMD_ADDR", unusedAddr(t))
+	t.Setenv("SPAM_TIMEOUT_SECONDS", "1")
+
+	email := scoredEmail("25")
+	if action := ScoreSpam(email); action != spam.ActionNone {
+		t.Errorf("unreachable spamd gave action %q, want mail accepted", action)
+	}
+	if email.Spam || email.Quarantined || email.SpamScore != 0 {
+		t.Errorf("unreachable spamd marked the mail: %+v", email)
+	}
+}
+
+func TestScoreSpamOff(t *testing.T) {
+	t.Setenv("SPAM_CHECKER", "")
+
+	if action := ScoreSpam(scoredEmail("25")); action != spam.ActionNone {
+		t.Errorf("spam checking off gave action %q", action)
+	}
+}
@@ -0,0 +1,56 @@
+package ingest
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cjdenio/temp-email/pkg/clamd"
+	"github.com/cjdenio/temp-email/pkg/db"
+)
+
+// QuarantineVirus is the quarantine reason for infected mail
+const QuarantineVirus = "virus"
+
+// ErrScanUnavailable is returned when clamd can't be reached and
+// CLAMD_FAIL_CLOSED is set, so the message should be refused for now
+var ErrScanUnavailable = errors.New("virus scan unavailable")
+
+// failClosed reports whether mail is refused while clamd is unavailable,
+// set with CLAMD_FAIL_CLOSED (default false, i.e. fail open)
+func failClosed() bool {
+	closed, _ := strconv.ParseBool(os.Getenv("CLAMD_FAIL_CLOSED"))
+	return closed
+}
+
+// ScanForViruses streams a message with attachments through clamd and
+// quarantines it if it's infected. Messages without attachments aren't
+// scanned.
+func ScanForViruses(email *db.Email, hasAttachments bool) error {
+	client := clamd.FromEnv()
+	if client == nil || !hasAttachments {
+		return nil
+	}
+
+	result, err := client.Scan(strings.NewReader(email.Content))
+	if err != nil {
+		if failClosed() {
+			log.Printf("REJECT: Virus scan failed for mail to %s: %v", email.AddressID, err)
+			return ErrScanUnavailable
+		}
+
+		log.Printf("ERROR: Virus scan failed for mail to %s, accepting it: %v", email.AddressID, err)
+		return nil
+	}
+
+	if result.Infected {
+		log.Printf("Quarantining mail to %s: infected with %s", email.AddressID, result.Signature)
+		email.Virus = result.Signature
+		email.Quarantined = true
+		email.QuarantineReason = QuarantineVirus
+	}
+
+	return nil
+}
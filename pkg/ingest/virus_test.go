@@ -0,0 +1,105 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+)
+
+// fakeClamd answers INSTREAM scans like clamd, finding the EICAR test
+// signature in any stream containing "EICAR"
+func fakeClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+
+				command, err := r.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+
+				var stream bytes.Buffer
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&stream, r, int64(n)); err != nil {
+						return
+					}
+				}
+
+				if bytes.Contains(stream.Bytes(), []byte("EICAR")) {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestScanForViruses(t *testing.T) {
+	t.Setenv("CLAMD_ADDR", fakeClamd(t))
+
+	infected := &db.Email{AddressID: "abc", Content: "Subject: invoice\r\n\r\nX5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*\r\n"}
+	if err := ScanForViruses(infected, true); err != nil {
+		t.Fatal(err)
+	}
+	if !infected.Quarantined || infected.Virus != "Eicar-Test-Signature" || infected.QuarantineReason != QuarantineVirus {
+		t.Errorf("infected mail not quarantined: %+v", infected)
+	}
+
+	clean := &db.Email{AddressID: "abc", Content: "Subject: hi\r\n\r\nnothing to see\r\n"}
+	if err := ScanForViruses(clean, true); err != nil || clean.Quarantined || clean.Virus != "" {
+		t.Errorf("clean mail: err %v, %+v", err, clean)
+	}
+
+	// Mail without attachments isn't sent to clamd at all
+	skipped := &db.Email{AddressID: "abc", Content: infected.Content}
+	if err := ScanForViruses(skipped, false); err != nil || skipped.Quarantined {
+		t.Errorf("mail without attachments was scanned: err %v, %+v", err, skipped)
+	}
+}
+
+func TestScanForVirusesUnreachable(t *testing.T) {
+	t.Setenv("CLAMD_ADDR", unusedAddr(t))
+	t.Setenv("CLAMD_TIMEOUT_SECONDS", "1")
+
+	email := &db.Email{AddressID: "abc", Content: "Subject: hi\r\n\r\nEICAR\r\n"}
+
+	t.Setenv("CLAMD_FAIL_CLOSED", "")
+	if err := ScanForViruses(email, true); err != nil || email.Quarantined {
+		t.Errorf("failing open: err %v, quarantined %v; want accepted", err, email.Quarantined)
+	}
+
+	t.Setenv("CLAMD_FAIL_CLOSED", "true")
+	if err := ScanForViruses(email, true); err != ErrScanUnavailable {
+		t.Errorf("failing closed: err %v, want ErrScanUnavailable", err)
+	}
+}
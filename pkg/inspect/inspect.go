@@ -0,0 +1,286 @@
+package inspect
+
+import (
+	"bufio"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Header is one header field, unfolded
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Hop is one server the message passed through, from a Received header
+type Hop struct {
+	From string `json:"from,omitempty"`
+	// FromDetail is the comment after the from host, usually the sender's
+	// reverse DNS name and IP address as the receiving server saw them
+	FromDetail string `json:"fromDetail,omitempty"`
+	By         string `json:"by,omitempty"`
+	With       string `json:"with,omitempty"`
+	ID         string `json:"id,omitempty"`
+	For        string `json:"for,omitempty"`
+
+	Time *time.Time `json:"time,omitempty"`
+	// Delay is how long the message took to reach this hop from the one
+	// before it, or from its Date header for the first hop. It's nil when
+	// either time is missing.
+	Delay *time.Duration `json:"delay,omitempty"`
+
+	Raw string `json:"raw"`
+}
+
+// AuthResult is one method's verdict from an Authentication-Results header,
+// such as spf=pass
+type AuthResult struct {
+	Method string `json:"method"`
+	Result string `json:"result"`
+	// Reason is any comment given with the result
+	Reason     string   `json:"reason,omitempty"`
+	Properties []Header `json:"properties,omitempty"`
+}
+
+// AuthResults is one Authentication-Results header
+type AuthResults struct {
+	Server  string       `json:"server"`
+	Results []AuthResult `json:"results"`
+	Raw     string       `json:"raw"`
+}
+
+// Report is everything pulled out of a message's headers
+type Report struct {
+	Date *time.Time `json:"date,omitempty"`
+	// Hops are in the order the message travelled, oldest first
+	Hops []Hop `json:"hops"`
+	// TotalDelay runs from the Date header, or the first timed hop, to the
+	// last timed hop
+	TotalDelay *time.Duration `json:"totalDelay,omitempty"`
+
+	Authentication []AuthResults `json:"authentication"`
+	// List holds the List-* mailing list headers, such as List-Unsubscribe
+	List    []Header `json:"list"`
+	Headers []Header `json:"headers"`
+}
+
+// readHeaders returns a message's headers in order, unfolded
+func readHeaders(content string) ([]Header, error) {
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(content)))
+
+	var headers []Header
+	for {
+		line, err := r.ReadContinuedLine()
+		if err != nil || line == "" {
+			// A message with no body ends at EOF instead of a blank line
+			if len(headers) > 0 || line == "" {
+				return headers, nil
+			}
+			return nil, err
+		}
+
+		colon := strings.IndexByte(line, ':')
+		if colon <= 0 {
+			continue
+		}
+		headers = append(headers, Header{
+			Name:  strings.TrimSpace(line[:colon]),
+			Value: strings.TrimSpace(line[colon+1:]),
+		})
+	}
+}
+
+// splitComments separates the (comments) in a header value from the rest,
+// respecting nesting and quoted strings
+func splitComments(value string) (string, []string) {
+	var text, comment strings.Builder
+	var comments []string
+	depth := 0
+	quoted := false
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value) && (quoted || depth > 0):
+			if depth > 0 {
+				comment.WriteByte(value[i+1])
+			} else {
+				text.WriteByte(c)
+				text.WriteByte(value[i+1])
+			}
+			i++
+			continue
+		case c == '"' && depth == 0:
+			quoted = !quoted
+		case c == '(' && !quoted:
+			if depth > 0 {
+				comment.WriteByte(c)
+			}
+			depth++
+			continue
+		case c == ')' && !quoted && depth > 0:
+			depth--
+			if depth == 0 {
+				comments = append(comments, strings.TrimSpace(comment.String()))
+				comment.Reset()
+				// Keep a marker so callers can tell where the comment was
+				text.WriteString(" \x00 ")
+			} else {
+				comment.WriteByte(c)
+			}
+			continue
+		}
+
+		if depth > 0 {
+			comment.WriteByte(c)
+		} else {
+			text.WriteByte(c)
+		}
+	}
+
+	return text.String(), comments
+}
+
+// ParseReceived reads the clauses out of a Received header. Hop.Delay is
+// left for Inspect to fill in.
+func ParseReceived(value string) Hop {
+	hop := Hop{Raw: value}
+
+	clauses := value
+	if semi := strings.LastIndexByte(value, ';'); semi >= 0 {
+		clauses = value[:semi]
+		if t, err := mail.ParseDate(strings.TrimSpace(value[semi+1:])); err == nil {
+			hop.Time = &t
+		}
+	}
+
+	text, comments := splitComments(clauses)
+	words := strings.Fields(text)
+	next := 0 // which comment the next marker stands for
+
+	for i := 0; i < len(words); i++ {
+		if words[i] == "\x00" {
+			next++
+			continue
+		}
+		if i+1 >= len(words) || words[i+1] == "\x00" {
+			continue
+		}
+
+		arg := words[i+1]
+		switch strings.ToLower(words[i]) {
+		case "from":
+			hop.From = arg
+			if i+2 < len(words) && words[i+2] == "\x00" && next < len(comments) {
+				hop.FromDetail = comments[next]
+			}
+		case "by":
+			hop.By = arg
+		case "with":
+			hop.With = arg
+		case "id":
+			hop.ID = strings.Trim(arg, "<>")
+		case "for":
+			hop.For = strings.Trim(arg, "<>")
+		default:
+			continue
+		}
+		i++
+	}
+
+	return hop
+}
+
+// ParseAuthResults reads an Authentication-Results header (RFC 8601)
+func ParseAuthResults(value string) AuthResults {
+	auth := AuthResults{Raw: value, Results: []AuthResult{}}
+
+	parts := strings.Split(value, ";")
+	server, _ := splitComments(parts[0])
+	if fields := strings.Fields(strings.ReplaceAll(server, "\x00", "")); len(fields) > 0 {
+		auth.Server = fields[0]
+	}
+
+	for _, part := range parts[1:] {
+		text, comments := splitComments(part)
+		var result *AuthResult
+		for _, word := range strings.Fields(strings.ReplaceAll(text, "\x00", "")) {
+			eq := strings.IndexByte(word, '=')
+			if eq <= 0 {
+				continue
+			}
+			name, val := word[:eq], strings.Trim(word[eq+1:], `"`)
+
+			if result == nil {
+				result = &AuthResult{Method: strings.ToLower(name), Result: strings.ToLower(val)}
+				continue
+			}
+			result.Properties = append(result.Properties, Header{Name: name, Value: val})
+		}
+
+		if result != nil {
+			result.Reason = strings.Join(comments, " ")
+			auth.Results = append(auth.Results, *result)
+		}
+	}
+
+	return auth
+}
+
+// Inspect parses the headers of a raw message
+func Inspect(content string) (Report, error) {
+	headers, err := readHeaders(content)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{
+		Hops:           []Hop{},
+		Authentication: []AuthResults{},
+		List:           []Header{},
+		Headers:        headers,
+	}
+
+	for _, h := range headers {
+		name := strings.ToLower(h.Name)
+		switch {
+		case name == "date":
+			if t, err := mail.ParseDate(h.Value); err == nil {
+				report.Date = &t
+			}
+		case name == "received":
+			// Each server adds its Received header on top, so the first
+			// hop is the last header
+			report.Hops = append([]Hop{ParseReceived(h.Value)}, report.Hops...)
+		case name == "authentication-results":
+			report.Authentication = append(report.Authentication, ParseAuthResults(h.Value))
+		case strings.HasPrefix(name, "list-"):
+			report.List = append(report.List, h)
+		}
+	}
+
+	start := report.Date
+	previous := report.Date
+	for i := range report.Hops {
+		hop := &report.Hops[i]
+		if hop.Time == nil {
+			continue
+		}
+
+		if previous != nil {
+			delay := hop.Time.Sub(*previous)
+			hop.Delay = &delay
+		}
+		previous = hop.Time
+
+		if start == nil {
+			start = hop.Time
+		}
+		total := hop.Time.Sub(*start)
+		report.TotalDelay = &total
+	}
+
+	return report, nil
+}
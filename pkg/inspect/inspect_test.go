@@ -0,0 +1,197 @@
+package inspect
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A message that went from the sender's relay through Google to our MX,
+// newest Received header first as servers add them. One hop has no date and
+// another an unparseable one.
+const message = "Received: from mx.temp.example (mx.temp.example [203.0.113.5])\r\n" +
+	"\tby inbox.temp.example (Postfix) with ESMTPS id 4XJ2k1abcd\r\n" +
+	"\tfor <inbox@temp.example>; Tue, 01 Oct 2024 17:00:12 +0000\r\n" +
+	"Received: from mail-sor-f41.google.com (mail-sor-f41.google.com. [209.85.220.41])\r\n" +
+	"        by mx.temp.example with SMTPS id abc123\r\n" +
+	"        for <inbox@temp.example>\r\n" +
+	"        (Google Transport Security);\r\n" +
+	"        Tue, 01 Oct 2024 10:00:09 -0700 (PDT)\r\n" +
+	"Received: from relay.shop.example by mail-sor-f41.google.com; sometime on Tuesday\r\n" +
+	"Received: by 2002:a17:906:1234:b0:a8d with SMTP id x5csp1234;\r\n" +
+	"        Tue, 1 Oct 2024 10:00:03 -0700\r\n" +
+	"Received: from localhost by smtp.shop.example\r\n" +
+	"Authentication-Results: mx.temp.example;\r\n" +
+	"       dkim=pass header.i=@shop.example header.s=s1 header.b=AbCd;\r\n" +
+	"       spf=pass (google.com: domain of bounce@shop.example designates 198.51.100.7 as permitted sender) smtp.mailfrom=bounce@shop.example;\r\n" +
+	"       dmarc=fail (p=REJECT sp=REJECT dis=NONE) header.from=shop.example\r\n" +
+	"Authentication-Results: inbox.temp.example; none\r\n" +
+	"List-Unsubscribe: <https://shop.example/u/123>,\r\n" +
+	" <mailto:unsub@shop.example>\r\n" +
+	"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n" +
+	"list-id: Shop news <news.shop.example>\r\n" +
+	"From: Shop <news@shop.example>\r\n" +
+	"Date: Tue, 1 Oct 2024 17:00:00 +0000\r\n" +
+	"Subject: Deals\r\n" +
+	"\r\n" +
+	"Hello\r\n"
+
+func at(s string) *time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return &t
+}
+
+func seconds(n int) *time.Duration {
+	d := time.Duration(n) * time.Second
+	return &d
+}
+
+func TestInspectHops(t *testing.T) {
+	report, err := Inspect(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Date == nil || !report.Date.Equal(*at("2024-10-01T17:00:00Z")) {
+		t.Errorf("Date = %v", report.Date)
+	}
+
+	want := []struct {
+		from, by string
+		time     *time.Time
+		delay    *time.Duration
+	}{
+		// No date at all
+		{"localhost", "smtp.shop.example", nil, nil},
+		// Timed from the Date header
+		{"", "2002:a17:906:1234:b0:a8d", at("2024-10-01T17:00:03Z"), seconds(3)},
+		// Unparseable date
+		{"relay.shop.example", "mail-sor-f41.google.com", nil, nil},
+		// Timed from the last hop that had one
+		{"mail-sor-f41.google.com", "mx.temp.example", at("2024-10-01T17:00:09Z"), seconds(6)},
+		{"mx.temp.example", "inbox.temp.example", at("2024-10-01T17:00:12Z"), seconds(3)},
+	}
+	if len(report.Hops) != len(want) {
+		t.Fatalf("got %d hops, want %d: %+v", len(report.Hops), len(want), report.Hops)
+	}
+	for i, w := range want {
+		hop := report.Hops[i]
+		if hop.From != w.from || hop.By != w.by {
+			t.Errorf("hop %d = from %q by %q, want from %q by %q", i, hop.From, hop.By, w.from, w.by)
+		}
+		if (hop.Time == nil) != (w.time == nil) || (hop.Time != nil && !hop.Time.Equal(*w.time)) {
+			t.Errorf("hop %d time = %v, want %v", i, hop.Time, w.time)
+		}
+		if !reflect.DeepEqual(hop.Delay, w.delay) {
+			t.Errorf("hop %d delay = %v, want %v", i, hop.Delay, w.delay)
+		}
+	}
+
+	if !reflect.DeepEqual(report.TotalDelay, seconds(12)) {
+		t.Errorf("TotalDelay = %v, want 12s", report.TotalDelay)
+	}
+}
+
+func TestInspectWithoutDate(t *testing.T) {
+	report, err := Inspect("Received: from a by b; Tue, 1 Oct 2024 17:00:10 +0000\r\n" +
+		"Received: from c by a; Tue, 1 Oct 2024 17:00:00 +0000\r\n" +
+		"Date: whenever\r\n" +
+		"Subject: No body")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first hop has nothing to be timed from, but starts the total
+	if report.Date != nil || report.Hops[0].Delay != nil || !reflect.DeepEqual(report.Hops[1].Delay, seconds(10)) {
+		t.Errorf("report = %+v, want only the second hop timed", report)
+	}
+	if !reflect.DeepEqual(report.TotalDelay, seconds(10)) {
+		t.Errorf("TotalDelay = %v, want 10s", report.TotalDelay)
+	}
+	if len(report.Headers) != 4 {
+		t.Errorf("got %d headers from a message without a body, want 4", len(report.Headers))
+	}
+}
+
+func TestParseReceived(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Hop
+	}{
+		{
+			"from mx.temp.example (mx.temp.example [203.0.113.5]) by inbox.temp.example (Postfix) with ESMTPS id 4XJ2k1abcd for <inbox@temp.example>; Tue, 01 Oct 2024 17:00:12 +0000",
+			Hop{From: "mx.temp.example", FromDetail: "mx.temp.example [203.0.113.5]", By: "inbox.temp.example", With: "ESMTPS", ID: "4XJ2k1abcd", For: "inbox@temp.example", Time: at("2024-10-01T17:00:12Z")},
+		},
+		{
+			"from [192.168.1.10] (unknown [198.51.100.7] (nested \\) comment)) BY smtp.shop.example WITH ESMTPSA ID <1A2B3C@shop.example>",
+			Hop{From: "[192.168.1.10]", FromDetail: "unknown [198.51.100.7] (nested ) comment)", By: "smtp.shop.example", With: "ESMTPSA", ID: "1A2B3C@shop.example"},
+		},
+		{
+			"by 2002:a17:906:1234:b0:a8d with SMTP id x5csp1234; not a date",
+			Hop{By: "2002:a17:906:1234:b0:a8d", With: "SMTP", ID: "x5csp1234"},
+		},
+		{"", Hop{}},
+	}
+	for _, tt := range tests {
+		tt.want.Raw = tt.value
+		got := ParseReceived(tt.value)
+		if (got.Time == nil) != (tt.want.Time == nil) || (got.Time != nil && !got.Time.Equal(*tt.want.Time)) {
+			t.Errorf("ParseReceived(%q) time = %v, want %v", tt.value, got.Time, tt.want.Time)
+		}
+		got.Time, tt.want.Time = nil, nil
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseReceived(%q) =\n%+v\nwant\n%+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestInspectAuthenticationAndLists(t *testing.T) {
+	report, err := Inspect(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AuthResults{
+		{
+			Server: "mx.temp.example",
+			Results: []AuthResult{
+				{Method: "dkim", Result: "pass", Properties: []Header{{"header.i", "@shop.example"}, {"header.s", "s1"}, {"header.b", "AbCd"}}},
+				{Method: "spf", Result: "pass", Reason: "google.com: domain of bounce@shop.example designates 198.51.100.7 as permitted sender", Properties: []Header{{"smtp.mailfrom", "bounce@shop.example"}}},
+				{Method: "dmarc", Result: "fail", Reason: "p=REJECT sp=REJECT dis=NONE", Properties: []Header{{"header.from", "shop.example"}}},
+			},
+		},
+		{Server: "inbox.temp.example", Results: []AuthResult{}},
+	}
+	if len(report.Authentication) != len(want) {
+		t.Fatalf("got %d Authentication-Results, want %d", len(report.Authentication), len(want))
+	}
+	for i := range want {
+		got := report.Authentication[i]
+		got.Raw = ""
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("Authentication-Results %d =\n%+v\nwant\n%+v", i, got, want[i])
+		}
+	}
+
+	wantList := []Header{
+		{"List-Unsubscribe", "<https://shop.example/u/123>, <mailto:unsub@shop.example>"},
+		{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+		{"list-id", "Shop news <news.shop.example>"},
+	}
+	if !reflect.DeepEqual(report.List, wantList) {
+		t.Errorf("List = %+v, want %+v", report.List, wantList)
+	}
+}
+
+func TestInspectEmptyMessage(t *testing.T) {
+	report, err := Inspect("\r\nJust a body\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Headers) != 0 || report.Hops == nil || report.Authentication == nil || report.List == nil {
+		t.Errorf("report = %+v, want empty lists", report)
+	}
+}
@@ -10,22 +10,18 @@ import (
 	"log"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/DusanKasan/parsemail"
-	"github.com/PuerkitoBio/goquery"
+	"github.com/cjdenio/temp-email/pkg/blocklist"
 	"github.com/cjdenio/temp-email/pkg/db"
-	"github.com/cjdenio/temp-email/pkg/util"
+	"github.com/cjdenio/temp-email/pkg/ingest"
+	"github.com/cjdenio/temp-email/pkg/search"
+	"github.com/cjdenio/temp-email/pkg/spam"
+	"github.com/cjdenio/temp-email/pkg/store"
 	"github.com/gin-gonic/gin"
-	"github.com/slack-go/slack"
-	"gorm.io/gorm"
-
-	md "github.com/JohannesKaufmann/html-to-markdown"
 )
 
-var SlackClient *slack.Client
-
 // VerifyWebhookSignature verifies the Mailgun webhook signature
 func VerifyWebhookSignature(timestamp, token, signature, signingKey string) bool {
 	h := hmac.New(sha256.New, []byte(signingKey))
@@ -36,8 +32,13 @@ func VerifyWebhookSignature(timestamp, token, signature, signingKey string) bool
 	return hmac.Equal([]byte(signature), []byte(computedSignature))
 }
 
+// Handler receives Mailgun webhooks into the given stores
+type Handler struct {
+	Stores store.Stores
+}
+
 // HandleWebhook processes incoming emails from Mailgun
-func HandleWebhook(c *gin.Context) {
+func (h Handler) HandleWebhook(c *gin.Context) {
 	// Get signature verification data
 	timestamp := c.PostForm("timestamp")
 	token := c.PostForm("token")
@@ -78,25 +79,18 @@ func HandleWebhook(c *gin.Context) {
 	
 	log.Printf("Mailgun webhook received: to=%s from=%s subject=%s", recipient, from, subject)
 	
-	// Extract address ID from recipient (format: addressId@domain)
-	split := strings.Split(recipient, "@")
-	if len(split) < 2 {
+	// Look up address in database (format: addressId+tag@domain)
+	address, tag, err := ingest.FindAddress(h.Stores, recipient)
+	if err == ingest.ErrInvalidRecipient {
 		log.Printf("Invalid recipient format: %s", recipient)
 		c.JSON(200, gin.H{"status": "ignored"})
 		return
-	}
-	
-	addressId := split[0]
-	
-	// Look up address in database
-	var address db.Address
-	tx := db.DB.Where("id = ? AND expires_at > NOW()", addressId).First(&address)
-	if tx.Error == gorm.ErrRecordNotFound {
-		log.Printf("REJECT: Address not found or expired: %s (from: %s)", addressId, from)
+	} else if err == store.ErrNotFound {
+		log.Printf("REJECT: Address not found or expired: %s (from: %s)", recipient, from)
 		c.JSON(200, gin.H{"status": "rejected", "reason": "address not found or expired"})
 		return
-	} else if tx.Error != nil {
-		log.Printf("ERROR: Database query failed for address %s: %v", addressId, tx.Error)
+	} else if err != nil {
+		log.Printf("ERROR: Database query failed for address %s: %v", recipient, err)
 		c.JSON(200, gin.H{"status": "error"})
 		return
 	}
@@ -111,55 +105,46 @@ func HandleWebhook(c *gin.Context) {
 		rawEmailContent = fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s", from, recipient, subject, bodyPlain)
 	}
 	
+	if blocklist.Check(h.Stores.GlobalRules, blocklist.Message{Sender: ingest.SenderAddress(from), Subject: subject}) != nil ||
+		blocklist.Check(h.Stores.GlobalRules, blocklist.Message{Sender: c.PostForm("sender")}) != nil {
+		c.JSON(200, gin.H{"status": "rejected", "reason": "blocked by policy"})
+		return
+	}
+	
+	// Rules apply to both the From header and the envelope sender
+	if ok, reason := ingest.SenderAllowed(h.Stores.Senders, address.ID, ingest.SenderAddress(from), c.PostForm("sender")); !ok {
+		ingest.LogBlocked(h.Stores.Senders, address.ID, ingest.SenderAddress(from), subject, reason)
+		c.JSON(200, gin.H{"status": "rejected", "reason": "sender blocked"})
+		return
+	}
+	
 	// Save email to database
 	savedEmail := &db.Email{
-		ID:        util.GenerateEmailAddress(),
-		AddressID: address.ID,
-		Content:   rawEmailContent,
+		AddressID:    address.ID,
+		Tag:          tag,
+		Content:      rawEmailContent,
+		EnvelopeFrom: c.PostForm("sender"),
+		Subject:      subject,
+		Sender:       ingest.SenderAddress(from),
+		BodyText:     search.PlainText(bodyPlain, bodyHtml),
 	}
 	
-	db.DB.Create(&savedEmail)
+	if ingest.ScoreSpam(savedEmail) == spam.ActionReject {
+		c.JSON(200, gin.H{"status": "rejected", "reason": "spam"})
+		return
+	}
 	
-	// Format subject
-	subjectText := subject
-	if subjectText == "" {
-		subjectText = "_no subject_"
-	} else {
-		subjectText = fmt.Sprintf("subject: *%s*", subject)
+	if err := ingest.SaveEmail(h.Stores, savedEmail); err != nil {
+		log.Printf("ERROR: Failed to save email for %s: %v", address.ID, err)
+		c.JSON(500, gin.H{"error": "Cannot save email"})
+		return
 	}
 	
 	// Process body
 	body := ""
 	if bodyHtml != "" {
 		// Convert HTML to Markdown for Slack
-		converter := md.NewConverter("", true, &md.Options{
-			StrongDelimiter: "*",
-			EmDelimiter:     "_",
-		})
-		
-		converter.AddRules(
-			md.Rule{
-				Filter: []string{"a"},
-				Replacement: func(content string, selec *goquery.Selection, options *md.Options) *string {
-					return md.String(fmt.Sprintf("<%s|%s>", selec.AttrOr("href", content), content))
-				},
-			},
-			md.Rule{
-				Filter: []string{"h1", "h2", "h3", "h4", "h5", "h6"},
-				Replacement: func(content string, selec *goquery.Selection, options *md.Options) *string {
-					return md.String("\n\n*" + content + "*\n\n")
-				},
-			},
-			md.Rule{
-				Filter: []string{"img"},
-				Replacement: func(content string, selec *goquery.Selection, options *md.Options) *string {
-					return md.String("")
-				},
-			},
-		)
-		
-		var err error
-		body, err = converter.ConvertString(bodyHtml)
+		body, err = ingest.Markdown(bodyHtml)
 		if err != nil {
 			log.Printf("Error converting HTML: %v", err)
 			body = bodyPlain
@@ -168,38 +153,14 @@ func HandleWebhook(c *gin.Context) {
 		body = bodyPlain
 	}
 	
-	// Post to Slack (only if address was created via Slack)
-	if address.Timestamp != "" && SlackClient != nil {
-		_, _, err := SlackClient.PostMessage(
-			os.Getenv("SLACK_CHANNEL"),
-			slack.MsgOptionDisableLinkUnfurl(),
-			slack.MsgOptionDisableMediaUnfurl(),
-			slack.MsgOptionTS(address.Timestamp),
-			slack.MsgOptionBlocks(
-				slack.NewSectionBlock(
-					slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("message from `%s`\n%s", from, util.SanitizeInput(subjectText)), false, false),
-					nil,
-					nil,
-				),
-				slack.NewDividerBlock(),
-				slack.NewSectionBlock(
-					slack.NewTextBlockObject("mrkdwn", util.SanitizeInput(body), false, false),
-					nil,
-					nil,
-				),
-				slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("Not rendering properly? Click <%s/%s|here> to view this email in your browser.", os.Getenv("APP_DOMAIN"), savedEmail.ID), false, false)),
-			),
-		)
-		if err != nil {
-			log.Printf("Error posting to Slack: %v", err)
-		}
-	}
+	// Notify the address's owner (Slack only posts if it was created via Slack)
+	ingest.Notify(h.Stores, address, *savedEmail, from, subject, body)
 	
 	c.JSON(200, gin.H{"status": "ok"})
 }
 
 // HandleRawWebhook processes raw MIME emails from Mailgun (alternative method)
-func HandleRawWebhook(c *gin.Context) {
+func (h Handler) HandleRawWebhook(c *gin.Context) {
 	// Get signature verification
 	timestamp := c.PostForm("timestamp")
 	token := c.PostForm("token")
@@ -257,42 +218,75 @@ func HandleRawWebhook(c *gin.Context) {
 		return
 	}
 	
-	// Extract address ID
-	split := strings.Split(recipient, "@")
-	if len(split) < 2 {
+	// Look up address
+	address, tag, err := ingest.FindAddress(h.Stores, recipient)
+	if err == ingest.ErrInvalidRecipient {
 		log.Printf("Invalid recipient format: %s", recipient)
 		c.JSON(200, gin.H{"status": "ignored"})
 		return
-	}
-	
-	addressId := split[0]
-	
-	// Look up address
-	var address db.Address
-	tx := db.DB.Where("id = ? AND expires_at > NOW()", addressId).First(&address)
-	if tx.Error == gorm.ErrRecordNotFound {
-		log.Printf("REJECT: Address not found or expired: %s (from: %s)", addressId, email.From[0].Address)
+	} else if err == store.ErrNotFound {
+		log.Printf("REJECT: Address not found or expired: %s (from: %s)", recipient, email.From[0].Address)
 		c.JSON(200, gin.H{"status": "rejected"})
 		return
-	} else if tx.Error != nil {
-		log.Printf("ERROR: Database query failed: %v", tx.Error)
+	} else if err != nil {
+		log.Printf("ERROR: Database query failed: %v", err)
 		c.JSON(200, gin.H{"status": "error"})
 		return
 	}
 	
 	log.Printf("ACCEPT: Email received for %s from %s", recipient, email.From[0].Address)
 	
+	if blocklist.Check(h.Stores.GlobalRules, blocklist.Message{Sender: email.From[0].Address, Subject: email.Subject}) != nil ||
+		blocklist.Check(h.Stores.GlobalRules, blocklist.Message{Sender: c.PostForm("sender")}) != nil {
+		c.JSON(200, gin.H{"status": "rejected", "reason": "blocked by policy"})
+		return
+	}
+	
+	if ok, reason := ingest.SenderAllowed(h.Stores.Senders, address.ID, email.From[0].Address, c.PostForm("sender")); !ok {
+		ingest.LogBlocked(h.Stores.Senders, address.ID, email.From[0].Address, email.Subject, reason)
+		c.JSON(200, gin.H{"status": "rejected", "reason": "sender blocked"})
+		return
+	}
+	
 	// Save to database
 	savedEmail := &db.Email{
-		ID:        util.GenerateEmailAddress(),
-		AddressID: address.ID,
-		Content:   string(rawEmail),
+		AddressID:    address.ID,
+		Tag:          tag,
+		Content:      string(rawEmail),
+		EnvelopeFrom: c.PostForm("sender"),
+		Subject:      email.Subject,
+		Sender:       email.From[0].Address,
+		BodyText:     search.PlainText(email.TextBody, email.HTMLBody),
 	}
 	
-	db.DB.Create(&savedEmail)
+	if ingest.ScoreSpam(savedEmail) == spam.ActionReject {
+		c.JSON(200, gin.H{"status": "rejected", "reason": "spam"})
+		return
+	}
+	
+	// A non-200 response makes Mailgun retry later
+	if err := ingest.ScanForViruses(savedEmail, len(email.Attachments)+len(email.EmbeddedFiles) > 0); err != nil {
+		c.JSON(503, gin.H{"error": "Virus scan unavailable"})
+		return
+	}
+	
+	if err := ingest.SaveEmail(h.Stores, savedEmail); err != nil {
+		log.Printf("ERROR: Failed to save email for %s: %v", address.ID, err)
+		c.JSON(500, gin.H{"error": "Cannot save email"})
+		return
+	}
 	
 	// Post to Slack (same logic as regular webhook)
-	// ... (rest of the Slack posting logic)
+	body := email.TextBody
+	if email.HTMLBody != "" {
+		body, err = ingest.Markdown(email.HTMLBody)
+		if err != nil {
+			log.Printf("Error converting HTML: %v", err)
+			body = email.TextBody
+		}
+	}
+	
+	ingest.Notify(h.Stores, address, *savedEmail, email.From[0].Address, email.Subject, body)
 	
 	c.JSON(200, gin.H{"status": "ok"})
 }
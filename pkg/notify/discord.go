@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+)
+
+// Discord posts to a channel webhook, or through a bot when an address's
+// target is a channel ID rather than a webhook URL
+type Discord struct {
+	// BotToken authorizes posting to channel IDs, from DISCORD_BOT_TOKEN
+	BotToken string
+	// APIBase defaults to https://discord.com/api/v10
+	APIBase string
+	HTTP    *http.Client
+}
+
+type discordEmbed struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+}
+
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+	// Email content must never ping @everyone or anyone else
+	AllowedMentions struct {
+		Parse []string `json:"parse"`
+	} `json:"allowed_mentions"`
+}
+
+func (d *Discord) Post(address db.Address, m Message) error {
+	message := discordMessage{Embeds: []discordEmbed{{Title: m.Title, Description: m.Text, URL: m.URL}}}
+	message.AllowedMentions.Parse = []string{}
+
+	if isURL(address.NotifyTarget) {
+		return sendJSON(d.HTTP, http.MethodPost, address.NotifyTarget, nil, message)
+	}
+
+	if d.BotToken == "" {
+		return errors.New("discord channel targets need DISCORD_BOT_TOKEN")
+	}
+
+	base := d.APIBase
+	if base == "" {
+		base = "https://discord.com/api/v10"
+	}
+
+	return sendJSON(
+		d.HTTP,
+		http.MethodPost,
+		fmt.Sprintf("%s/channels/%s/messages", strings.TrimSuffix(base, "/"), address.NotifyTarget),
+		map[string]string{"Authorization": "Bot " + d.BotToken},
+		message,
+	)
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+)
+
+// Matrix sends a message to a room through the client-server API
+type Matrix struct {
+	// Homeserver is the base URL, such as https://matrix.org, from
+	// MATRIX_HOMESERVER
+	Homeserver string
+	// AccessToken belongs to the user that posts, from MATRIX_ACCESS_TOKEN.
+	// It must already have joined each room.
+	AccessToken string
+	HTTP        *http.Client
+}
+
+// Counts messages sent, so transaction IDs stay unique within a nanosecond
+var matrixTxn uint64
+
+type matrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+func (m *Matrix) Post(address db.Address, msg Message) error {
+	if m.Homeserver == "" || m.AccessToken == "" {
+		return errors.New("matrix needs MATRIX_HOMESERVER and MATRIX_ACCESS_TOKEN")
+	}
+
+	body := msg.Title + "\n\n" + msg.Text
+	formatted := "<strong>" + html.EscapeString(msg.Title) + "</strong><br><br>" + strings.ReplaceAll(html.EscapeString(msg.Text), "\n", "<br>")
+	if msg.URL != "" {
+		body += "\n\n" + msg.URL
+		formatted += fmt.Sprintf(`<br><br><a href="%s">View email</a>`, html.EscapeString(msg.URL))
+	}
+
+	txnID := fmt.Sprintf("%d-%d", time.Now().UnixNano(), atomic.AddUint64(&matrixTxn, 1))
+
+	return sendJSON(
+		m.HTTP,
+		http.MethodPut,
+		fmt.Sprintf(
+			"%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+			strings.TrimSuffix(m.Homeserver, "/"),
+			url.PathEscape(address.NotifyTarget),
+			txnID,
+		),
+		map[string]string{"Authorization": "Bearer " + m.AccessToken},
+		matrixMessage{
+			MsgType:       "m.text",
+			Body:          body,
+			Format:        "org.matrix.custom.html",
+			FormattedBody: formatted,
+		},
+	)
+}
@@ -0,0 +1,276 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/util"
+	"github.com/slack-go/slack"
+)
+
+// Notifier kinds, stored in db.Address.Notifier
+const (
+	KindSlack   = "slack"
+	KindDiscord = "discord"
+	KindTeams   = "teams"
+	KindMatrix  = "matrix"
+)
+
+// Received is an email that just arrived, as shown in a notification
+type Received struct {
+	Email   db.Email
+	From    string
+	Subject string
+
+	// Body is the message rendered as Slack mrkdwn. Other sinks use
+	// Email.BodyText.
+	Body string
+
+	// When the email continues a conversation, the subject it started with
+	// and how many messages it now has
+	Conversation     string
+	ConversationSize int
+}
+
+// Notifier tells an address's owner what's happening with it
+type Notifier interface {
+	AddressCreated(address db.Address) error
+	EmailReceived(address db.Address, email Received) error
+	Expiring(address db.Address, left time.Duration) error
+	Expired(address db.Address) error
+}
+
+var (
+	mu    sync.RWMutex
+	sinks = map[string]Notifier{}
+)
+
+// Register makes n the notifier for addresses of the given kind
+func Register(kind string, n Notifier) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	sinks[kind] = n
+}
+
+// Setup registers every sink, with Slack posting through client and the
+// rest configured from the environment
+func Setup(client *slack.Client) {
+	Register(KindSlack, &Slack{Client: client, Channel: os.Getenv("SLACK_CHANNEL")})
+	Register(KindDiscord, Text(&Discord{BotToken: os.Getenv("DISCORD_BOT_TOKEN")}))
+	Register(KindTeams, Text(&Teams{}))
+	Register(KindMatrix, Text(&Matrix{
+		Homeserver:  os.Getenv("MATRIX_HOMESERVER"),
+		AccessToken: os.Getenv("MATRIX_ACCESS_TOKEN"),
+	}))
+}
+
+// For returns the notifier an address uses. Addresses without one use Slack.
+func For(address db.Address) Notifier {
+	kind := address.Notifier
+	if kind == "" {
+		kind = KindSlack
+	}
+
+	mu.RLock()
+	n, ok := sinks[kind]
+	mu.RUnlock()
+	if !ok {
+		log.Printf("ERROR: No %q notifier set up for address %s", kind, address.ID)
+		return nop{}
+	}
+
+	return n
+}
+
+// Validate checks a notifier kind and target before they're saved on an
+// address
+func Validate(kind, target string) error {
+	switch kind {
+	case "", KindSlack:
+		return nil
+	case KindDiscord, KindTeams:
+		if target == "" {
+			return fmt.Errorf("%s notifications need a webhook URL", kind)
+		}
+		if kind == KindTeams && !isURL(target) {
+			return fmt.Errorf("teams notifications need an incoming webhook URL")
+		}
+		return nil
+	case KindMatrix:
+		if !strings.HasPrefix(target, "!") {
+			return fmt.Errorf("matrix notifications need a room ID, like !abc123:matrix.org")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown notifier %q", kind)
+	}
+}
+
+func isURL(target string) bool {
+	return strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "http://")
+}
+
+func conversationName(subject string) string {
+	if subject == "" {
+		return "(no subject)"
+	}
+
+	return subject
+}
+
+// nop drops notifications for addresses whose notifier isn't set up
+type nop struct{}
+
+func (nop) AddressCreated(db.Address) error          { return nil }
+func (nop) EmailReceived(db.Address, Received) error { return nil }
+func (nop) Expiring(db.Address, time.Duration) error { return nil }
+func (nop) Expired(db.Address) error                 { return nil }
+
+// Message is a notification rendered as plain text, for sinks without
+// Slack's rich formatting
+type Message struct {
+	Title string
+	Text  string
+	// URL links to the email, if there is one
+	URL string
+}
+
+// Poster sends a plain-text Message to an address's target
+type Poster interface {
+	Post(address db.Address, m Message) error
+}
+
+// Longest body preview sent to plain-text sinks
+const maxPreview = 1500
+
+// Text turns a Poster into a Notifier that sends each event as a Message
+func Text(p Poster) Notifier {
+	return textNotifier{p}
+}
+
+type textNotifier struct {
+	Poster
+}
+
+func (t textNotifier) AddressCreated(address db.Address) error {
+	return t.Post(address, Message{
+		Title: "New temporary address",
+		Text: fmt.Sprintf(
+			"Your temporary address is %s@%s. It expires in %s.",
+			address.ID,
+			address.Domain,
+			util.FormatDuration(address.ExpiresAt.Sub(address.CreatedAt).Round(time.Minute)),
+		),
+	})
+}
+
+func (t textNotifier) EmailReceived(address db.Address, r Received) error {
+	if r.Email.Virus != "" {
+		return t.Post(address, Message{
+			Title: fmt.Sprintf("Quarantined a message to %s@%s containing malware", address.ID, address.Domain),
+			Text: fmt.Sprintf(
+				"From: %s\nSubject: %s\nSignature: %s\nIts attachments have been disabled; an admin can inspect it from the dashboard.",
+				r.From,
+				r.Subject,
+				r.Email.Virus,
+			),
+		})
+	}
+
+	header := fmt.Sprintf("From: %s", r.From)
+	if r.Email.Tag != "" {
+		header += fmt.Sprintf(" (tagged +%s)", r.Email.Tag)
+	}
+	if r.Email.Spam {
+		header = fmt.Sprintf("Likely spam (score %.1f)\n%s", r.Email.SpamScore, header)
+	}
+
+	subject := r.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+
+	preview := []rune(r.Email.BodyText)
+	if len(preview) > maxPreview {
+		preview = append(preview[:maxPreview], '…')
+	}
+
+	if r.ConversationSize > 1 {
+		subject += fmt.Sprintf("\nConversation: %s (%d messages)", conversationName(r.Conversation), r.ConversationSize)
+	}
+
+	m := Message{
+		Title: fmt.Sprintf("New email to %s@%s", address.ID, address.Domain),
+		Text:  fmt.Sprintf("%s\nSubject: %s\n\n%s", header, subject, string(preview)),
+	}
+	if appDomain := os.Getenv("APP_DOMAIN"); appDomain != "" {
+		m.URL = fmt.Sprintf("%s/%s", appDomain, r.Email.ID)
+	}
+
+	return t.Post(address, m)
+}
+
+func (t textNotifier) Expiring(address db.Address, left time.Duration) error {
+	return t.Post(address, Message{
+		Title: "Address expiring soon",
+		Text:  fmt.Sprintf("%s@%s expires in %s. Extend it from the dashboard if you still need it.", address.ID, address.Domain, util.FormatDuration(left.Round(time.Minute))),
+	})
+}
+
+func (t textNotifier) Expired(address db.Address) error {
+	return t.Post(address, Message{
+		Title: "Address expired",
+		Text:  fmt.Sprintf("%s@%s has expired and will no longer receive mail.", address.ID, address.Domain),
+	})
+}
+
+var defaultHTTP = &http.Client{Timeout: 10 * time.Second}
+
+// sendJSON sends body as JSON and fails on any non-2xx response
+func sendJSON(client *http.Client, method, target string, headers map[string]string, body interface{}) error {
+	if client == nil {
+		client = defaultHTTP
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		// The URL isn't included since webhook URLs carry their secret
+		if urlErr, ok := err.(*url.Error); ok {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		reply, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(reply)))
+	}
+
+	return nil
+}
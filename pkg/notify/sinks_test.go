@@ -0,0 +1,236 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+)
+
+// request is what a stub sink received
+type request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// newSink starts a server that records each request and answers with the
+// given status and body
+func newSink(t *testing.T, status int, reply string) (*httptest.Server, chan request) {
+	t.Helper()
+
+	received := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{Method: r.Method, Path: r.URL.EscapedPath(), Header: r.Header}
+		if err := json.NewDecoder(r.Body).Decode(&req.Body); err != nil {
+			t.Errorf("sink got a body that isn't JSON: %v", err)
+		}
+		received <- req
+
+		w.WriteHeader(status)
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, received
+}
+
+// next returns the sink's next request, failing if there wasn't one
+func next(t *testing.T, received chan request) request {
+	t.Helper()
+
+	select {
+	case req := <-received:
+		return req
+	default:
+		t.Fatal("sink wasn't called")
+		return request{}
+	}
+}
+
+var message = Message{Title: "New email to inbox@temp.example", Text: "From: a@b.example\nSubject: Hi", URL: "https://mail.example/abc"}
+
+func TestDiscordWebhook(t *testing.T) {
+	server, received := newSink(t, 204, "")
+
+	d := &Discord{}
+	if err := d.Post(db.Address{NotifyTarget: server.URL + "/api/webhooks/1/secret"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	req := next(t, received)
+	if req.Method != "POST" || req.Path != "/api/webhooks/1/secret" || req.Header.Get("Authorization") != "" {
+		t.Errorf("got %s %s (Authorization %q)", req.Method, req.Path, req.Header.Get("Authorization"))
+	}
+
+	embeds, _ := req.Body["embeds"].([]interface{})
+	if len(embeds) != 1 {
+		t.Fatalf("embeds = %v, want one", req.Body["embeds"])
+	}
+	embed := embeds[0].(map[string]interface{})
+	if embed["title"] != message.Title || embed["description"] != message.Text || embed["url"] != message.URL {
+		t.Errorf("embed = %v", embed)
+	}
+
+	// An empty parse list, rather than a missing one, is what stops pings
+	mentions, _ := req.Body["allowed_mentions"].(map[string]interface{})
+	if parse, ok := mentions["parse"].([]interface{}); !ok || len(parse) != 0 {
+		t.Errorf("allowed_mentions = %v, want an empty parse list", req.Body["allowed_mentions"])
+	}
+}
+
+func TestDiscordBotChannel(t *testing.T) {
+	server, received := newSink(t, 200, "{}")
+
+	d := &Discord{BotToken: "bot-token", APIBase: server.URL + "/api/v10/"}
+	if err := d.Post(db.Address{NotifyTarget: "123456"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	req := next(t, received)
+	if req.Method != "POST" || req.Path != "/api/v10/channels/123456/messages" {
+		t.Errorf("got %s %s", req.Method, req.Path)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bot bot-token" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	// Without a bot token a channel ID can't be posted to
+	d = &Discord{APIBase: server.URL}
+	if err := d.Post(db.Address{NotifyTarget: "123456"}, message); err == nil {
+		t.Error("posting to a channel without a bot token succeeded")
+	}
+	if len(received) != 0 {
+		t.Error("sink was called without a bot token")
+	}
+}
+
+func TestTeamsCard(t *testing.T) {
+	server, received := newSink(t, 200, "1")
+
+	teams := &Teams{}
+	if err := teams.Post(db.Address{NotifyTarget: server.URL + "/webhookb2/secret"}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	req := next(t, received)
+	if req.Method != "POST" || req.Path != "/webhookb2/secret" {
+		t.Errorf("got %s %s", req.Method, req.Path)
+	}
+	if req.Body["@type"] != "MessageCard" || req.Body["@context"] != "https://schema.org/extensions" {
+		t.Errorf("card type = %v, %v", req.Body["@type"], req.Body["@context"])
+	}
+	if req.Body["title"] != message.Title || req.Body["summary"] != message.Title {
+		t.Errorf("title = %v, summary = %v", req.Body["title"], req.Body["summary"])
+	}
+	if want := "From: a@b.example\n\nSubject: Hi"; req.Body["text"] != want {
+		t.Errorf("text = %q, want %q", req.Body["text"], want)
+	}
+
+	actions, _ := req.Body["potentialAction"].([]interface{})
+	if len(actions) != 1 {
+		t.Fatalf("potentialAction = %v, want one", req.Body["potentialAction"])
+	}
+	action := actions[0].(map[string]interface{})
+	targets, _ := action["targets"].([]interface{})
+	if action["@type"] != "OpenUri" || len(targets) != 1 || targets[0].(map[string]interface{})["uri"] != message.URL {
+		t.Errorf("action = %v", action)
+	}
+
+	// Notifications without an email have nothing to open
+	if err := teams.Post(db.Address{NotifyTarget: server.URL}, Message{Title: "Address expired"}); err != nil {
+		t.Fatal(err)
+	}
+	if req := next(t, received); req.Body["potentialAction"] != nil {
+		t.Errorf("potentialAction = %v, want none", req.Body["potentialAction"])
+	}
+}
+
+func TestMatrixMessage(t *testing.T) {
+	server, received := newSink(t, 200, `{"event_id": "$1"}`)
+
+	m := &Matrix{Homeserver: server.URL + "/", AccessToken: "matrix-token"}
+	address := db.Address{NotifyTarget: "!room:matrix.example"}
+	for i := 0; i < 2; i++ {
+		if err := m.Post(address, Message{Title: "New <email>", Text: "a & b\nc", URL: message.URL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, second := next(t, received), next(t, received)
+	prefix := "/_matrix/client/v3/rooms/%21room:matrix.example/send/m.room.message/"
+	if first.Method != "PUT" || !strings.HasPrefix(first.Path, prefix) {
+		t.Errorf("got %s %s, want PUT %s...", first.Method, first.Path, prefix)
+	}
+	if first.Path == second.Path {
+		t.Errorf("two messages reused transaction path %s", first.Path)
+	}
+	if got := first.Header.Get("Authorization"); got != "Bearer matrix-token" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	if first.Body["msgtype"] != "m.text" || first.Body["format"] != "org.matrix.custom.html" {
+		t.Errorf("msgtype = %v, format = %v", first.Body["msgtype"], first.Body["format"])
+	}
+	if want := "New <email>\n\na & b\nc\n\n" + message.URL; first.Body["body"] != want {
+		t.Errorf("body = %q, want %q", first.Body["body"], want)
+	}
+	want := `<strong>New &lt;email&gt;</strong><br><br>a &amp; b<br>c<br><br><a href="` + message.URL + `">View email</a>`
+	if first.Body["formatted_body"] != want {
+		t.Errorf("formatted_body = %q, want %q", first.Body["formatted_body"], want)
+	}
+
+	// Both settings are needed before anything is sent
+	if err := (&Matrix{Homeserver: server.URL}).Post(address, message); err == nil {
+		t.Error("posting without an access token succeeded")
+	}
+	if len(received) != 0 {
+		t.Error("sink was called without an access token")
+	}
+}
+
+func TestSinkErrors(t *testing.T) {
+	server, _ := newSink(t, 400, "  invalid webhook token\n")
+
+	err := (&Discord{}).Post(db.Address{NotifyTarget: server.URL + "/api/webhooks/1/secret"}, message)
+	if err == nil || err.Error() != "400 Bad Request: invalid webhook token" {
+		t.Errorf("error = %v, want the status and the sink's reply", err)
+	}
+
+	// Webhook URLs hold their secret, so connection errors must not repeat
+	// them
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	err = (&Teams{}).Post(db.Address{NotifyTarget: closed.URL + "/webhookb2/secret"}, message)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("error = %v, want one without the URL", err)
+	}
+}
+
+func TestTextNotifierEmailReceived(t *testing.T) {
+	server, received := newSink(t, 204, "")
+	t.Setenv("APP_DOMAIN", "https://mail.example")
+
+	n := Text(&Discord{})
+	address := db.Address{ID: "inbox", Domain: "temp.example", NotifyTarget: server.URL}
+	err := n.EmailReceived(address, Received{
+		Email:   db.Email{ID: "abc", Tag: "news", Spam: true, SpamScore: 7.5, BodyText: "Hello"},
+		From:    "a@b.example",
+		Subject: "Hi",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	embed := next(t, received).Body["embeds"].([]interface{})[0].(map[string]interface{})
+	if embed["title"] != "New email to inbox@temp.example" || embed["url"] != "https://mail.example/abc" {
+		t.Errorf("embed = %v", embed)
+	}
+	if want := "Likely spam (score 7.5)\nFrom: a@b.example (tagged +news)\nSubject: Hi\n\nHello"; embed["description"] != want {
+		t.Errorf("description = %q, want %q", embed["description"], want)
+	}
+}
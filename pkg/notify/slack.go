@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/policy"
+	"github.com/cjdenio/temp-email/pkg/util"
+	"github.com/slack-go/slack"
+)
+
+// Action IDs for the buttons attached to each delivered email
+const (
+	ActionViewEmail   = "view_email"
+	ActionShowHeaders = "show_headers"
+	ActionDownloadEML = "download_eml"
+	ActionBlockSender = "block_sender"
+	ActionDeleteEmail = "delete_email"
+	ActionReplyEmail  = "reply_email"
+)
+
+// ActionExtend is the action ID of the Extend menu
+const ActionExtend = "extend"
+
+// Slack posts into the thread of the message that requested the address.
+// Addresses that weren't requested in Slack get nothing.
+type Slack struct {
+	Client  *slack.Client
+	Channel string
+}
+
+func (s *Slack) enabled(address db.Address) bool {
+	return address.Timestamp != "" && s.Client != nil
+}
+
+func (s *Slack) AddressCreated(address db.Address) error {
+	if !s.enabled(address) {
+		return nil
+	}
+
+	channel := address.Channel
+	if channel == "" {
+		channel = s.Channel
+	}
+
+	// Custom message based on duration
+	durationHours := int(address.ExpiresAt.Sub(address.CreatedAt).Round(time.Hour).Hours())
+	durationText := fmt.Sprintf("%d-hour", durationHours)
+	if durationHours >= 24 {
+		durationDays := durationHours / 24
+		if durationDays == 1 {
+			durationText = "24-hour"
+		} else {
+			durationText = fmt.Sprintf("%d-day", durationDays)
+		}
+	}
+
+	_, _, err := s.Client.PostMessage(
+		channel,
+		slack.MsgOptionText(fmt.Sprintf("wahoo! your temporary %s email address is %s@%s\n\nto stop receiving emails, delete your 'gib email' message.\n\ni'll post emails in this thread :arrow_down:", durationText, address.ID, address.Domain), false),
+		slack.MsgOptionTS(address.Timestamp),
+	)
+
+	return err
+}
+
+func (s *Slack) EmailReceived(address db.Address, r Received) error {
+	if !s.enabled(address) {
+		return nil
+	}
+
+	if r.Email.Virus != "" {
+		return s.postVirusWarning(address, r)
+	}
+
+	subject := r.Subject
+	if subject == "" {
+		subject = "_no subject_"
+	} else {
+		subject = fmt.Sprintf("subject: *%s*", subject)
+	}
+
+	header := fmt.Sprintf("message from `%s`", r.From)
+	if r.Email.Tag != "" {
+		header += fmt.Sprintf(" tagged `+%s`", r.Email.Tag)
+	}
+	if r.Email.Spam {
+		header = fmt.Sprintf(":warning: *likely spam* (score %.1f)\n%s", r.Email.SpamScore, header)
+	}
+	if r.ConversationSize > 1 {
+		subject += fmt.Sprintf("\n:speech_balloon: message %d in the conversation _%s_", r.ConversationSize, conversationName(r.Conversation))
+	}
+
+	_, _, err := s.Client.PostMessage(
+		s.Channel,
+		slack.MsgOptionDisableLinkUnfurl(),
+		slack.MsgOptionDisableMediaUnfurl(),
+		slack.MsgOptionTS(address.Timestamp),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(
+				slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("%s\n%s", header, util.SanitizeInput(subject)), false, false),
+				nil,
+				nil,
+			),
+			slack.NewDividerBlock(),
+			slack.NewSectionBlock(
+				slack.NewTextBlockObject("mrkdwn", util.SanitizeInput(r.Body), false, false),
+				nil,
+				nil,
+			),
+			emailActions(r.Email.ID),
+			slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("Not rendering properly? Click <%s/%s|here> to view this email in your browser.", os.Getenv("APP_DOMAIN"), r.Email.ID), false, false)),
+		),
+	)
+
+	return err
+}
+
+// postVirusWarning tells the thread an infected email arrived, without the
+// usual buttons so there's no way to download it from Slack
+func (s *Slack) postVirusWarning(address db.Address, r Received) error {
+	text := fmt.Sprintf(
+		":rotating_light: *Quarantined a message from `%s` containing malware* (`%s`)\nsubject: %s\nIts attachments have been disabled; an admin can inspect it from the dashboard.",
+		r.From,
+		r.Email.Virus,
+		r.Subject,
+	)
+
+	_, _, err := s.Client.PostMessage(
+		s.Channel,
+		slack.MsgOptionDisableLinkUnfurl(),
+		slack.MsgOptionDisableMediaUnfurl(),
+		slack.MsgOptionTS(address.Timestamp),
+		slack.MsgOptionText(util.SanitizeInput(text), false),
+	)
+
+	return err
+}
+
+func (s *Slack) Expiring(address db.Address, left time.Duration) error {
+	if !s.enabled(address) {
+		return nil
+	}
+
+	_, _, err := s.Client.PostMessage(
+		s.Channel,
+		slack.MsgOptionText(fmt.Sprintf(":hourglass_flowing_sand: this address expires in %s.", util.FormatDuration(left.Round(time.Minute))), false),
+		slack.MsgOptionTS(address.Timestamp),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(
+				slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf(":hourglass_flowing_sand: heads up! this address expires in %s. need it for longer?", util.FormatDuration(left.Round(time.Minute))), false, false),
+				nil,
+				nil,
+			),
+			ExtendMenu(address.ID),
+		))
+
+	return err
+}
+
+func (s *Slack) Expired(address db.Address) error {
+	if !s.enabled(address) {
+		return nil
+	}
+
+	_, _, err := s.Client.PostMessage(
+		s.Channel,
+		slack.MsgOptionText(":x: :clock1: this address has expired and will no longer receive mail.", false),
+		slack.MsgOptionTS(address.Timestamp),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(
+				slack.NewTextBlockObject(slack.MarkdownType, ":x: :clock1: this address has expired, so it will no longer receive mail. want it back?", false, false),
+				nil,
+				nil,
+			),
+			ExtendMenu(address.ID),
+		))
+	if err != nil {
+		return err
+	}
+
+	if err := s.Client.AddReaction("clock1", slack.ItemRef{
+		Channel:   s.Channel,
+		Timestamp: address.Timestamp,
+	}); err != nil {
+		log.Printf("Error adding expiry reaction for %s: %v", address.ID, err)
+	}
+
+	return nil
+}
+
+// ExtendMenu builds a menu offering to extend an address by each length
+// allowed by policy
+func ExtendMenu(addressID string) *slack.ActionBlock {
+	var options []*slack.OptionBlockObject
+	for _, d := range policy.ExtendOptions() {
+		options = append(options, slack.NewOptionBlockObject(
+			fmt.Sprintf("%s:%d", addressID, int(d.Hours())),
+			slack.NewTextBlockObject(slack.PlainTextType, util.FormatDuration(d), false, false),
+			nil,
+		))
+	}
+
+	return slack.NewActionBlock(
+		"extend",
+		slack.NewOptionsSelectBlockElement(
+			slack.OptTypeStatic,
+			slack.NewTextBlockObject(slack.PlainTextType, "Extend", false, false),
+			ActionExtend,
+			options...,
+		),
+	)
+}
+
+func emailActions(emailID string) *slack.ActionBlock {
+	view := slack.NewButtonBlockElement(ActionViewEmail, emailID, slack.NewTextBlockObject(slack.PlainTextType, "View in browser", false, false))
+	view.URL = fmt.Sprintf("%s/%s", os.Getenv("APP_DOMAIN"), emailID)
+
+	download := slack.NewButtonBlockElement(ActionDownloadEML, emailID, slack.NewTextBlockObject(slack.PlainTextType, "Download .eml", false, false))
+	download.URL = fmt.Sprintf("%s/%s.eml", os.Getenv("APP_DOMAIN"), emailID)
+
+	block := slack.NewButtonBlockElement(ActionBlockSender, emailID, slack.NewTextBlockObject(slack.PlainTextType, "Mark as spam / block sender", false, false))
+	block.Confirm = slack.NewConfirmationBlockObject(
+		slack.NewTextBlockObject(slack.PlainTextType, "Block sender?", false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "Future mail from this sender to this address will be rejected.", false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "Block", false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+	)
+
+	del := slack.NewButtonBlockElement(ActionDeleteEmail, emailID, slack.NewTextBlockObject(slack.PlainTextType, "Delete", false, false)).WithStyle(slack.StyleDanger)
+	del.Confirm = slack.NewConfirmationBlockObject(
+		slack.NewTextBlockObject(slack.PlainTextType, "Delete email?", false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "This removes the email and this message. This cannot be undone.", false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "Delete", false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+	)
+
+	return slack.NewActionBlock(
+		"email_actions",
+		view,
+		slack.NewButtonBlockElement(ActionReplyEmail, emailID, slack.NewTextBlockObject(slack.PlainTextType, "Reply", false, false)),
+		slack.NewButtonBlockElement(ActionShowHeaders, emailID, slack.NewTextBlockObject(slack.PlainTextType, "Show raw headers", false, false)),
+		download,
+		block,
+		del,
+	)
+}
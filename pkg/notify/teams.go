@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+)
+
+// Teams posts a message card to an incoming webhook
+type Teams struct {
+	HTTP *http.Client
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsCard struct {
+	Type            string        `json:"@type"`
+	Context         string        `json:"@context"`
+	Summary         string        `json:"summary"`
+	Title           string        `json:"title"`
+	Text            string        `json:"text"`
+	PotentialAction []teamsAction `json:"potentialAction,omitempty"`
+}
+
+func (t *Teams) Post(address db.Address, m Message) error {
+	card := teamsCard{
+		Type:    "MessageCard",
+		Context: "https://schema.org/extensions",
+		Summary: m.Title,
+		Title:   m.Title,
+		// Card text is markdown, where a single newline doesn't break the
+		// line
+		Text: strings.ReplaceAll(m.Text, "\n", "\n\n"),
+	}
+
+	if m.URL != "" {
+		card.PotentialAction = []teamsAction{{
+			Type:    "OpenUri",
+			Name:    "View email",
+			Targets: []teamsTarget{{OS: "default", URI: m.URL}},
+		}}
+	}
+
+	return sendJSON(t.HTTP, http.MethodPost, address.NotifyTarget, nil, card)
+}
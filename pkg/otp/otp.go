@@ -0,0 +1,93 @@
+package otp
+
+import (
+	"regexp"
+	"strings"
+)
+
+// labelled matches a code straight after the word introducing it, as in
+// "code: 123456" or "Your code is A7K9Q2"
+var labelled = regexp.MustCompile(`(?i)\b(?:code|otp|passcode|pin)(?:\s+is)?\s*[:\-]?\s*(\d{3}[ -]\d{3}|[a-z0-9]{4,10})\b`)
+
+// pattern matches a 4 to 8 digit code, or two groups of three split by a
+// space or dash like "123 456"
+var pattern = regexp.MustCompile(`\b(\d{3}[ -]\d{3}|\d{4,8})\b`)
+
+// reference matches text that introduces an order, invoice or similar
+// number rather than a code
+var reference = regexp.MustCompile(`(?i)\b(?:order|invoice|receipt|ref|reference|tracking|account|ticket|case)\s*(?:no\.?|number|#)?\s*:?\s*$`)
+
+// Words that show up near one-time codes
+var keywords = []string{"code", "otp", "one-time", "one time", "passcode", "verification", "verify", "confirm", "pin", "2fa", "sign in", "log in", "login"}
+
+// Extract finds a one-time code in an email, looking at the subject
+// before the body. A code right after "code", "OTP" and the like wins, and
+// may contain letters. Otherwise only text that mentions a code is searched
+// for a number, skipping years and anything that's part of a date, phone
+// number or order number. It returns "" if there's no code.
+func Extract(subject, text string) string {
+	for _, source := range []string{subject, text} {
+		for _, match := range labelled.FindAllStringSubmatch(source, -1) {
+			if strings.ContainsAny(match[1], "0123456789") {
+				return compact(match[1])
+			}
+		}
+	}
+
+	for _, source := range []string{subject, text} {
+		lower := strings.ToLower(source)
+
+		mentioned := false
+		for _, keyword := range keywords {
+			if strings.Contains(lower, keyword) {
+				mentioned = true
+				break
+			}
+		}
+		if !mentioned {
+			continue
+		}
+
+		for _, loc := range pattern.FindAllStringIndex(source, -1) {
+			match := source[loc[0]:loc[1]]
+			if len(match) == 4 && (strings.HasPrefix(match, "19") || strings.HasPrefix(match, "20")) {
+				continue
+			}
+			if !standalone(source, loc[0], loc[1]) {
+				continue
+			}
+
+			return compact(match)
+		}
+	}
+
+	return ""
+}
+
+// standalone reports whether the number at source[start:end] stands on its
+// own, rather than being one group of a date, time or phone number, or an
+// order number
+func standalone(source string, start, end int) bool {
+	if start > 0 && strings.ContainsRune("#+()", rune(source[start-1])) {
+		return false
+	}
+
+	// Another group of digits joined on by a separator
+	if start > 1 && strings.ContainsRune(" -./:", rune(source[start-1])) && isDigitOrParen(source[start-2]) {
+		return false
+	}
+	if end+1 < len(source) && strings.ContainsRune(" -./:", rune(source[end])) && isDigitOrParen(source[end+1]) {
+		return false
+	}
+
+	return !reference.MatchString(source[:start])
+}
+
+func isDigitOrParen(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '(' || c == ')'
+}
+
+// compact drops the separator from a split code like "123-456"
+func compact(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
@@ -0,0 +1,41 @@
+package otp
+
+import "testing"
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name          string
+		subject, text string
+		want          string
+	}{
+		{"labelled", "Sign in", "code: 123456", "123456"},
+		{"in the subject", "Your verification code is 482913", "Enter it to continue.", "482913"},
+		{"subject before body", "Code 111111", "code: 222222", "111111"},
+		{"split with a dash", "", "Your login code is 123-456.", "123456"},
+		{"split with a space", "", "Enter 123 456 to verify your email.", "123456"},
+		{"alphanumeric", "", "Your code is A7K9Q2", "A7K9Q2"},
+		{"alphanumeric OTP", "", "OTP: x9f3k2 (valid for 10 minutes)", "x9f3k2"},
+		{"four digits", "", "Your PIN is 4821", "4821"},
+		{"after an order number", "", "Order 99887766 confirmed. Your code is 5531", "5531"},
+		{"unlabelled", "", "Use 739104 to verify your account.", "739104"},
+		{"label without a code", "", "Use the code below to sign in:\n\n739104", "739104"},
+
+		{"no mention of a code", "Your receipt", "You paid 4999 cents.", ""},
+		{"year", "", "Verify your account. © 2024 Example Inc.", ""},
+		{"ISO date", "", "Please confirm your booking for 2024-03-15.", ""},
+		{"slashed date", "", "Please confirm by 15/03/2031.", ""},
+		{"compact date", "", "Verify your email by 15.03.2031", ""},
+		{"order number", "", "Please confirm your order 12345678.", ""},
+		{"hashed order number", "", "Confirm order #558812", ""},
+		{"invoice number", "", "To verify, quote invoice no. 771234.", ""},
+		{"phone number", "", "Call 555-123-4567 to verify your account.", ""},
+		{"phone number with area code", "", "To confirm, call (555) 123 4567.", ""},
+		{"international phone number", "", "Questions? Call +44 20 7946 0958 to confirm.", ""},
+		{"word after the label", "", "Your code expires in 10 minutes.", ""},
+	}
+	for _, tt := range tests {
+		if got := Extract(tt.subject, tt.text); got != tt.want {
+			t.Errorf("%s: Extract(%q, %q) = %q, want %q", tt.name, tt.subject, tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package outbound
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Transport sends a complete message to the given recipients. from is the
+// envelope sender, which may be empty for bounces.
+type Transport interface {
+	Send(from string, to []string, message []byte) error
+}
+
+// SMTP sends through a relay, using STARTTLS when the relay offers it
+type SMTP struct {
+	Addr     string
+	Username string
+	Password string
+}
+
+func (s *SMTP) Send(from string, to []string, message []byte) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	return smtp.SendMail(s.Addr, auth, from, to, message)
+}
+
+// FromEnv returns the relay configured with SMTP_RELAY_ADDR (host:port),
+// SMTP_RELAY_USERNAME and SMTP_RELAY_PASSWORD, or nil if there isn't one
+func FromEnv() Transport {
+	addr := os.Getenv("SMTP_RELAY_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	return &SMTP{
+		Addr:     addr,
+		Username: os.Getenv("SMTP_RELAY_USERNAME"),
+		Password: os.Getenv("SMTP_RELAY_PASSWORD"),
+	}
+}
+
+// Mailgun sends through Mailgun's messages API. Mailgun picks the envelope
+// sender itself, so it can't be used for forwarding or bounces.
+type Mailgun struct {
+	APIKey string
+	// Domain is the Mailgun sending domain messages are sent through
+	Domain string
+	// APIBase defaults to https://api.mailgun.net; EU accounts use
+	// https://api.eu.mailgun.net
+	APIBase string
+	Client  *http.Client
+}
+
+var defaultHTTP = &http.Client{Timeout: 30 * time.Second}
+
+func (m *Mailgun) Send(from string, to []string, message []byte) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, rcpt := range to {
+		form.WriteField("to", rcpt)
+	}
+	part, err := form.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return err
+	}
+	part.Write(message)
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	base := m.APIBase
+	if base == "" {
+		base = "https://api.mailgun.net"
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v3/%s/messages.mime", strings.TrimSuffix(base, "/"), m.Domain), &body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("api", m.APIKey)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	client := m.Client
+	if client == nil {
+		client = defaultHTTP
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		reply, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("mailgun responded %s: %s", res.Status, strings.TrimSpace(string(reply)))
+	}
+
+	return nil
+}
+
+// MailgunFromEnv returns a Mailgun transport configured with
+// MAILGUN_API_KEY, MAILGUN_DOMAIN and MAILGUN_API_BASE, or nil if the key or
+// domain isn't set
+func MailgunFromEnv() Transport {
+	key, domain := os.Getenv("MAILGUN_API_KEY"), os.Getenv("MAILGUN_DOMAIN")
+	if key == "" || domain == "" {
+		return nil
+	}
+
+	return &Mailgun{
+		APIKey:  key,
+		Domain:  domain,
+		APIBase: os.Getenv("MAILGUN_API_BASE"),
+	}
+}
+
+// Default returns the transport composed mail is sent through, chosen with
+// OUTBOUND_TRANSPORT ("smtp" or "mailgun"). Left unset, the SMTP relay is
+// used if there is one, then Mailgun. It's nil if neither is configured.
+func Default() Transport {
+	switch strings.ToLower(os.Getenv("OUTBOUND_TRANSPORT")) {
+	case "smtp":
+		return FromEnv()
+	case "mailgun":
+		return MailgunFromEnv()
+	}
+
+	if t := FromEnv(); t != nil {
+		return t
+	}
+
+	return MailgunFromEnv()
+}
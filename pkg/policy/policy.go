@@ -0,0 +1,187 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/util"
+)
+
+// Lengths offered by the Slack Extend menu
+var extendOptions = []time.Duration{
+	time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// Error is a policy violation, worded to be shown to the user as-is
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func violation(format string, a ...interface{}) error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// envInt reads a limit from an environment variable, falling back to def if
+// it isn't set. Zero means no limit.
+func envInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return def
+	}
+
+	return value
+}
+
+// MaxTTL is the longest an address may stay active, set with MAX_TTL_HOURS
+// (default 336, two weeks)
+func MaxTTL() time.Duration {
+	return time.Duration(envInt("MAX_TTL_HOURS", 336)) * time.Hour
+}
+
+// MaxExtension is the longest single extension a user may ask for, set with
+// MAX_EXTEND_HOURS. Zero means no limit.
+func MaxExtension() time.Duration {
+	return time.Duration(envInt("MAX_EXTEND_HOURS", 0)) * time.Hour
+}
+
+// ExtendOptions returns the extension lengths users may choose from
+func ExtendOptions() []time.Duration {
+	max := MaxExtension()
+	if ttl := MaxTTL(); ttl != 0 && (max == 0 || ttl < max) {
+		max = ttl
+	}
+
+	var options []time.Duration
+	for _, d := range extendOptions {
+		if max == 0 || d <= max {
+			options = append(options, d)
+		}
+	}
+
+	return options
+}
+
+// AllowedExtension reports whether d is one of the offered extension lengths
+func AllowedExtension(d time.Duration) bool {
+	for _, option := range ExtendOptions() {
+		if option == d {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseTTL reads a lifetime such as "36h" or "3d", reporting false if spec
+// isn't one or is too long to represent
+func ParseTTL(spec string) (time.Duration, bool) {
+	if days := strings.TrimSuffix(spec, "d"); days != spec && days != "" {
+		d, err := time.ParseDuration(days + "h")
+		if err != nil || d > math.MaxInt64/24 || d < math.MinInt64/24 {
+			return 0, false
+		}
+		return d * 24, true
+	}
+
+	if strings.HasSuffix(spec, "h") {
+		d, err := time.ParseDuration(spec)
+		return d, err == nil
+	}
+
+	return 0, false
+}
+
+// CheckTTL enforces the lifetime limits for a new address
+func CheckTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return violation("addresses need to last for some time.")
+	}
+
+	if max := MaxTTL(); max != 0 && ttl > max {
+		return violation("addresses can last at most %s.", util.FormatDuration(max))
+	}
+
+	return nil
+}
+
+// CheckCreate enforces the TTL and creation quotas for a new address. channel
+// is the Slack channel it was requested in, or empty outside of Slack.
+func CheckCreate(addresses store.AddressStore, user, channel string, ttl time.Duration) error {
+	if err := CheckTTL(ttl); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if max := envInt("MAX_ACTIVE_PER_USER", 10); max != 0 {
+		active, err := addresses.CountActiveByUser(user, now)
+		if err != nil {
+			return err
+		}
+
+		if active >= int64(max) {
+			return violation("you already have %d active addresses, which is the limit. delete one to make room.", active)
+		}
+	}
+
+	if max := envInt("MAX_CREATIONS_PER_HOUR", 10); max != 0 {
+		created, err := addresses.CountCreatedByUser(user, now.Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+
+		if created >= int64(max) {
+			return violation("you've created %d addresses in the last hour, which is the limit. try again later.", created)
+		}
+	}
+
+	if max := envInt("MAX_CHANNEL_CREATIONS_PER_HOUR", 0); max != 0 && channel != "" {
+		created, err := addresses.CountCreatedInChannel(channel, now.Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+
+		if created >= int64(max) {
+			return violation("this channel has created %d addresses in the last hour, which is the limit. try again later.", created)
+		}
+	}
+
+	return nil
+}
+
+// CheckExtend enforces the reactivation quota and TTL for extending an
+// address by d
+func CheckExtend(address db.Address, d time.Duration) error {
+	if !AllowedExtension(d) {
+		return violation("addresses can't be extended by %s.", util.FormatDuration(d))
+	}
+
+	if max := envInt("MAX_REACTIVATIONS", 10); max != 0 && address.Reactivations >= max {
+		return violation("this address has already been extended %d times, which is the limit.", address.Reactivations)
+	}
+
+	now := time.Now()
+
+	expiresAt := now.Add(d)
+	if address.ExpiresAt.After(now) {
+		expiresAt = address.ExpiresAt.Add(d)
+	}
+
+	if max := MaxTTL(); max != 0 && expiresAt.Sub(now) > max {
+		return violation("addresses can last at most %s from now.", util.FormatDuration(max))
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		spec string
+		want time.Duration
+		ok   bool
+	}{
+		{"36h", 36 * time.Hour, true},
+		{"1.5h", 90 * time.Minute, true},
+		{"3d", 72 * time.Hour, true},
+		{"-5h", -5 * time.Hour, true},
+		{"h", 0, false},
+		{"d", 0, false},
+		{"email", 0, false},
+		{"tomorrowh", 0, false},
+		// Big enough in days to wrap around to a negative duration
+		{"100000000d", 0, false},
+		{"99999999999999999999h", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseTTL(tt.spec)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseTTL(%q) = %s, %v, want %s, %v", tt.spec, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCheckTTL(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxTTL string
+		ttl    time.Duration
+		ok     bool
+	}{
+		{"default max", "", 336 * time.Hour, true},
+		{"over default max", "", 337 * time.Hour, false},
+		{"zero", "", 0, false},
+		{"negative", "", -5 * time.Hour, false},
+		{"lowered max", "2", 3 * time.Hour, false},
+		{"no max", "0", math.MaxInt64, true},
+		{"no max still needs a lifetime", "0", -time.Hour, false},
+		{"bad setting uses default", "lots", 337 * time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_TTL_HOURS", tt.maxTTL)
+			err := CheckTTL(tt.ttl)
+			if (err == nil) != tt.ok {
+				t.Errorf("CheckTTL(%s) = %v, want ok %v", tt.ttl, err, tt.ok)
+			}
+			if _, isViolation := err.(*Error); err != nil && !isViolation {
+				t.Errorf("CheckTTL(%s) = %T, want a *Error", tt.ttl, err)
+			}
+		})
+	}
+}
+
+// seedCreated stores n addresses for user in channel, created the given time
+// ago and expiring expiresIn from now
+func seedCreated(t *testing.T, addresses store.AddressStore, user, channel string, n int, ago, expiresIn time.Duration) {
+	t.Helper()
+
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		address := db.Address{User: user, Channel: channel, CreatedAt: now.Add(-ago), ExpiresAt: now.Add(expiresIn)}
+		id := fmt.Sprintf("%s-%s-%d", user, channel, i)
+		if err := addresses.Create(&address, func() string { return id }); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckCreateQuotas(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		seed func(t *testing.T, addresses store.AddressStore)
+		ok   bool
+	}{
+		{
+			name: "under every limit",
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U1", "C1", 9, 2*time.Hour, time.Hour) },
+			ok:   true,
+		},
+		{
+			name: "too many active",
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U1", "C1", 10, 2*time.Hour, time.Hour) },
+		},
+		{
+			name: "expired addresses don't count as active",
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U1", "C1", 10, 2*time.Hour, -time.Minute) },
+			ok:   true,
+		},
+		{
+			name: "other users' addresses don't count",
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U2", "C2", 20, 2*time.Hour, time.Hour) },
+			ok:   true,
+		},
+		{
+			name: "active limit raised",
+			env:  map[string]string{"MAX_ACTIVE_PER_USER": "11"},
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U1", "C1", 10, 2*time.Hour, time.Hour) },
+			ok:   true,
+		},
+		{
+			name: "active limit off",
+			env:  map[string]string{"MAX_ACTIVE_PER_USER": "0"},
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U1", "C1", 50, 2*time.Hour, time.Hour) },
+			ok:   true,
+		},
+		{
+			name: "too many this hour",
+			env:  map[string]string{"MAX_ACTIVE_PER_USER": "0"},
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U1", "C1", 10, time.Minute, -time.Minute) },
+		},
+		{
+			name: "hourly limit lowered",
+			env:  map[string]string{"MAX_CREATIONS_PER_HOUR": "2"},
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U1", "C1", 2, time.Minute, time.Hour) },
+		},
+		{
+			name: "hourly limit off",
+			env:  map[string]string{"MAX_ACTIVE_PER_USER": "0", "MAX_CREATIONS_PER_HOUR": "0"},
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U1", "C1", 30, time.Minute, time.Hour) },
+			ok:   true,
+		},
+		{
+			name: "channel limit is off by default",
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U2", "C1", 30, time.Minute, time.Hour) },
+			ok:   true,
+		},
+		{
+			name: "channel limit",
+			env:  map[string]string{"MAX_CHANNEL_CREATIONS_PER_HOUR": "3"},
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U2", "C1", 3, time.Minute, time.Hour) },
+		},
+		{
+			name: "channel limit only counts its channel",
+			env:  map[string]string{"MAX_CHANNEL_CREATIONS_PER_HOUR": "3"},
+			seed: func(t *testing.T, a store.AddressStore) { seedCreated(t, a, "U2", "C2", 3, time.Minute, time.Hour) },
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"MAX_TTL_HOURS", "MAX_ACTIVE_PER_USER", "MAX_CREATIONS_PER_HOUR", "MAX_CHANNEL_CREATIONS_PER_HOUR"} {
+				t.Setenv(key, tt.env[key])
+			}
+			addresses := store.NewMemoryAddresses()
+			tt.seed(t, addresses)
+
+			err := CheckCreate(addresses, "U1", "C1", 24*time.Hour)
+			if (err == nil) != tt.ok {
+				t.Errorf("CheckCreate = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCheckCreateChecksTTLFirst(t *testing.T) {
+	if err := CheckCreate(store.NewMemoryAddresses(), "U1", "", -5*time.Hour); err == nil {
+		t.Error("CheckCreate accepted a negative TTL")
+	}
+}
+
+func TestExtendOptions(t *testing.T) {
+	tests := []struct {
+		maxExtend, maxTTL string
+		want              []time.Duration
+	}{
+		{"", "", []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}},
+		{"24", "", []time.Duration{time.Hour, 24 * time.Hour}},
+		{"", "12", []time.Duration{time.Hour}},
+		{"0", "0", []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("MAX_EXTEND_HOURS", tt.maxExtend)
+		t.Setenv("MAX_TTL_HOURS", tt.maxTTL)
+
+		got := ExtendOptions()
+		if len(got) != len(tt.want) {
+			t.Errorf("ExtendOptions with MAX_EXTEND_HOURS=%q MAX_TTL_HOURS=%q = %v, want %v", tt.maxExtend, tt.maxTTL, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ExtendOptions with MAX_EXTEND_HOURS=%q MAX_TTL_HOURS=%q = %v, want %v", tt.maxExtend, tt.maxTTL, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestCheckExtend(t *testing.T) {
+	now := time.Now()
+	active := db.Address{ExpiresAt: now.Add(time.Hour)}
+	expired := db.Address{ExpiresAt: now.Add(-time.Hour)}
+	worn := db.Address{ExpiresAt: now.Add(time.Hour), Reactivations: 10}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		address db.Address
+		d       time.Duration
+		ok      bool
+	}{
+		{"offered length", nil, active, 24 * time.Hour, true},
+		{"length not offered", nil, active, 2 * time.Hour, false},
+		{"extension limit", map[string]string{"MAX_EXTEND_HOURS": "1"}, active, 24 * time.Hour, false},
+		{"reactivation limit", nil, worn, time.Hour, false},
+		{"reactivation limit raised", map[string]string{"MAX_REACTIVATIONS": "11"}, worn, time.Hour, true},
+		{"reactivation limit off", map[string]string{"MAX_REACTIVATIONS": "0"}, worn, time.Hour, true},
+		// A week on top of the 7 days left is past the 8 day max
+		{"past max TTL", map[string]string{"MAX_TTL_HOURS": "192"}, db.Address{ExpiresAt: now.Add(7 * 24 * time.Hour)}, 7 * 24 * time.Hour, false},
+		// but an expired address only gets the week from now
+		{"expired starts from now", map[string]string{"MAX_TTL_HOURS": "192"}, expired, 7 * 24 * time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"MAX_TTL_HOURS", "MAX_EXTEND_HOURS", "MAX_REACTIVATIONS"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			err := CheckExtend(tt.address, tt.d)
+			if (err == nil) != tt.ok {
+				t.Errorf("CheckExtend(%s) = %v, want ok %v", tt.d, err, tt.ok)
+			}
+		})
+	}
+}
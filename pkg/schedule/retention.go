@@ -0,0 +1,136 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+// envInt reads a non-negative number from the environment, falling back to
+// def if it isn't set
+func envInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return def
+	}
+
+	return value
+}
+
+// retentionDays is how long an address and its mail are kept after expiry,
+// set with RETENTION_DAYS (default 30, 0 keeps everything forever).
+// Addresses can override it with their own RetentionDays.
+func retentionDays(address db.Address) int {
+	if address.RetentionDays != nil {
+		return *address.RetentionDays
+	}
+
+	return envInt("RETENTION_DAYS", 30)
+}
+
+// purgeStats counts what a purge run removed (or would have)
+type purgeStats struct {
+	Addresses int64
+	Emails    int64
+	Blocked   int64
+}
+
+// purgeExpired deletes addresses, along with their emails (raw MIME and
+// attachments included), sender rules, blocked mail log, forwards, webhooks
+// and webhook deliveries, once they've been expired for longer than their
+// retention period. Emails are deleted in batches of RETENTION_BATCH_SIZE
+// (default 500). With RETENTION_DRY_RUN set it only counts what it would
+// delete. It returns what it removed.
+func purgeExpired(stores store.Stores) purgeStats {
+	now := time.Now()
+	dryRun, _ := strconv.ParseBool(os.Getenv("RETENTION_DRY_RUN"))
+	batchSize := envInt("RETENTION_BATCH_SIZE", 500)
+	if batchSize == 0 {
+		batchSize = 500
+	}
+
+	expired, err := stores.Addresses.ExpiredBefore(now)
+	if err != nil {
+		fmt.Println(err)
+		return purgeStats{}
+	}
+
+	var stats purgeStats
+	for _, address := range expired {
+		days := retentionDays(address)
+		if days == 0 || address.ExpiresAt.AddDate(0, 0, days).After(now) {
+			continue
+		}
+
+		if err := purgeAddress(stores, address, batchSize, dryRun, &stats); err != nil {
+			fmt.Printf("Retention purge failed for %s: %v\n", address.ID, err)
+			break
+		}
+	}
+
+	verb := "Purged"
+	if dryRun {
+		verb = "Dry run: would purge"
+	}
+	fmt.Printf("%s %d addresses, %d emails and %d blocked mail records past retention\n", verb, stats.Addresses, stats.Emails, stats.Blocked)
+
+	return stats
+}
+
+func purgeAddress(stores store.Stores, address db.Address, batchSize int, dryRun bool, stats *purgeStats) error {
+	if dryRun {
+		emails, err := stores.Emails.CountFor(address.ID)
+		if err != nil {
+			return err
+		}
+		blocked, err := stores.Senders.CountBlocked(address.ID)
+		if err != nil {
+			return err
+		}
+
+		stats.Addresses++
+		stats.Emails += emails
+		stats.Blocked += blocked
+		return nil
+	}
+
+	// Deliveries carry a copy of each email, and are found through the
+	// emails, so they go first
+	if err := stores.Webhooks.DeleteFor(address.ID); err != nil {
+		return err
+	}
+
+	// Emails hold the raw message, so delete them a batch at a time to keep
+	// each statement small
+	for {
+		deleted, err := stores.Emails.DeleteFor(address.ID, batchSize)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			break
+		}
+		stats.Emails += deleted
+	}
+
+	blocked, err := stores.Senders.DeleteFor(address.ID)
+	if err != nil {
+		return err
+	}
+	stats.Blocked += blocked
+
+	if err := stores.Forwards.DeleteFor(address.ID); err != nil {
+		return err
+	}
+
+	if err := stores.Addresses.Delete(address.ID); err != nil {
+		return err
+	}
+	stats.Addresses++
+
+	return nil
+}
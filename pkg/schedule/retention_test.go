@@ -0,0 +1,124 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/util"
+)
+
+// seedRetention stores three addresses, each with two emails, a sender rule,
+// a blocked mail record, a forward and a webhook, with each email delivered
+// to both its own and a global webhook: stale expired 40 days ago, recent
+// expired yesterday and kept expired 40 days ago but is kept forever
+func seedRetention(t *testing.T) store.Stores {
+	t.Helper()
+
+	stores := store.Memory()
+	now := time.Now()
+	forever := 0
+	global := db.Webhook{URL: "https://hooks.example/all"}
+	stores.Webhooks.Create(&global)
+
+	for _, address := range []db.Address{
+		{ID: "stale", ExpiresAt: now.AddDate(0, 0, -40)},
+		{ID: "recent", ExpiresAt: now.AddDate(0, 0, -1)},
+		{ID: "kept", ExpiresAt: now.AddDate(0, 0, -40), RetentionDays: &forever},
+	} {
+		address := address
+		if err := stores.Addresses.Save(&address); err != nil {
+			t.Fatal(err)
+		}
+
+		hook := db.Webhook{AddressID: address.ID, URL: "https://hooks.example/" + address.ID}
+		stores.Webhooks.Create(&hook)
+
+		for i := 0; i < 2; i++ {
+			email := db.Email{AddressID: address.ID, CreatedAt: address.ExpiresAt}
+			if err := stores.Emails.Create(&email, util.GenerateEmailID); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []uint{global.ID, hook.ID} {
+				stores.Webhooks.CreateDelivery(&db.WebhookDelivery{WebhookID: id, EmailID: email.ID, Payload: address.ID})
+			}
+		}
+		stores.Senders.AddRule(&db.SenderRule{AddressID: address.ID, Pattern: "spam.example"})
+		stores.Senders.LogBlocked(&db.BlockedEmail{AddressID: address.ID, Sender: "a@spam.example"})
+		stores.Forwards.Create(&db.ForwardRule{AddressID: address.ID, Destination: "me@example.com"})
+	}
+
+	return stores
+}
+
+func TestPurgeExpiredDeletesPastRetention(t *testing.T) {
+	t.Setenv("RETENTION_DAYS", "30")
+	t.Setenv("RETENTION_BATCH_SIZE", "1")
+	stores := seedRetention(t)
+
+	stats := purgeExpired(stores)
+	if stats != (purgeStats{Addresses: 1, Emails: 2, Blocked: 1}) {
+		t.Errorf("purgeExpired = %+v, want 1 address, 2 emails and 1 blocked record", stats)
+	}
+
+	if _, err := stores.Addresses.Get("stale"); err != store.ErrNotFound {
+		t.Errorf("stale address still there (err %v)", err)
+	}
+	if count, _ := stores.Emails.CountFor("stale"); count != 0 {
+		t.Errorf("stale address still has %d emails", count)
+	}
+	if rules, _ := stores.Senders.Rules("stale"); len(rules) != 0 {
+		t.Errorf("stale address still has sender rules %+v", rules)
+	}
+	if forwards, _ := stores.Forwards.List("stale"); len(forwards) != 0 {
+		t.Errorf("stale address still has forwards %+v", forwards)
+	}
+
+	hooks, _ := stores.Webhooks.List()
+	if len(hooks) != 3 {
+		t.Errorf("webhooks left = %+v, want the global one, recent's and kept's", hooks)
+	}
+	for _, hook := range hooks {
+		if hook.AddressID == "stale" {
+			t.Errorf("stale address still has webhook %+v", hook)
+		}
+	}
+	// The global webhook keeps only the deliveries of the other addresses
+	deliveries, _ := stores.Webhooks.Deliveries(hooks[0].ID, 10)
+	for _, d := range deliveries {
+		if d.Payload == "stale" {
+			t.Errorf("stale address's email is still queued for the global webhook: %+v", d)
+		}
+	}
+	if len(deliveries) != 4 {
+		t.Errorf("global webhook has %d deliveries, want 4", len(deliveries))
+	}
+
+	for _, id := range []string{"recent", "kept"} {
+		if _, err := stores.Addresses.Get(id); err != nil {
+			t.Errorf("%s address was purged", id)
+		}
+		if count, _ := stores.Emails.CountFor(id); count != 2 {
+			t.Errorf("%s address has %d emails, want 2", id, count)
+		}
+	}
+}
+
+func TestPurgeExpiredDryRunOnlyCounts(t *testing.T) {
+	t.Setenv("RETENTION_DAYS", "30")
+	t.Setenv("RETENTION_DRY_RUN", "true")
+	stores := seedRetention(t)
+
+	stats := purgeExpired(stores)
+	if stats != (purgeStats{Addresses: 1, Emails: 2, Blocked: 1}) {
+		t.Errorf("purgeExpired = %+v, want 1 address, 2 emails and 1 blocked record", stats)
+	}
+
+	if _, err := stores.Addresses.Get("stale"); err != nil {
+		t.Errorf("dry run deleted the stale address (err %v)", err)
+	}
+	if count, _ := stores.Emails.CountFor("stale"); count != 2 {
+		t.Errorf("dry run left %d of the stale address's emails, want 2", count)
+	}
+}
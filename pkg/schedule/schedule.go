@@ -3,58 +3,104 @@ package schedule
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
-	"github.com/cjdenio/temp-email/pkg/db"
-	"github.com/cjdenio/temp-email/pkg/slackevents"
+	"github.com/cjdenio/temp-email/pkg/blocklist"
+	"github.com/cjdenio/temp-email/pkg/domains"
+	"github.com/cjdenio/temp-email/pkg/notify"
+	"github.com/cjdenio/temp-email/pkg/store"
 	"github.com/go-co-op/gocron"
-	"github.com/slack-go/slack"
 )
 
-func Start() {
+// expiryWarning is how long before expiry owners are warned, set with
+// EXPIRY_WARNING_MINUTES (default 60, 0 disables the warning)
+func expiryWarning() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("EXPIRY_WARNING_MINUTES"))
+	if err != nil || minutes < 0 {
+		minutes = 60
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// warnExpiring warns the owners of addresses that expire within the warning
+// period, once per address
+func warnExpiring(addresses store.AddressStore, now time.Time) {
+	warning := expiryWarning()
+	if warning == 0 {
+		return
+	}
+
+	expiring, err := addresses.ExpiringBetween(now, now.Add(warning))
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	for _, e := range expiring {
+		if err := notify.For(e).Expiring(e, e.ExpiresAt.Sub(now)); err != nil {
+			fmt.Println(err.Error())
+		}
+
+		e.WarningSent = true
+		addresses.Save(&e)
+	}
+}
+
+// announceExpired tells the owners of newly expired addresses, once per
+// address
+func announceExpired(addresses store.AddressStore, now time.Time) {
+	emails, err := addresses.ExpiredUnnotified(now)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	if len(emails) > 0 {
+		fmt.Printf("Found %d newly expired addresses\n", len(emails))
+	}
+
+	for _, e := range emails {
+		if err := notify.For(e).Expired(e); err != nil {
+			fmt.Println(err.Error())
+		}
+
+		e.ExpiredMessageSent = true
+		addresses.Save(&e)
+	}
+}
+
+func Start(stores store.Stores) {
 	scheduler := gocron.NewScheduler(time.UTC)
 
-	scheduler.Every(30).Minutes().Tag("expiry notification").Do(func() {
-		fmt.Println("Checking for expired addresses...")
+	scheduler.Every(1).Minute().Tag("expiry warning").Do(func() {
+		warnExpiring(stores.Addresses, time.Now())
+	})
+
+	scheduler.Every(1).Minute().Tag("expiry notification").Do(func() {
+		announceExpired(stores.Addresses, time.Now())
+	})
 
-		var emails []db.Address
-		tx := db.DB.Where("expires_at < NOW() AND NOT expired_message_sent").Find(&emails)
-		if tx.Error != nil {
-			fmt.Println(tx.Error)
+	scheduler.Every(1).Hour().Tag("seen event cleanup").Do(func() {
+		// Slack gives up retrying an event well within a day
+		if err := stores.Events.Prune(time.Now().Add(-24 * time.Hour)); err != nil {
+			fmt.Println(err)
 		}
+	})
+
+	scheduler.Every(10).Minutes().Tag("domain verification").Do(func() {
+		domains.VerifyPending(stores.Domains, domains.DefaultResolver())
+	})
 
-		fmt.Println(len(emails))
-
-		for _, e := range emails {
-			// Only send if we have a timestamp (address was created via Slack)
-			if e.Timestamp != "" {
-				_, _, err := slackevents.Client.PostMessage(
-					os.Getenv("SLACK_CHANNEL"),
-					slack.MsgOptionText(":x: :clock1: it's been 24 hours, so this address will no longer receive mail.", false),
-					slack.MsgOptionTS(e.Timestamp),
-					slack.MsgOptionBlocks(
-						slack.NewActionBlock(
-							"reactivate",
-							slack.NewButtonBlockElement(
-								"reactivate",
-								e.ID,
-								slack.NewTextBlockObject(slack.PlainTextType, "Get another 24 hours", false, false),
-							).WithStyle(slack.StylePrimary),
-						),
-					))
-				if err != nil {
-					fmt.Println(err.Error())
-				}
-				slackevents.Client.AddReaction("clock1", slack.ItemRef{
-					Channel:   os.Getenv("SLACK_CHANNEL"),
-					Timestamp: e.Timestamp,
-				})
-			}
-
-			e.ExpiredMessageSent = true
-			db.DB.Save(&e)
+	scheduler.Every(1).Minute().Tag("blocklist reload").Do(func() {
+		// Edits on this instance reload straight away; this picks up the rest
+		if err := blocklist.Reload(stores.GlobalRules); err != nil {
+			fmt.Println(err)
 		}
 	})
 
+	scheduler.Every(1).Hour().Tag("retention purge").Do(func() {
+		purgeExpired(stores)
+	})
+
 	scheduler.StartAsync()
 }
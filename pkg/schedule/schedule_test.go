@@ -0,0 +1,112 @@
+package schedule
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/notify"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+// recorder is a notifier that remembers which addresses it was told about
+type recorder struct {
+	mu       sync.Mutex
+	expiring []string
+	expired  []string
+}
+
+func (r *recorder) AddressCreated(db.Address) error                 { return nil }
+func (r *recorder) EmailReceived(db.Address, notify.Received) error { return nil }
+
+func (r *recorder) Expiring(address db.Address, _ time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expiring = append(r.expiring, address.ID)
+	return nil
+}
+
+func (r *recorder) Expired(address db.Address) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expired = append(r.expired, address.ID)
+	return nil
+}
+
+// newRecorder registers a fresh recorder as the "test" notifier
+func newRecorder() *recorder {
+	rec := &recorder{}
+	notify.Register("test", rec)
+
+	return rec
+}
+
+func saveAddresses(t *testing.T, addresses store.AddressStore, expiries map[string]time.Time) {
+	t.Helper()
+
+	for id, expiresAt := range expiries {
+		address := db.Address{ID: id, CreatedAt: expiresAt.Add(-time.Hour), ExpiresAt: expiresAt, Notifier: "test"}
+		if err := addresses.Save(&address); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWarnExpiringWarnsOnce(t *testing.T) {
+	t.Setenv("EXPIRY_WARNING_MINUTES", "30")
+	rec := newRecorder()
+	addresses := store.NewMemoryAddresses()
+	now := time.Now()
+	saveAddresses(t, addresses, map[string]time.Time{
+		"soon":    now.Add(10 * time.Minute),
+		"later":   now.Add(2 * time.Hour),
+		"expired": now.Add(-time.Minute),
+	})
+
+	warnExpiring(addresses, now)
+	warnExpiring(addresses, now.Add(time.Minute))
+
+	if len(rec.expiring) != 1 || rec.expiring[0] != "soon" {
+		t.Errorf("warned %v, want [soon] once", rec.expiring)
+	}
+	if address, _ := addresses.Get("soon"); !address.WarningSent {
+		t.Error("WarningSent wasn't recorded")
+	}
+}
+
+func TestWarnExpiringCanBeDisabled(t *testing.T) {
+	t.Setenv("EXPIRY_WARNING_MINUTES", "0")
+	rec := newRecorder()
+	addresses := store.NewMemoryAddresses()
+	now := time.Now()
+	saveAddresses(t, addresses, map[string]time.Time{"soon": now.Add(time.Minute)})
+
+	warnExpiring(addresses, now)
+
+	if len(rec.expiring) != 0 {
+		t.Errorf("warned %v with warnings disabled", rec.expiring)
+	}
+}
+
+func TestAnnounceExpiredAnnouncesOnce(t *testing.T) {
+	rec := newRecorder()
+	addresses := store.NewMemoryAddresses()
+	now := time.Now()
+	saveAddresses(t, addresses, map[string]time.Time{
+		"gone":   now.Add(-time.Minute),
+		"active": now.Add(time.Hour),
+	})
+
+	announceExpired(addresses, now)
+	announceExpired(addresses, now.Add(time.Minute))
+
+	if len(rec.expired) != 1 || rec.expired[0] != "gone" {
+		t.Errorf("announced %v, want [gone] once", rec.expired)
+	}
+	if address, _ := addresses.Get("gone"); !address.ExpiredMessageSent {
+		t.Error("ExpiredMessageSent wasn't recorded")
+	}
+}
@@ -0,0 +1,335 @@
+package search
+
+import (
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/DusanKasan/parsemail"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cjdenio/temp-email/pkg/db"
+	"gorm.io/gorm"
+)
+
+// Markers ts_headline wraps matches in, swapped for <mark> once the rest of
+// the text has been escaped
+const (
+	startSel = "⟦"
+	stopSel  = "⟧"
+)
+
+// vector builds an email's search vector from its own columns. The sender is
+// indexed both whole and split on "@" and "." so "stripe" finds
+// receipts@stripe.com.
+const vector = `setweight(to_tsvector('english', coalesce(subject, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce(sender, '') || ' ' || translate(coalesce(sender, ''), '@.', '  ')), 'B') ||
+	setweight(to_tsvector('english', coalesce(body_text, '')), 'C')`
+
+// fullText reports whether conn supports Postgres full-text search
+func fullText(conn *gorm.DB) bool {
+	return conn.Dialector.Name() == db.Postgres
+}
+
+// Index refreshes an email's search vector. It's called at ingest, once the
+// email's subject, sender and body text are saved.
+func Index(conn *gorm.DB, emailID string) error {
+	if !fullText(conn) {
+		return nil
+	}
+
+	return conn.Exec("UPDATE emails SET search_vector = "+vector+" WHERE id = ?", emailID).Error
+}
+
+// Backfill indexes emails saved before search existed, filling in their
+// subject, sender and body text from the raw message. It works in batches
+// until there's nothing left.
+func Backfill(conn *gorm.DB) {
+	if !fullText(conn) {
+		return
+	}
+
+	total := 0
+	for {
+		var batch []db.Email
+		if tx := conn.Where("search_vector IS NULL").Limit(100).Find(&batch); tx.Error != nil {
+			log.Printf("ERROR: Search backfill failed: %v", tx.Error)
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, email := range batch {
+			if parsed, err := parsemail.Parse(strings.NewReader(email.Content)); err == nil {
+				if len(parsed.From) > 0 {
+					email.Sender = parsed.From[0].Address
+				}
+				email.Subject = parsed.Subject
+				email.BodyText = PlainText(parsed.TextBody, parsed.HTMLBody)
+			}
+
+			tx := conn.Model(&email).Updates(map[string]interface{}{
+				"subject":   email.Subject,
+				"sender":    email.Sender,
+				"body_text": email.BodyText,
+			})
+			err := tx.Error
+			if err == nil {
+				err = Index(conn, email.ID)
+			}
+			if err != nil {
+				log.Printf("ERROR: Search backfill failed for email %s: %v", email.ID, err)
+				return
+			}
+		}
+
+		total += len(batch)
+	}
+
+	if total > 0 {
+		log.Printf("SUCCESS: Indexed %d existing emails for search", total)
+	}
+}
+
+// PlainText picks the text indexed for an email body, stripping tags from
+// HTML-only mail
+func PlainText(text, htmlBody string) string {
+	if strings.TrimSpace(text) != "" || htmlBody == "" {
+		return text
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlBody))
+	if err != nil {
+		return ""
+	}
+	doc.Find("script, style").Remove()
+
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
+
+// Query is a full-text search with optional filters
+type Query struct {
+	Text      string
+	AddressID string
+	Sender    string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// MaxHits is how many results the query asks for, between 1 and 100
+// (default 25)
+func (q Query) MaxHits() int {
+	if q.Limit <= 0 || q.Limit > 100 {
+		return 25
+	}
+
+	return q.Limit
+}
+
+// Hit is a matching email. SubjectHTML and Snippet are HTML-escaped with
+// matches wrapped in <mark>.
+type Hit struct {
+	ID          string    `json:"id"`
+	AddressID   string    `json:"addressId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Sender      string    `json:"sender"`
+	Subject     string    `json:"subject"`
+	Tag         string    `json:"tag"`
+	Rank        float64   `json:"rank"`
+	SubjectHTML string    `json:"subjectHtml"`
+	Snippet     string    `json:"snippet"`
+}
+
+// Search runs a query written in web search syntax ("stripe receipt",
+// "\"password reset\"", "invoice -draft"), best matches first
+func Search(conn *gorm.DB, q Query) ([]Hit, error) {
+	q.Limit = q.MaxHits()
+	if !fullText(conn) {
+		return searchLike(conn, q)
+	}
+
+	where := []string{"search_vector @@ q"}
+	args := []interface{}{q.Text}
+	if q.AddressID != "" {
+		where = append(where, "address_id = ?")
+		args = append(args, q.AddressID)
+	}
+	if q.Sender != "" {
+		where = append(where, "sender ILIKE ?")
+		args = append(args, "%"+q.Sender+"%")
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.Since)
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, q.Until)
+	}
+	args = append(args, q.Limit)
+
+	// Rank and limit first so headlines are only built for the results
+	sql := `SELECT e.id, e.address_id, e.created_at, e.sender, e.subject, e.tag, r.rank,
+			ts_headline('english', coalesce(e.subject, ''), r.q, 'StartSel=` + startSel + `, StopSel=` + stopSel + `, HighlightAll=true') AS subject_html,
+			ts_headline('english', coalesce(e.body_text, ''), r.q, 'StartSel=` + startSel + `, StopSel=` + stopSel + `, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet
+		FROM (
+			SELECT id, q, ts_rank(search_vector, q) AS rank
+			FROM emails, websearch_to_tsquery('english', ?) q
+			WHERE ` + strings.Join(where, " AND ") + `
+			ORDER BY rank DESC, created_at DESC
+			LIMIT ?
+		) r
+		JOIN emails e ON e.id = r.id
+		ORDER BY r.rank DESC, e.created_at DESC`
+
+	var hits []Hit
+	if tx := conn.Raw(sql, args...).Scan(&hits); tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	for i := range hits {
+		hits[i].SubjectHTML = highlight(hits[i].SubjectHTML)
+		hits[i].Snippet = highlight(hits[i].Snippet)
+	}
+
+	return hits, nil
+}
+
+// searchLike is a much simpler search for databases without full-text
+// search: every word must appear somewhere in the subject, sender or body,
+// and results are newest first
+func searchLike(conn *gorm.DB, q Query) ([]Hit, error) {
+	tx := conn.Model(&db.Email{})
+	words := strings.Fields(strings.ToLower(q.Text))
+	for _, word := range words {
+		pattern := "%" + word + "%"
+		tx = tx.Where("LOWER(subject) LIKE ? OR LOWER(sender) LIKE ? OR LOWER(body_text) LIKE ?", pattern, pattern, pattern)
+	}
+	if q.AddressID != "" {
+		tx = tx.Where("address_id = ?", q.AddressID)
+	}
+	if q.Sender != "" {
+		tx = tx.Where("LOWER(sender) LIKE ?", "%"+strings.ToLower(q.Sender)+"%")
+	}
+	if !q.Since.IsZero() {
+		tx = tx.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		tx = tx.Where("created_at < ?", q.Until)
+	}
+
+	var emails []db.Email
+	if err := tx.Order("created_at DESC").Limit(q.Limit).Find(&emails).Error; err != nil {
+		return nil, err
+	}
+
+	return Highlight(emails, q.Text), nil
+}
+
+// Matches reports whether email satisfies q the way the simpler search does,
+// for stores that search without a database
+func Matches(q Query, email db.Email) bool {
+	for _, word := range strings.Fields(strings.ToLower(q.Text)) {
+		if !strings.Contains(strings.ToLower(email.Subject), word) &&
+			!strings.Contains(strings.ToLower(email.Sender), word) &&
+			!strings.Contains(strings.ToLower(email.BodyText), word) {
+			return false
+		}
+	}
+
+	return (q.AddressID == "" || email.AddressID == q.AddressID) &&
+		(q.Sender == "" || strings.Contains(strings.ToLower(email.Sender), strings.ToLower(q.Sender))) &&
+		(q.Since.IsZero() || !email.CreatedAt.Before(q.Since)) &&
+		(q.Until.IsZero() || email.CreatedAt.Before(q.Until))
+}
+
+// Highlight turns emails found by the simpler search into hits, marking
+// each word of text in their subject and snippet
+func Highlight(emails []db.Email, text string) []Hit {
+	words := strings.Fields(strings.ToLower(text))
+
+	hits := make([]Hit, 0, len(emails))
+	for _, email := range emails {
+		hits = append(hits, Hit{
+			ID:          email.ID,
+			AddressID:   email.AddressID,
+			CreatedAt:   email.CreatedAt,
+			Sender:      email.Sender,
+			Subject:     email.Subject,
+			Tag:         email.Tag,
+			SubjectHTML: highlight(markWords(email.Subject, words)),
+			Snippet:     highlight(markWords(snippet(email.BodyText, words), words)),
+		})
+	}
+
+	return hits
+}
+
+// snippet cuts out the part of text around the first matching word
+func snippet(text string, words []string) string {
+	const radius = 80
+
+	lower := strings.ToLower(text)
+	start := 0
+	for _, word := range words {
+		// Lowercasing can change the length of some characters, which would
+		// throw the offsets off
+		if len(lower) != len(text) {
+			break
+		}
+		if i := strings.Index(lower, word); i >= 0 {
+			start = i
+			break
+		}
+	}
+
+	from, to := start-radius, start+radius
+	if from < 0 {
+		from = 0
+	}
+	if to > len(text) {
+		to = len(text)
+	}
+
+	return strings.ToValidUTF8(text[from:to], "")
+}
+
+// markWords wraps each occurrence of the words in ts_headline's markers
+func markWords(text string, words []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		return text
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		matched := ""
+		for _, word := range words {
+			if word != "" && strings.HasPrefix(lower[i:], word) {
+				matched = text[i : i+len(word)]
+				break
+			}
+		}
+		if matched == "" {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		b.WriteString(startSel + matched + stopSel)
+		i += len(matched)
+	}
+
+	return b.String()
+}
+
+// highlight escapes a headline and turns its match markers into <mark> tags
+func highlight(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, startSel, "<mark>")
+	escaped = strings.ReplaceAll(escaped, stopSel, "</mark>")
+
+	return escaped
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+)
+
+func seed(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "sqlite::memory:")
+	db.Connect()
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	now := time.Now()
+	for _, address := range []db.Address{
+		{ID: "inbox", Domain: "example.com", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "other", Domain: "example.com", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := db.DB.Create(&address).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, email := range []db.Email{
+		{ID: "receipt", AddressID: "inbox", CreatedAt: now.Add(-3 * time.Minute), Sender: "receipts@stripe.com", Subject: "Your Stripe receipt", BodyText: "Thanks for your payment of $20."},
+		{ID: "reset", AddressID: "inbox", CreatedAt: now.Add(-2 * time.Minute), Sender: "no-reply@github.com", Subject: "Password reset", BodyText: "Someone asked to reset your GitHub password."},
+		{ID: "draft", AddressID: "inbox", CreatedAt: now.Add(-time.Minute), Sender: "billing@stripe.com", Subject: "Draft invoice", BodyText: "Your invoice is ready."},
+		{ID: "elsewhere", AddressID: "other", CreatedAt: now, Sender: "receipts@stripe.com", Subject: "Another Stripe receipt"},
+	} {
+		if err := db.DB.Create(&email).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func ids(hits []Hit) string {
+	var ids []string
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+
+	return strings.Join(ids, ",")
+}
+
+func TestSearchFallsBackToLike(t *testing.T) {
+	seed(t)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"sender domain", Query{Text: "stripe", AddressID: "inbox"}, "draft,receipt"},
+		{"every word must match", Query{Text: "STRIPE receipt", AddressID: "inbox"}, "receipt"},
+		{"body text", Query{Text: "github password", AddressID: "inbox"}, "reset"},
+		{"every address", Query{Text: "receipt"}, "elsewhere,receipt"},
+		{"sender filter", Query{Text: "your", AddressID: "inbox", Sender: "GitHub"}, "reset"},
+		{"since", Query{Text: "stripe", Since: time.Now().Add(-90 * time.Second)}, "elsewhere,draft"},
+		{"limit", Query{Text: "stripe", Limit: 1}, "elsewhere"},
+		{"no match", Query{Text: "unsubscribe"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := Search(db.DB, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(hits); got != tt.want {
+				t.Errorf("Search(%+v) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchLikeHighlights(t *testing.T) {
+	seed(t)
+
+	hits, err := Search(db.DB, Query{Text: "reset", AddressID: "inbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("got %d hits, want 1", len(hits))
+	}
+
+	hit := hits[0]
+	if want := "Password <mark>reset</mark>"; hit.SubjectHTML != want {
+		t.Errorf("SubjectHTML = %q, want %q", hit.SubjectHTML, want)
+	}
+	if want := "Someone asked to <mark>reset</mark> your GitHub password."; hit.Snippet != want {
+		t.Errorf("Snippet = %q, want %q", hit.Snippet, want)
+	}
+}
+
+func TestIndexIsNoOpOnSQLite(t *testing.T) {
+	seed(t)
+
+	if err := Index(db.DB, "receipt"); err != nil {
+		t.Errorf("Index on SQLite = %v, want nil", err)
+	}
+}
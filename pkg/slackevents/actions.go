@@ -0,0 +1,126 @@
+package slackevents
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/ingest"
+	"github.com/slack-go/slack"
+)
+
+// Slack rejects section text longer than 3000 characters
+const maxSectionText = 2900
+
+// findEmail loads an email along with the address it was sent to
+func findEmail(id string) (db.Email, error) {
+	return stores.Emails.Get(id)
+}
+
+// rawHeaders returns the header section of a raw MIME message
+func rawHeaders(content string) string {
+	for _, sep := range []string{"\r\n\r\n", "\n\n"} {
+		if i := strings.Index(content, sep); i >= 0 {
+			return content[:i]
+		}
+	}
+
+	return content
+}
+
+func ephemeral(payload slack.InteractionCallback, threadTs, text string) {
+	_, err := Client.PostEphemeral(
+		os.Getenv("SLACK_CHANNEL"),
+		payload.User.ID,
+		slack.MsgOptionTS(threadTs),
+		slack.MsgOptionText(text, false),
+	)
+	if err != nil {
+		log.Printf("Error posting ephemeral message: %v", err)
+	}
+}
+
+func showHeaders(payload slack.InteractionCallback, emailID string) {
+	email, err := findEmail(emailID)
+	if err != nil {
+		ephemeral(payload, payload.Container.ThreadTs, "hmm, i couldn't find that email. maybe it was deleted?")
+		return
+	}
+
+	headers := rawHeaders(email.Content)
+	if len(headers) > maxSectionText {
+		headers = headers[:maxSectionText] + "\n…"
+	}
+
+	ephemeral(payload, email.Address.Timestamp, fmt.Sprintf(
+		"```%s```\n<%s/%s/headers|Inspect these headers>",
+		strings.ReplaceAll(headers, "```", "'''"), os.Getenv("APP_DOMAIN"), email.ID,
+	))
+}
+
+func blockSender(payload slack.InteractionCallback, emailID string) {
+	email, err := findEmail(emailID)
+	if err != nil {
+		ephemeral(payload, payload.Container.ThreadTs, "hmm, i couldn't find that email. maybe it was deleted?")
+		return
+	}
+
+	if payload.User.ID != email.Address.User {
+		ephemeral(payload, email.Address.Timestamp, "whatcha tryin' to pull here :face_with_raised_eyebrow:")
+		return
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(email.Content))
+	if err != nil {
+		ephemeral(payload, email.Address.Timestamp, "sorry, i couldn't figure out who sent that email.")
+		return
+	}
+
+	sender := strings.ToLower(ingest.SenderAddress(msg.Header.Get("From")))
+	if sender == "" {
+		ephemeral(payload, email.Address.Timestamp, "sorry, i couldn't figure out who sent that email.")
+		return
+	}
+
+	err = stores.Senders.AddRule(&db.SenderRule{
+		CreatedAt: time.Now(),
+		AddressID: email.AddressID,
+		Pattern:   sender,
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to block %s for %s: %v", sender, email.AddressID, err)
+		ephemeral(payload, email.Address.Timestamp, "uh oh! something went wrong blocking that sender.")
+		return
+	}
+
+	log.Printf("SUCCESS: Blocked %s for address %s", sender, email.AddressID)
+	ephemeral(payload, email.Address.Timestamp, fmt.Sprintf(":no_entry: `%s` is blocked; mail from them to this address will be rejected.", sender))
+}
+
+func deleteEmail(payload slack.InteractionCallback, emailID string) {
+	email, err := findEmail(emailID)
+	if err != nil {
+		ephemeral(payload, payload.Container.ThreadTs, "hmm, i couldn't find that email. maybe it was already deleted?")
+		return
+	}
+
+	if payload.User.ID != email.Address.User {
+		ephemeral(payload, email.Address.Timestamp, "whatcha tryin' to pull here :face_with_raised_eyebrow:")
+		return
+	}
+
+	if err := stores.Emails.Delete(email.ID); err != nil {
+		log.Printf("ERROR: Failed to delete email %s: %v", email.ID, err)
+		ephemeral(payload, email.Address.Timestamp, "uh oh! something went wrong deleting that email.")
+		return
+	}
+
+	_, _, err = Client.DeleteMessage(os.Getenv("SLACK_CHANNEL"), payload.Container.MessageTs)
+	if err != nil {
+		log.Printf("Error deleting Slack message for email %s: %v", email.ID, err)
+	}
+}
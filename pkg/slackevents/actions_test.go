@@ -0,0 +1,112 @@
+package slackevents
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/notify"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/slack-go/slack"
+)
+
+// slackStub stands in for the Slack Web API, answering every method with
+// ok and remembering which methods were called, and with what text
+type slackStub struct {
+	mu    sync.Mutex
+	calls []string
+	texts []string
+}
+
+func newSlackStub(t *testing.T) *slackStub {
+	stub := &slackStub{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		stub.mu.Lock()
+		stub.calls = append(stub.calls, strings.TrimPrefix(r.URL.Path, "/"))
+		stub.texts = append(stub.texts, r.Form.Get("text"))
+		stub.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "channel": "C1", "ts": "1.0"})
+	}))
+	t.Cleanup(server.Close)
+
+	previous := Client
+	Client = slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+	t.Cleanup(func() { Client = previous })
+
+	return stub
+}
+
+// seedOwnedEmail stores an active address owned by U_OWNER with one email
+// from a shop
+func seedOwnedEmail(t *testing.T) {
+	t.Helper()
+
+	stores = store.Memory()
+	now := time.Now()
+	stores.Addresses.Save(&db.Address{ID: "inbox", Domain: "temp.example", User: "U_OWNER", Timestamp: "1.0", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	err := stores.Emails.Create(&db.Email{
+		AddressID: "inbox",
+		Sender:    "hi@shop.example",
+		Content:   "From: Shop <hi@shop.example>\r\nSubject: Deals\r\n\r\nBuy now\r\n",
+	}, func() string { return "email1" })
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func action(user, actionID, value string) slack.InteractionCallback {
+	var payload slack.InteractionCallback
+	payload.Type = slack.InteractionTypeBlockActions
+	payload.User.ID = user
+	payload.Container.MessageTs = "2.0"
+	payload.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: actionID, Value: value}}
+
+	return payload
+}
+
+func TestNonOwnerCannotBlockOrDelete(t *testing.T) {
+	for _, actionID := range []string{notify.ActionBlockSender, notify.ActionDeleteEmail} {
+		t.Run(actionID, func(t *testing.T) {
+			stub := newSlackStub(t)
+			seedOwnedEmail(t)
+
+			handleInteraction(action("U_SOMEONE_ELSE", actionID, "email1"))
+
+			if _, err := stores.Emails.Get("email1"); err != nil {
+				t.Errorf("email is gone after a non-owner's %s: %v", actionID, err)
+			}
+			if rules, _ := stores.Senders.Rules("inbox"); len(rules) != 0 {
+				t.Errorf("sender rules = %+v after a non-owner's %s", rules, actionID)
+			}
+			if len(stub.calls) != 1 || stub.calls[0] != "chat.postEphemeral" || !strings.Contains(stub.texts[0], "whatcha tryin") {
+				t.Errorf("Slack calls = %v %q, want just the refusal", stub.calls, stub.texts)
+			}
+		})
+	}
+}
+
+func TestOwnerCanBlockAndDelete(t *testing.T) {
+	stub := newSlackStub(t)
+	seedOwnedEmail(t)
+
+	handleInteraction(action("U_OWNER", notify.ActionBlockSender, "email1"))
+	if rules, _ := stores.Senders.Rules("inbox"); len(rules) != 1 || rules[0].Pattern != "hi@shop.example" {
+		t.Errorf("sender rules = %+v, want the shop blocked", rules)
+	}
+
+	handleInteraction(action("U_OWNER", notify.ActionDeleteEmail, "email1"))
+	if _, err := stores.Emails.Get("email1"); err != store.ErrNotFound {
+		t.Errorf("email still there after its owner deleted it (err %v)", err)
+	}
+	if last := stub.calls[len(stub.calls)-1]; last != "chat.delete" {
+		t.Errorf("Slack calls = %v, want the notification deleted last", stub.calls)
+	}
+}
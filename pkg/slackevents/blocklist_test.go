@@ -0,0 +1,63 @@
+package slackevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/cjdenio/temp-email/pkg/blocklist"
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+func TestBlocklistAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores = store.Memory()
+	t.Cleanup(func() { blocklist.Reload(store.NewMemoryGlobalRules()) })
+
+	var added []db.GlobalRule
+	for _, body := range []string{
+		`{"kind": "subject", "pattern": "lottery"}`,
+		`{"kind": "domain", "pattern": "@Spam.Example"}`,
+	} {
+		w := dashboardRequest("POST", "/api/blocklist", body)
+		if w.Code != 200 {
+			t.Fatalf("adding %s got %d %s", body, w.Code, w.Body)
+		}
+		var rule db.GlobalRule
+		json.Unmarshal(w.Body.Bytes(), &rule)
+		added = append(added, rule)
+	}
+
+	if added[1].Pattern != "spam.example" {
+		t.Errorf("domain rule saved as %q, want it normalized", added[1].Pattern)
+	}
+	if blocklist.Check(stores.GlobalRules, blocklist.Message{Sender: "a@mail.spam.example"}) == nil {
+		t.Error("a new rule isn't in force until the next reload")
+	}
+
+	for _, body := range []string{`{"kind": "ip", "pattern": "nope"}`, `{"kind": "header", "pattern": "x"}`, `not json`} {
+		if w := dashboardRequest("POST", "/api/blocklist", body); w.Code != 400 {
+			t.Errorf("adding %s got %d, want 400", body, w.Code)
+		}
+	}
+
+	var listed []db.GlobalRule
+	json.Unmarshal(dashboardRequest("GET", "/api/blocklist", "").Body.Bytes(), &listed)
+	if len(listed) != 2 || listed[0].Kind != "domain" || listed[1].Kind != "subject" {
+		t.Errorf("listed %+v, want both rules by kind", listed)
+	}
+
+	if w := dashboardRequest("DELETE", fmt.Sprintf("/api/blocklist/%d", added[1].ID), ""); w.Code != 200 {
+		t.Fatalf("deleting got %d %s", w.Code, w.Body)
+	}
+	if blocklist.Check(stores.GlobalRules, blocklist.Message{Sender: "a@spam.example"}) != nil {
+		t.Error("a deleted rule still matches")
+	}
+	for _, path := range []string{fmt.Sprintf("/api/blocklist/%d", added[1].ID), "/api/blocklist/abc"} {
+		if w := dashboardRequest("DELETE", path, ""); w.Code != 404 {
+			t.Errorf("DELETE %s got %d, want 404", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package slackevents
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardRequest sends a request to the dashboard API as a logged in admin
+func dashboardRequest(method, path, body string) *httptest.ResponseRecorder {
+	sessions["test-session"] = true
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "auth_token", Value: "test-session"})
+
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, req)
+
+	return w
+}
+
+func TestCreateAddressFromDashboard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores = store.Memory()
+	stores.Domains.Create(&db.Domain{Name: "temp.example", Pool: "default", Enabled: true, Verified: true})
+
+	w := dashboardRequest("POST", "/api/addresses", `{"name": "shop", "duration": 2, "domain": "temp.example"}`)
+	if w.Code != 200 {
+		t.Fatalf("got %d %s, want 200", w.Code, w.Body)
+	}
+
+	var created db.Address
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := stores.Addresses.Get(created.ID)
+	if err != nil {
+		t.Fatalf("address %q wasn't saved: %v", created.ID, err)
+	}
+	if !strings.HasPrefix(saved.ID, "shop") || saved.Domain != "temp.example" || saved.User != "dashboard" {
+		t.Errorf("saved address = %+v", saved)
+	}
+	if lifetime := saved.ExpiresAt.Sub(saved.CreatedAt).Hours(); lifetime < 1.99 || lifetime > 2.01 {
+		t.Errorf("address lives %.2f hours, want 2", lifetime)
+	}
+}
+
+func TestCreateAddressRejectsUnknownDomain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores = store.Memory()
+	stores.Domains.Create(&db.Domain{Name: "temp.example", Pool: "default", Enabled: true, Verified: true})
+
+	w := dashboardRequest("POST", "/api/addresses", `{"domain": "elsewhere.example"}`)
+	if w.Code != 400 {
+		t.Errorf("got %d %s, want 400", w.Code, w.Body)
+	}
+
+	if list, _ := stores.Addresses.List(); len(list) != 0 {
+		t.Errorf("addresses saved: %+v", list)
+	}
+}
+
+func TestCreateAddressNeedsLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores = store.Memory()
+
+	req := httptest.NewRequest("POST", "/api/addresses", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, req)
+
+	if w.Code != 302 {
+		t.Errorf("got %d, want a redirect to the login page", w.Code)
+	}
+	if list, _ := stores.Addresses.List(); len(list) != 0 {
+		t.Errorf("addresses saved: %+v", list)
+	}
+}
+
+func TestDashboardSkipsPerUserQuotas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MAX_ACTIVE_PER_USER", "2")
+	t.Setenv("MAX_CREATIONS_PER_HOUR", "2")
+	stores = store.Memory()
+	stores.Domains.Create(&db.Domain{Name: "temp.example", Pool: "default", Enabled: true, Verified: true})
+
+	for i := 0; i < 3; i++ {
+		if w := dashboardRequest("POST", "/api/addresses", `{"domain": "temp.example"}`); w.Code != 200 {
+			t.Fatalf("address %d got %d %s, want 200", i+1, w.Code, w.Body)
+		}
+	}
+
+	for _, body := range []string{`{"duration": 1000}`, `{"duration": 9223372036854775807}`} {
+		if w := dashboardRequest("POST", "/api/addresses", body); w.Code < 400 {
+			t.Errorf("%s got %d, want it refused", body, w.Code)
+		}
+	}
+}
+
+func TestExtendAddressFromDashboard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MAX_REACTIVATIONS", "1")
+	slackStub := newSlackStub(t)
+	stores = store.Memory()
+	expired := time.Now().Add(-time.Hour)
+	stores.Addresses.Save(&db.Address{ID: "inbox", Domain: "temp.example", Timestamp: "1.0", ExpiresAt: expired, WarningSent: true, ExpiredMessageSent: true})
+
+	if w := dashboardRequest("POST", "/api/addresses/inbox/extend", `{"hours": 5}`); w.Code != 403 {
+		t.Errorf("extending by an unoffered length got %d, want 403", w.Code)
+	}
+	if w := dashboardRequest("POST", "/api/addresses/nobody/extend", `{"hours": 24}`); w.Code != 404 {
+		t.Errorf("extending a missing address got %d, want 404", w.Code)
+	}
+
+	w := dashboardRequest("POST", "/api/addresses/inbox/extend", `{"hours": 24}`)
+	if w.Code != 200 {
+		t.Fatalf("got %d %s, want 200", w.Code, w.Body)
+	}
+
+	// An expired address is extended from now, like reactivating it in Slack
+	address, _ := stores.Addresses.Get("inbox")
+	if left := time.Until(address.ExpiresAt); left < 23*time.Hour || left > 24*time.Hour {
+		t.Errorf("address expires in %s, want about a day", left)
+	}
+	if address.Reactivations != 1 || address.WarningSent || address.ExpiredMessageSent {
+		t.Errorf("extended address = %+v, want one reactivation and its notices reset", address)
+	}
+	if len(slackStub.calls) == 0 || slackStub.calls[0] != "chat.postMessage" {
+		t.Errorf("Slack calls = %v, want the thread told", slackStub.calls)
+	}
+
+	// and the reactivation limit still applies
+	if w := dashboardRequest("POST", "/api/addresses/inbox/extend", `{"hours": 24}`); w.Code != 403 {
+		t.Errorf("extending past MAX_REACTIVATIONS got %d, want 403", w.Code)
+	}
+}
+
+func TestWebhookSecretOnlyShownOnCreate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores = store.Memory()
+
+	w := dashboardRequest("POST", "/api/webhooks", `{"url": "https://hooks.example/mail"}`)
+	if w.Code != 200 {
+		t.Fatalf("got %d %s, want 200", w.Code, w.Body)
+	}
+	var created struct{ Secret string }
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Secret == "" {
+		t.Fatalf("create response %s has no secret", w.Body)
+	}
+
+	w = dashboardRequest("GET", "/api/webhooks", "")
+	if w.Code != 200 || strings.Contains(w.Body.String(), created.Secret) || strings.Contains(w.Body.String(), "Secret") {
+		t.Errorf("webhook list %s gives the secret away", w.Body)
+	}
+}
@@ -0,0 +1,80 @@
+package slackevents
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/policy"
+	"github.com/cjdenio/temp-email/pkg/util"
+	"github.com/slack-go/slack"
+)
+
+// extend pushes an address's expiry back by d and counts it as a
+// reactivation. Active addresses are extended from their current expiry,
+// expired ones from now.
+func extend(address *db.Address, d time.Duration, now time.Time) {
+	if address.ExpiresAt.After(now) {
+		address.ExpiresAt = address.ExpiresAt.Add(d)
+	} else {
+		address.ExpiresAt = now.Add(d)
+	}
+	address.Reactivations++
+	address.WarningSent = false
+	address.ExpiredMessageSent = false
+}
+
+// extendAddress handles a selection from the Extend menu, whose values look
+// like "<address id>:<hours>"
+func extendAddress(payload slack.InteractionCallback, value string) {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return
+	}
+
+	hours, err := strconv.Atoi(value[i+1:])
+	if err != nil {
+		return
+	}
+	duration := time.Duration(hours) * time.Hour
+
+	address, err := stores.Addresses.Get(value[:i])
+	if err != nil {
+		return
+	}
+
+	if payload.User.ID != address.User {
+		ephemeral(payload, address.Timestamp, "whatcha tryin' to pull here :face_with_raised_eyebrow:")
+		return
+	}
+
+	if err := policy.CheckExtend(address, duration); err != nil {
+		ephemeral(payload, address.Timestamp, fmt.Sprintf("sorry, %s", err))
+		return
+	}
+
+	now := time.Now()
+	extend(&address, duration, now)
+
+	if err := stores.Addresses.Save(&address); err != nil {
+		log.Printf("ERROR: Failed to extend address %s: %v", address.ID, err)
+		ephemeral(payload, address.Timestamp, "uh oh! something went wrong extending that address.")
+		return
+	}
+
+	log.Printf("SUCCESS: Extended address %s by %s (expires: %s)", address.ID, duration, address.ExpiresAt.Format(time.RFC3339))
+
+	Client.PostMessage(
+		os.Getenv("SLACK_CHANNEL"),
+		slack.MsgOptionTS(address.Timestamp),
+		slack.MsgOptionText(fmt.Sprintf("This address will be available for another %s!", util.FormatDuration(address.ExpiresAt.Sub(now).Round(time.Hour))), false),
+	)
+	Client.RemoveReaction("clock1", slack.ItemRef{
+		Channel:   os.Getenv("SLACK_CHANNEL"),
+		Timestamp: address.Timestamp,
+	})
+}
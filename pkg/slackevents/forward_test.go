@@ -0,0 +1,46 @@
+package slackevents
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+func confirmRequest(method, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, httptest.NewRequest(method, "/forward/confirm/"+token, nil))
+
+	return w
+}
+
+func TestForwardConfirmsOnPostOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores = store.Memory()
+	stores.Forwards.Create(&db.ForwardRule{AddressID: "inbox", Destination: "me@real.example", ConfirmToken: "token1"})
+
+	// A link scanner fetching the page doesn't confirm anything
+	w := confirmRequest("GET", "token1")
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `<form method="POST" action="/forward/confirm/token1">`) {
+		t.Fatalf("GET got %d %s, want a page with a confirm form", w.Code, w.Body)
+	}
+	if confirmed, _ := stores.Forwards.Confirmed("inbox"); len(confirmed) != 0 {
+		t.Fatalf("GET confirmed the rule: %+v", confirmed)
+	}
+
+	if w := confirmRequest("POST", "token1"); w.Code != 200 {
+		t.Fatalf("POST got %d %s, want 200", w.Code, w.Body)
+	}
+	if confirmed, _ := stores.Forwards.Confirmed("inbox"); len(confirmed) != 1 {
+		t.Errorf("rule isn't confirmed after the POST")
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		if w := confirmRequest(method, "nope"); w.Code != 404 {
+			t.Errorf("%s with an unknown token got %d, want 404", method, w.Code)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package slackevents
+
+import (
+	"html/template"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/inspect"
+)
+
+// headersPage is the data behind the header inspector
+type headersPage struct {
+	Email  db.Email
+	Report inspect.Report
+}
+
+// formatDelay renders a hop delay; negative delays mean the servers' clocks
+// disagree
+func formatDelay(d *time.Duration) string {
+	if d == nil {
+		return "?"
+	}
+
+	s := d.Round(time.Second).String()
+	if *d < 0 {
+		s += " (clock skew)"
+	}
+
+	return s
+}
+
+// authClass picks the badge colour for an authentication result
+func authClass(result string) string {
+	switch result {
+	case "pass":
+		return "pass"
+	case "fail", "permerror", "softfail":
+		return "fail"
+	default:
+		return "neutral"
+	}
+}
+
+var headersTemplate = template.Must(template.New("headers").Funcs(template.FuncMap{
+	"delay":     formatDelay,
+	"authClass": authClass,
+	"inc":       func(i int) int { return i + 1 },
+	"time": func(t *time.Time) string {
+		if t == nil {
+			return "?"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05 MST")
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Headers - {{.Email.Subject}}</title>
+    <style>
+        body { font-family: Roboto, Arial, sans-serif; color: #202124; margin: 24px auto; max-width: 1100px; padding: 0 16px; }
+        h1 { font-size: 20px; font-weight: 500; margin-bottom: 4px; }
+        h2 { font-size: 16px; font-weight: 500; margin: 28px 0 8px; }
+        .meta { color: #5f6368; font-size: 14px; }
+        .meta a { color: #1a73e8; text-decoration: none; margin-right: 12px; }
+        table { border-collapse: collapse; width: 100%; font-size: 13px; }
+        th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #e0e0e0; vertical-align: top; }
+        th { color: #5f6368; font-weight: 500; }
+        td.mono, pre { font-family: "Roboto Mono", monospace; word-break: break-all; white-space: pre-wrap; }
+        .badge { display: inline-block; padding: 1px 8px; border-radius: 10px; font-size: 12px; font-weight: 500; }
+        .badge.pass { background: #e6f4ea; color: #137333; }
+        .badge.fail { background: #fce8e6; color: #c5221f; }
+        .badge.neutral { background: #f1f3f4; color: #5f6368; }
+        .empty { color: #5f6368; font-size: 13px; }
+    </style>
+</head>
+<body>
+    <h1>{{.Email.Subject}}</h1>
+    <div class="meta">
+        From {{.Email.Sender}} &middot; Received {{.Email.CreatedAt.UTC.Format "2006-01-02 15:04:05 MST"}}
+    </div>
+    <div class="meta" style="margin-top: 8px;">
+        <a href="/{{.Email.ID}}">View message</a>
+        <a href="/{{.Email.ID}}/raw">Raw source</a>
+        <a href="/{{.Email.ID}}.eml">Download .eml</a>
+    </div>
+
+    <h2>Delivery path{{if .Report.TotalDelay}} &middot; {{delay .Report.TotalDelay}} total{{end}}</h2>
+    {{if .Report.Hops}}
+    <table>
+        <tr><th>#</th><th>Delay</th><th>From</th><th>By</th><th>With</th><th>Time</th></tr>
+        {{range $i, $hop := .Report.Hops}}
+        <tr title="{{$hop.Raw}}">
+            <td>{{inc $i}}</td>
+            <td>{{delay $hop.Delay}}</td>
+            <td class="mono">{{$hop.From}}{{if $hop.FromDetail}} ({{$hop.FromDetail}}){{end}}</td>
+            <td class="mono">{{$hop.By}}</td>
+            <td>{{$hop.With}}</td>
+            <td>{{time $hop.Time}}</td>
+        </tr>
+        {{end}}
+    </table>
+    {{else}}
+    <div class="empty">No Received headers.</div>
+    {{end}}
+
+    <h2>Authentication</h2>
+    {{if .Report.Authentication}}
+    <table>
+        <tr><th>Server</th><th>Method</th><th>Result</th><th>Details</th></tr>
+        {{range $auth := .Report.Authentication}}{{range $auth.Results}}
+        <tr>
+            <td class="mono">{{$auth.Server}}</td>
+            <td>{{.Method}}</td>
+            <td><span class="badge {{authClass .Result}}">{{.Result}}</span></td>
+            <td class="mono">{{range .Properties}}{{.Name}}={{.Value}} {{end}}{{if .Reason}}({{.Reason}}){{end}}</td>
+        </tr>
+        {{end}}{{end}}
+    </table>
+    {{else}}
+    <div class="empty">No Authentication-Results headers.</div>
+    {{end}}
+
+    <h2>Mailing list</h2>
+    {{if .Report.List}}
+    <table>
+        {{range .Report.List}}
+        <tr><th>{{.Name}}</th><td class="mono">{{.Value}}</td></tr>
+        {{end}}
+    </table>
+    {{else}}
+    <div class="empty">No List-* headers.</div>
+    {{end}}
+
+    <h2>All headers</h2>
+    <table>
+        {{range .Report.Headers}}
+        <tr><th>{{.Name}}</th><td class="mono">{{.Value}}</td></tr>
+        {{end}}
+    </table>
+</body>
+</html>
+`))
@@ -0,0 +1,136 @@
+package slackevents
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// Deliberately untidy: mixed line endings, trailing spaces and a byte that
+// isn't UTF-8, all of which the raw routes must hand back untouched
+const rawMessage = "Received: from relay.shop.example (relay.shop.example [198.51.100.7])\r\n" +
+	"\tby mx.temp.example with ESMTPS id 1A2B; Tue, 1 Oct 2024 17:00:05 +0000\r\n" +
+	"Authentication-Results: mx.temp.example; spf=pass smtp.mailfrom=shop.example\r\n" +
+	"List-Unsubscribe: <https://shop.example/u/1>\r\n" +
+	"From: Shop <news@shop.example>\r\n" +
+	"Date: Tue, 1 Oct 2024 17:00:00 +0000\r\n" +
+	"Subject: Caf\xe9 deals  \r\n" +
+	"\r\n" +
+	"Hello there\n\r\n"
+
+// seedViewable stores an ordinary email, a quarantined one and an infected
+// one, all with rawMessage as their content
+func seedViewable(t *testing.T) {
+	t.Helper()
+
+	stores = store.Memory()
+	now := time.Now()
+	stores.Addresses.Save(&db.Address{ID: "inbox", Domain: "temp.example", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+	for _, email := range []db.Email{
+		{ID: "plain"},
+		{ID: "held", Quarantined: true, QuarantineReason: "spam"},
+		{ID: "infected", Quarantined: true, Virus: "Eicar-Test-Signature"},
+	} {
+		email := email
+		email.AddressID = "inbox"
+		email.Subject = "Deals"
+		email.Content = rawMessage
+		id := email.ID
+		if err := stores.Emails.Create(&email, func() string { return id }); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func viewRequest(path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+	return w
+}
+
+func TestRawAndDownloadRoutesKeepBytes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	seedViewable(t)
+
+	w := viewRequest("/plain/raw")
+	if w.Code != 200 || w.Body.String() != rawMessage {
+		t.Errorf("raw got %d %q, want the message unchanged", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("raw served as %q without nosniff", ct)
+	}
+
+	w = viewRequest("/plain.eml")
+	if w.Code != 200 || w.Body.String() != rawMessage {
+		t.Errorf(".eml got %d %q, want the message unchanged", w.Code, w.Body)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="plain.eml"` {
+		t.Errorf(".eml Content-Disposition = %q, want an attachment", cd)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "message/rfc822" {
+		t.Errorf(".eml Content-Type = %q", ct)
+	}
+}
+
+func TestHeadersRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	seedViewable(t)
+
+	w := viewRequest("/plain/headers")
+	if w.Code != 200 {
+		t.Fatalf("got %d %s, want 200", w.Code, w.Body)
+	}
+	for _, want := range []string{"relay.shop.example", "198.51.100.7", "5s", `<span class="badge pass">pass</span>`, "https://shop.example/u/1"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("headers page doesn't show %q", want)
+		}
+	}
+}
+
+func TestViewRoutesHideQuarantinedMail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	seedViewable(t)
+
+	routes := []string{"/%s", "/%s.eml", "/%s/raw", "/%s/headers"}
+
+	// The same check as the email view: quarantined mail is only shown to
+	// dashboard users
+	for _, route := range routes {
+		for _, id := range []string{"held", "infected", "missing"} {
+			path := strings.Replace(route, "%s", id, 1)
+			if w := viewRequest(path); w.Code != 404 {
+				t.Errorf("%s got %d logged out, want 404", path, w.Code)
+			}
+		}
+	}
+
+	for _, route := range routes {
+		path := strings.Replace(route, "%s", "held", 1)
+		if w := dashboardRequest("GET", path, ""); w.Code != 200 {
+			t.Errorf("%s got %d logged in, want 200", path, w.Code)
+		}
+	}
+
+	// Infected mail can be looked at but not downloaded, even by admins
+	tests := []struct {
+		route string
+		code  int
+	}{
+		{"/infected", 200},
+		{"/infected/headers", 200},
+		{"/infected.eml", 403},
+		{"/infected/raw", 403},
+	}
+	for _, tt := range tests {
+		if w := dashboardRequest("GET", tt.route, ""); w.Code != tt.code {
+			t.Errorf("%s got %d logged in, want %d", tt.route, w.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package slackevents
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/notify"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// signedInteraction builds an interactivity request signed the way Slack
+// signs them
+func signedInteraction(secret, payload string) *httptest.ResponseRecorder {
+	body := url.Values{"payload": {payload}}.Encode()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	req := httptest.NewRequest("POST", "/slack/interactivity", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, req)
+
+	return w
+}
+
+func TestInteractivityAcksBeforeHandling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SLACK_SIGNING_SECRET", "signing-secret")
+	stores = store.Memory()
+
+	// The handler doesn't finish until the test lets it, like a reply stuck
+	// on a slow relay
+	release := make(chan bool)
+	handled := make(chan slack.InteractionCallback, 1)
+	interactions = func(payload slack.InteractionCallback) {
+		<-release
+		handled <- payload
+	}
+	defer func() { interactions = handleInteraction }()
+
+	w := signedInteraction("signing-secret", `{"type":"view_submission","view":{"callback_id":"`+notify.ActionReplyEmail+`","private_metadata":"abc"}}`)
+	if w.Code != 200 {
+		t.Fatalf("got %d, want 200", w.Code)
+	}
+
+	close(release)
+	select {
+	case payload := <-handled:
+		if payload.Type != slack.InteractionTypeViewSubmission || payload.View.PrivateMetadata != "abc" {
+			t.Errorf("handled %+v, want the reply submission", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("submission wasn't handled after the ack")
+	}
+}
+
+func TestInteractivityRejectsBadSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SLACK_SIGNING_SECRET", "signing-secret")
+	stores = store.Memory()
+
+	handled := make(chan bool, 1)
+	interactions = func(slack.InteractionCallback) { handled <- true }
+	defer func() { interactions = handleInteraction }()
+
+	if w := signedInteraction("wrong-secret", `{"type":"block_actions"}`); w.Code != 401 {
+		t.Errorf("got %d, want 401", w.Code)
+	}
+
+	select {
+	case <-handled:
+		t.Error("an unsigned interaction was handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestInteractivityRejectsBadPayload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SLACK_SIGNING_SECRET", "signing-secret")
+	stores = store.Memory()
+
+	handled := make(chan bool, 1)
+	interactions = func(slack.InteractionCallback) { handled <- true }
+	defer func() { interactions = handleInteraction }()
+
+	if w := signedInteraction("signing-secret", `{"type": `); w.Code != 400 {
+		t.Errorf("got %d, want 400", w.Code)
+	}
+
+	select {
+	case <-handled:
+		t.Error("a payload that didn't parse was handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,78 @@
+package slackevents
+
+import (
+	"log"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Number of goroutines processing queued Slack events
+const eventWorkers = 4
+
+// Events are acknowledged as soon as they're queued, so Slack's 3 second
+// timeout never depends on database writes or Slack API calls
+var eventQueue = make(chan slackevents.EventsAPIEvent, 100)
+
+func startEventWorkers() {
+	for i := 0; i < eventWorkers; i++ {
+		go func() {
+			for ev := range eventQueue {
+				handleCallbackEvent(ev)
+			}
+		}()
+	}
+}
+
+// enqueueEvent queues a callback event for processing unless it has already
+// been seen. retryNum is Slack's retry counter (0 for the first delivery).
+// It never waits on the workers: when the queue is full the event is
+// forgotten and false is returned, so the caller can decline it and let
+// Slack deliver it again later.
+func enqueueEvent(ev slackevents.EventsAPIEvent, retryNum int) bool {
+	eventID := ""
+	if cb, ok := ev.Data.(*slackevents.EventsAPICallbackEvent); ok {
+		eventID = cb.EventID
+	}
+
+	if eventID != "" && !markEventSeen(eventID) {
+		log.Printf("Dropping duplicate Slack event %s (retry %d)", eventID, retryNum)
+		return true
+	}
+
+	if retryNum > 0 {
+		log.Printf("Processing Slack retry %d of unseen event %s", retryNum, eventID)
+	}
+
+	select {
+	case eventQueue <- ev:
+		return true
+	default:
+		log.Printf("ERROR: Slack event queue is full, declining event %s so Slack retries it", eventID)
+		if eventID != "" {
+			forgetEvent(eventID)
+		}
+		return false
+	}
+}
+
+// markEventSeen records an event ID, returning false if it was already
+// recorded
+func markEventSeen(eventID string) bool {
+	unseen, err := stores.Events.MarkSeen(eventID, time.Now())
+	if err != nil {
+		// Better to risk a duplicate than to lose the event
+		log.Printf("ERROR: Failed to record Slack event %s: %v", eventID, err)
+		return true
+	}
+
+	return unseen
+}
+
+// forgetEvent removes a recorded event ID, so a redelivery isn't mistaken for
+// a duplicate
+func forgetEvent(eventID string) {
+	if err := stores.Events.Forget(eventID); err != nil {
+		log.Printf("ERROR: Failed to forget Slack event %s: %v", eventID, err)
+	}
+}
@@ -0,0 +1,59 @@
+package slackevents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/slack-go/slack/slackevents"
+)
+
+func callbackEvent(id string) slackevents.EventsAPIEvent {
+	return slackevents.EventsAPIEvent{
+		Type: slackevents.CallbackEvent,
+		Data: &slackevents.EventsAPICallbackEvent{EventID: id},
+	}
+}
+
+func drainQueue() {
+	for {
+		select {
+		case <-eventQueue:
+		default:
+			return
+		}
+	}
+}
+
+func TestEnqueueEventOverflow(t *testing.T) {
+	stores = store.Memory()
+	drainQueue()
+	defer drainQueue()
+
+	for i := 0; i < cap(eventQueue); i++ {
+		eventQueue <- callbackEvent("")
+	}
+
+	// A full queue declines the event instead of blocking, and forgets it
+	if enqueueEvent(callbackEvent("EvFull"), 0) {
+		t.Fatal("event was accepted into a full queue")
+	}
+	if unseen, _ := stores.Events.MarkSeen("EvFull", time.Now()); !unseen {
+		t.Fatal("declined event is still marked seen")
+	}
+	stores.Events.Forget("EvFull")
+
+	// Slack's retry is then processed rather than dropped as a duplicate
+	drainQueue()
+	if !enqueueEvent(callbackEvent("EvFull"), 1) {
+		t.Fatal("retry was declined")
+	}
+	if got := <-eventQueue; got.Data.(*slackevents.EventsAPICallbackEvent).EventID != "EvFull" {
+		t.Fatalf("queued %+v, want the retried event", got)
+	}
+
+	// A second retry after that is a duplicate
+	if !enqueueEvent(callbackEvent("EvFull"), 2) || len(eventQueue) != 0 {
+		t.Fatal("duplicate was queued")
+	}
+}
@@ -0,0 +1,88 @@
+package slackevents
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/cjdenio/temp-email/pkg/compose"
+	"github.com/cjdenio/temp-email/pkg/notify"
+	"github.com/slack-go/slack"
+)
+
+// Block IDs of the reply modal's inputs, each holding an input with the same
+// action ID
+const (
+	replyTo      = "reply_to"
+	replySubject = "reply_subject"
+	replyBody    = "reply_body"
+)
+
+func replyInput(id, label, value string, multiline bool) *slack.InputBlock {
+	input := slack.NewPlainTextInputBlockElement(nil, id)
+	input.InitialValue = value
+	input.Multiline = multiline
+
+	return slack.NewInputBlock(id, slack.NewTextBlockObject(slack.PlainTextType, label, false, false), input)
+}
+
+// openReply opens a composer prefilled with a reply to an email
+func openReply(payload slack.InteractionCallback, emailID string) {
+	email, err := findEmail(emailID)
+	if err != nil {
+		ephemeral(payload, payload.Container.ThreadTs, "hmm, i couldn't find that email. maybe it was deleted?")
+		return
+	}
+
+	if payload.User.ID != email.Address.User {
+		ephemeral(payload, email.Address.Timestamp, "whatcha tryin' to pull here :face_with_raised_eyebrow:")
+		return
+	}
+
+	draft := compose.ReplyTo(email)
+
+	_, err = Client.OpenView(payload.TriggerID, slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      notify.ActionReplyEmail,
+		PrivateMetadata: email.ID,
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, "Reply", false, false),
+		Submit:          slack.NewTextBlockObject(slack.PlainTextType, "Send", false, false),
+		Close:           slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("from `%s@%s`", email.Address.ID, email.Address.Domain), false, false)),
+			replyInput(replyTo, "To", draft.To, false),
+			replyInput(replySubject, "Subject", draft.Subject, false),
+			replyInput(replyBody, "Message", draft.Body, true),
+		}},
+	})
+	if err != nil {
+		log.Printf("Error opening reply modal for email %s: %v", email.ID, err)
+	}
+}
+
+// sendReply sends the reply written in a submitted composer
+func sendReply(payload slack.InteractionCallback) {
+	email, err := findEmail(payload.View.PrivateMetadata)
+	if err != nil {
+		return
+	}
+
+	if payload.User.ID != email.Address.User {
+		return
+	}
+
+	values := payload.View.State.Values
+	draft := compose.Draft{
+		To:        values[replyTo][replyTo].Value,
+		Subject:   values[replySubject][replySubject].Value,
+		Body:      values[replyBody][replyBody].Value,
+		InReplyTo: email.ID,
+	}
+
+	if _, err := compose.Send(stores.Domains, email.Address, draft, &email); err != nil {
+		log.Printf("ERROR: Failed to send reply from %s: %v", email.AddressID, err)
+		ephemeral(payload, email.Address.Timestamp, fmt.Sprintf("uh oh! your reply couldn't be sent: %s", err))
+		return
+	}
+
+	ephemeral(payload, email.Address.Timestamp, fmt.Sprintf(":outbox_tray: sent your reply to `%s`", draft.To))
+}
@@ -5,25 +5,46 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
+	"net/mail"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/DusanKasan/parsemail"
+	"github.com/cjdenio/temp-email/pkg/addrgen"
+	"github.com/cjdenio/temp-email/pkg/blocklist"
+	"github.com/cjdenio/temp-email/pkg/compose"
 	"github.com/cjdenio/temp-email/pkg/db"
-	"github.com/cjdenio/temp-email/pkg/mailgun"
+	"github.com/cjdenio/temp-email/pkg/dkim"
+	"github.com/cjdenio/temp-email/pkg/domains"
+	"github.com/cjdenio/temp-email/pkg/ingest"
+	"github.com/cjdenio/temp-email/pkg/inspect"
+	"github.com/cjdenio/temp-email/pkg/notify"
+	"github.com/cjdenio/temp-email/pkg/policy"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/threading"
 	"github.com/cjdenio/temp-email/pkg/util"
+	"github.com/cjdenio/temp-email/pkg/webhooks"
+	"github.com/cjdenio/temp-email/pkg/search"
+	"github.com/cjdenio/temp-email/pkg/mailgun"
 	"github.com/gin-gonic/gin"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
-	"gorm.io/gorm"
+	"github.com/slack-go/slack/socketmode"
 )
 
 var Client *slack.Client
+
+// stores holds everything the handlers read and write, set by Start
+var stores store.Stores
 var sessions = make(map[string]bool) // Simple session store
 
 func generateToken() string {
@@ -32,10 +53,15 @@ func generateToken() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
+// loggedIn reports whether the request carries a dashboard session
+func loggedIn(c *gin.Context) bool {
+	token, err := c.Cookie("auth_token")
+	return err == nil && sessions[token]
+}
+
 func authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := c.Cookie("auth_token")
-		if err != nil || !sessions[token] {
+		if !loggedIn(c) {
 			c.Redirect(302, "/login")
 			c.Abort()
 			return
@@ -44,16 +70,278 @@ func authMiddleware() gin.HandlerFunc {
 	}
 }
 
+// unlink strips the formatting Slack wraps around things that look like links,
+// e.g. "@<http://example.com|example.com>" becomes "example.com"
+func unlink(text string) string {
+	text = strings.Trim(text, "@<>")
+	if i := strings.LastIndex(text, "|"); i >= 0 {
+		text = text[i+1:]
+	}
+
+	return text
+}
+
+// parseDate reads a search filter date, either "2006-01-02" or RFC 3339. An
+// empty string is the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// paramID reads a numeric ID from the URL, reporting false if it isn't one
+func paramID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 0)
+	return uint(id), err == nil
+}
+
 func topLevelMessage(ev *slackevents.MessageEvent) bool {
 	return ev.Channel == os.Getenv("SLACK_CHANNEL") && ev.ThreadTimeStamp == ""
 }
 
-func Start() {
-	Client = slack.New(os.Getenv("SLACK_TOKEN"))
+// handleCallbackEvent dispatches an Events API callback, regardless of whether
+// it arrived over HTTP or Socket Mode.
+func handleCallbackEvent(eventsAPIEvent slackevents.EventsAPIEvent) {
+	innerEvent := eventsAPIEvent.InnerEvent
+	switch ev := innerEvent.Data.(type) {
+	case *slackevents.MessageEvent:
+		// Feature 1: Stats command
+		if ev.SubType == "" && topLevelMessage(ev) && strings.Contains(strings.ToLower(ev.Text), "email stats") {
+			totalCount, activeCount, _ := stores.Addresses.Count(time.Now())
+			
+			emailCount, _ := stores.Emails.Count()
+			
+			Client.PostMessage(ev.Channel, 
+				slack.MsgOptionText(fmt.Sprintf("📊 *Email Stats*\n\n📬 Total addresses created: %d\n✅ Currently active: %d\n📨 Total emails received: %d", totalCount, activeCount, emailCount), false),
+				slack.MsgOptionTS(ev.TimeStamp),
+			)
+		} else if ev.SubType == "" && topLevelMessage(ev) && strings.Contains(strings.ToLower(ev.Text), "gib email") {
+			// Parse custom duration and name from message
+			text := strings.ToLower(ev.Text)
+			parts := strings.Fields(text)
+			
+			// Default values
+			duration := 24 * time.Hour
+			name := ""
+			style := ""
+			
+			// Feature 2: Custom duration - check for time specs
+			for _, part := range parts {
+				if d, ok := policy.ParseTTL(part); ok {
+					duration = d
+				}
+			}
+			
+			// Address style, e.g. "gib email words", and domain, e.g.
+			// "gib email @example.com"
+			domain := ""
+			for i, part := range parts {
+				if addrgen.IsStyle(part) {
+					style = part
+				} else if strings.HasPrefix(part, "@") {
+					domain = unlink(part)
+					parts[i] = "@"
+				}
+			}
+			
+			// Feature 3: Named addresses - check for custom name
+			for i, part := range parts {
+				if part == "email" {
+					for _, nextPart := range parts[i+1:] {
+						if addrgen.IsStyle(nextPart) || nextPart == "@" {
+							continue
+						}
+						// Only use as name if it's not a duration specifier
+						if !strings.HasSuffix(nextPart, "h") && !strings.HasSuffix(nextPart, "d") {
+							name = nextPart
+						}
+						break
+					}
+					break
+				}
+			}
+			
+			generate, err := addrgen.New(style, name)
+			if err != nil {
+				Client.PostMessage(
+					ev.Channel,
+					slack.MsgOptionText(fmt.Sprintf("sorry, %s", err), false),
+					slack.MsgOptionTS(ev.TimeStamp),
+				)
+				return
+			}
+			
+			domain, err = domains.Pick(stores.Domains, domain, "")
+			if err != nil {
+				Client.PostMessage(
+					ev.Channel,
+					slack.MsgOptionText(fmt.Sprintf("sorry, %s.", err), false),
+					slack.MsgOptionTS(ev.TimeStamp),
+				)
+				return
+			}
+			
+			if err := policy.CheckCreate(stores.Addresses, ev.User, ev.Channel, duration); err != nil {
+				log.Printf("REJECT: Address request from user %s: %v", ev.User, err)
+				Client.PostMessage(
+					ev.Channel,
+					slack.MsgOptionText(fmt.Sprintf("sorry, %s", err), false),
+					slack.MsgOptionTS(ev.TimeStamp),
+				)
+				return
+			}
+
+			email := db.Address{
+				Domain:    domain,
+				CreatedAt: time.Now(),
+				ExpiresAt: time.Now().Add(duration),
+				Timestamp: ev.TimeStamp,
+				User:      ev.User,
+				Channel:   ev.Channel,
+			}
+
+			err = stores.Addresses.Create(&email, generate)
+			if err != nil {
+				log.Printf("ERROR: Failed to create address for user %s: %v", ev.User, err)
+				Client.PostMessage(
+					ev.Channel,
+					slack.MsgOptionText(fmt.Sprintf("uh oh! something went wrong creating that address. please try again or contact the admin. (error: database insert failed)"), false),
+					slack.MsgOptionTS(ev.TimeStamp),
+				)
+				return
+			}
+			address := email.ID
+			log.Printf("SUCCESS: Created address %s for user %s (expires: %s)", address, ev.User, email.ExpiresAt.Format(time.RFC3339))
+
+			err = Client.AddReaction("thumb", slack.ItemRef{
+				Channel:   ev.Channel,
+				Timestamp: ev.TimeStamp,
+			})
+			if err != nil {
+				fmt.Println(err)
+			}
+			
+			if err := notify.For(email).AddressCreated(email); err != nil {
+				log.Printf("ERROR: Failed to announce address %s: %v", address, err)
+			}
+		} else if ev.SubType == "" && topLevelMessage(ev) && strings.HasPrefix(strings.ToLower(ev.Text), "gib ") {
+			Client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("unfortunately i am unable to _%s_. maybe try _\"gib email\"_?", strings.ToLower(ev.Text)), false), slack.MsgOptionTS(ev.TimeStamp))
+		} else if (ev.SubType == "message_deleted" || (ev.SubType == "message_changed" && ev.Message.SubType == "tombstone")) && topLevelMessage(ev) {
+			address, err := stores.Addresses.FindActiveByTimestamp(ev.PreviousMessage.TimeStamp, time.Now())
+
+			if err == nil {
+				address.ExpiresAt = time.Now()
+				address.ExpiredMessageSent = true
+				if err := stores.Addresses.Save(&address); err == nil {
+					Client.PostMessage(
+						os.Getenv("SLACK_CHANNEL"),
+						slack.MsgOptionText(":x: since you deleted your message, this address has been deactivated.", false),
+						slack.MsgOptionTS(address.Timestamp),
+					)
+				}
+
+			}
+		}
+	}
+}
+
+// handleInteraction dispatches a block action or modal submission payload,
+// regardless of whether it arrived over HTTP or Socket Mode.
+func handleInteraction(payload slack.InteractionCallback) {
+	if payload.Type == slack.InteractionTypeViewSubmission && payload.View.CallbackID == notify.ActionReplyEmail {
+		sendReply(payload)
+		return
+	}
+
+	if len(payload.ActionCallback.BlockActions) == 0 {
+		return
+	}
+	action := payload.ActionCallback.BlockActions[0]
+
+	switch action.ActionID {
+	case "reactivate":
+		id := action.Value
+		address, err := stores.Addresses.Get(id)
+		if err != nil || !address.ExpiresAt.Before(time.Now()) {
+			return
+		}
+
+		if payload.User.ID != address.User {
+			Client.PostEphemeral(os.Getenv("SLACK_CHANNEL"), payload.User.ID, slack.MsgOptionTS(address.Timestamp), slack.MsgOptionText("whatcha tryin' to pull here :face_with_raised_eyebrow:", false))
+			return
+		}
+
+		if err := policy.CheckExtend(address, 24*time.Hour); err != nil {
+			Client.PostEphemeral(os.Getenv("SLACK_CHANNEL"), payload.User.ID, slack.MsgOptionTS(address.Timestamp), slack.MsgOptionText(fmt.Sprintf("sorry, %s", err), false))
+			return
+		}
+
+		address.ExpiresAt = time.Now().Add(24 * time.Hour)
+		address.Reactivations++
+		address.WarningSent = false
+		address.ExpiredMessageSent = false
+
+		stores.Addresses.Save(&address)
+
+		Client.PostMessage(
+			os.Getenv("SLACK_CHANNEL"),
+			slack.MsgOptionTS(address.Timestamp),
+			slack.MsgOptionText("This address will be available for another 24 hours!", false),
+		)
+		Client.RemoveReaction("clock1", slack.ItemRef{
+			Channel:   os.Getenv("SLACK_CHANNEL"),
+			Timestamp: address.Timestamp,
+		})
+	case notify.ActionExtend:
+		extendAddress(payload, action.SelectedOption.Value)
+	case notify.ActionShowHeaders:
+		showHeaders(payload, action.Value)
+	case notify.ActionBlockSender:
+		blockSender(payload, action.Value)
+	case notify.ActionDeleteEmail:
+		deleteEmail(payload, action.Value)
+	case notify.ActionReplyEmail:
+		openReply(payload, action.Value)
+	}
+}
+
+func Start(s store.Stores) {
+	stores = s
+
+
+	// An app-level token switches event delivery over to Socket Mode, so
+	// Slack doesn't need to be able to reach /slack/events
+	appToken := os.Getenv("SLACK_APP_TOKEN")
+	if appToken != "" {
+		Client = slack.New(os.Getenv("SLACK_TOKEN"), slack.OptionAppLevelToken(appToken))
+	} else {
+		Client = slack.New(os.Getenv("SLACK_TOKEN"))
+	}
 	
-	// Share Slack client with mailgun package to avoid import cycle
-	mailgun.SlackClient = Client
+	// Slack is one of several places notifications can go
+	notify.Setup(Client)
+
+	startEventWorkers()
+
+	if appToken != "" {
+		go startSocketMode(socketmode.New(Client))
+	}
+
+	r := newRouter()
+
+	log.Println("Starting up HTTP server...")
 
+	r.Run(":3001")
+}
+
+// newRouter sets up the HTTP routes: Slack's callbacks, the dashboard and its
+// API, and the pages emails are viewed on
+func newRouter() *gin.Engine {
 	r := gin.Default()
 
 	r.POST("/slack/events", func(c *gin.Context) {
@@ -92,130 +380,13 @@ func Start() {
 			c.Writer.Write([]byte(r.Challenge))
 		}
 		if eventsAPIEvent.Type == slackevents.CallbackEvent {
-			innerEvent := eventsAPIEvent.InnerEvent
-			switch ev := innerEvent.Data.(type) {
-			case *slackevents.MessageEvent:
-				// Feature 1: Stats command
-				if ev.SubType == "" && topLevelMessage(ev) && strings.Contains(strings.ToLower(ev.Text), "email stats") {
-					var totalCount int64
-					db.DB.Model(&db.Address{}).Count(&totalCount)
-					
-					var activeCount int64
-					db.DB.Model(&db.Address{}).Where("expires_at > NOW()").Count(&activeCount)
-					
-					var emailCount int64
-					db.DB.Model(&db.Email{}).Count(&emailCount)
-					
-					Client.PostMessage(ev.Channel, 
-						slack.MsgOptionText(fmt.Sprintf("📊 *Email Stats*\n\n📬 Total addresses created: %d\n✅ Currently active: %d\n📨 Total emails received: %d", totalCount, activeCount, emailCount), false),
-						slack.MsgOptionTS(ev.TimeStamp),
-					)
-				} else if ev.SubType == "" && topLevelMessage(ev) && strings.Contains(strings.ToLower(ev.Text), "gib email") {
-					// Parse custom duration and name from message
-					text := strings.ToLower(ev.Text)
-					parts := strings.Fields(text)
-					
-					// Default values
-					duration := 24 * time.Hour
-					prefix := ""
-					
-					// Feature 2: Custom duration - check for time specs
-					for _, part := range parts {
-						if strings.HasSuffix(part, "h") {
-							if hours := strings.TrimSuffix(part, "h"); hours != "" {
-								if h, err := time.ParseDuration(hours + "h"); err == nil {
-									duration = h
-								}
-							}
-						} else if strings.HasSuffix(part, "d") {
-							if days := strings.TrimSuffix(part, "d"); days != "" {
-								if d, err := time.ParseDuration(days + "h"); err == nil {
-									duration = d * 24
-								}
-							}
-						}
-					}
-					
-					// Feature 3: Named addresses - check for custom name
-					for i, part := range parts {
-						if part == "email" && i+1 < len(parts) {
-							nextPart := parts[i+1]
-							// Only use as name if it's not a duration specifier
-							if !strings.HasSuffix(nextPart, "h") && !strings.HasSuffix(nextPart, "d") {
-								prefix = nextPart + "-"
-							}
-							break
-						}
-					}
-					
-					address := prefix + util.GenerateEmailAddress()
-
-					err = Client.AddReaction("thumb", slack.ItemRef{
-						Channel:   ev.Channel,
-						Timestamp: ev.TimeStamp,
-					})
-					if err != nil {
-						fmt.Println(err)
-					}
-					
-					// Custom message based on duration
-					durationHours := int(duration.Hours())
-					durationText := fmt.Sprintf("%d-hour", durationHours)
-					if durationHours >= 24 {
-						durationDays := durationHours / 24
-						if durationDays == 1 {
-							durationText = "24-hour"
-						} else {
-							durationText = fmt.Sprintf("%d-day", durationDays)
-						}
-					}
-
-					Client.PostMessage(
-						ev.Channel,
-						slack.MsgOptionText(fmt.Sprintf("wahoo! your temporary %s email address is %s@%s\n\nto stop receiving emails, delete your 'gib email' message.\n\ni'll post emails in this thread :arrow_down:", durationText, address, os.Getenv("DOMAIN")), false),
-						slack.MsgOptionTS(ev.TimeStamp),
-					)
-
-					email := db.Address{
-						ID:        address,
-						CreatedAt: time.Now(),
-						ExpiresAt: time.Now().Add(duration),
-						Timestamp: ev.TimeStamp,
-						User:      ev.User,
-					}
-
-					result := db.DB.Create(&email)
-					if result.Error != nil {
-						log.Printf("ERROR: Failed to create address %s for user %s: %v", address, ev.User, result.Error)
-						Client.PostMessage(
-							ev.Channel,
-							slack.MsgOptionText(fmt.Sprintf("uh oh! something went wrong creating that address. please try again or contact the admin. (error: database insert failed)"), false),
-							slack.MsgOptionTS(ev.TimeStamp),
-						)
-						return
-					}
-					log.Printf("SUCCESS: Created address %s for user %s (expires: %s)", address, ev.User, email.ExpiresAt.Format(time.RFC3339))
-				} else if ev.SubType == "" && topLevelMessage(ev) && strings.HasPrefix(strings.ToLower(ev.Text), "gib ") {
-					Client.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("unfortunately i am unable to _%s_. maybe try _\"gib email\"_?", strings.ToLower(ev.Text)), false), slack.MsgOptionTS(ev.TimeStamp))
-				} else if (ev.SubType == "message_deleted" || (ev.SubType == "message_changed" && ev.Message.SubType == "tombstone")) && topLevelMessage(ev) {
-					var address db.Address
-					tx := db.DB.Where("timestamp = ? AND expires_at > NOW()", ev.PreviousMessage.TimeStamp).First(&address)
-
-					if tx.Error == nil {
-						address.ExpiresAt = time.Now()
-						address.ExpiredMessageSent = true
-						tx = db.DB.Save(&address)
-						if tx.Error == nil {
-							Client.PostMessage(
-								os.Getenv("SLACK_CHANNEL"),
-								slack.MsgOptionText(":x: since you deleted your message, this address has been deactivated.", false),
-								slack.MsgOptionTS(address.Timestamp),
-							)
-						}
-
-					}
-				}
+			retryNum, _ := strconv.Atoi(c.GetHeader("X-Slack-Retry-Num"))
+			if !enqueueEvent(eventsAPIEvent, retryNum) {
+				// Anything but a 2xx makes Slack retry the event later
+				c.Status(http.StatusServiceUnavailable)
+				return
 			}
+			c.Status(http.StatusOK)
 		}
 	})
 
@@ -242,43 +413,23 @@ func Start() {
 		form, err := url.ParseQuery(string(body))
 		if err != nil {
 			fmt.Println(err)
+			c.Writer.WriteHeader(http.StatusBadRequest)
+			return
 		}
 
 		var payload slack.InteractionCallback
 
 		err = json.Unmarshal([]byte(form.Get("payload")), &payload)
 		if err != nil {
-			fmt.Printf("Could not parse action response JSON: %v", err)
+			fmt.Printf("Could not parse action response JSON: %v\n", err)
+			c.Writer.WriteHeader(http.StatusBadRequest)
+			return
 		}
 
-		if payload.ActionCallback.BlockActions[0].ActionID == "reactivate" {
-			id := payload.ActionCallback.BlockActions[0].Value
-			var address db.Address
-			tx := db.DB.Where("id = ? AND expires_at < NOW()", id).First(&address)
-			if tx.Error != nil {
-				return
-			}
-
-			if payload.User.ID != address.User {
-				Client.PostEphemeral(os.Getenv("SLACK_CHANNEL"), payload.User.ID, slack.MsgOptionTS(address.Timestamp), slack.MsgOptionText("whatcha tryin' to pull here :face_with_raised_eyebrow:", false))
-				return
-			}
-
-			address.ExpiresAt = time.Now().Add(24 * time.Hour)
-			address.ExpiredMessageSent = false
-
-			db.DB.Save(&address)
-
-			Client.PostMessage(
-				os.Getenv("SLACK_CHANNEL"),
-				slack.MsgOptionTS(address.Timestamp),
-				slack.MsgOptionText("This address will be available for another 24 hours!", false),
-			)
-			Client.RemoveReaction("clock1", slack.ItemRef{
-				Channel:   os.Getenv("SLACK_CHANNEL"),
-				Timestamp: address.Timestamp,
-			})
-		}
+		// Slack wants an answer within 3 seconds, and a reply being sent can
+		// take longer, so ack first and handle it in the background
+		c.Status(http.StatusOK)
+		go interactions(payload)
 	})
 
 	// Login routes
@@ -320,122 +471,851 @@ func Start() {
 	})
 
 	r.GET("/api/addresses", authMiddleware(), func(c *gin.Context) {
-		var addresses []db.Address
-		db.DB.Order("created_at DESC").Find(&addresses)
+		addresses, _ := stores.Addresses.List()
 		c.JSON(200, addresses)
 	})
 
 	r.GET("/api/emails/:addressId", authMiddleware(), func(c *gin.Context) {
-		var emails []db.Email
-		db.DB.Where("address_id = ?", c.Param("addressId")).Order("created_at DESC").Find(&emails)
+		var tag *string
+		if value, ok := c.GetQuery("tag"); ok {
+			tag = &value
+		}
+		emails, _ := stores.Emails.List(c.Param("addressId"), tag)
+		c.JSON(200, emails)
+	})
+
+	r.GET("/api/emails/:addressId/tags", authMiddleware(), func(c *gin.Context) {
+		tags, _ := stores.Emails.Tags(c.Param("addressId"))
+		c.JSON(200, tags)
+	})
+
+	r.GET("/api/addresses/:id/threads", authMiddleware(), func(c *gin.Context) {
+		emails, _ := stores.Emails.List(c.Param("id"), nil)
+		c.JSON(200, threading.Summarize(emails))
+	})
+
+	r.GET("/api/addresses/:id/threads/:threadId", authMiddleware(), func(c *gin.Context) {
+		emails, _ := stores.Emails.Thread(c.Param("id"), c.Param("threadId"))
+		if len(emails) == 0 {
+			c.JSON(404, gin.H{"error": "Conversation not found"})
+			return
+		}
 		c.JSON(200, emails)
 	})
 
 	r.GET("/api/email/:emailId", authMiddleware(), func(c *gin.Context) {
-		var email db.Email
-		if err := db.DB.Where("id = ?", c.Param("emailId")).First(&email).Error; err != nil {
+		email, err := stores.Emails.Get(c.Param("emailId"))
+		if err != nil {
 			c.JSON(404, gin.H{"error": "Email not found"})
 			return
 		}
 		c.JSON(200, email)
 	})
 
+	r.GET("/api/email/:emailId/reply", authMiddleware(), func(c *gin.Context) {
+		email, err := stores.Emails.Get(c.Param("emailId"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Email not found"})
+			return
+		}
+
+		c.JSON(200, compose.ReplyTo(email))
+	})
+
+	r.GET("/api/email/:emailId/headers", authMiddleware(), func(c *gin.Context) {
+		email, err := stores.Emails.Get(c.Param("emailId"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Email not found"})
+			return
+		}
+
+		report, err := inspect.Inspect(email.Content)
+		if err != nil {
+			c.JSON(422, gin.H{"error": "Couldn't parse this email's headers"})
+			return
+		}
+		c.JSON(200, report)
+	})
+
+	r.POST("/api/addresses/:id/send", authMiddleware(), func(c *gin.Context) {
+		var draft compose.Draft
+		if err := c.BindJSON(&draft); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		address, err := stores.Addresses.Get(c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Address not found"})
+			return
+		}
+
+		var original *db.Email
+		if draft.InReplyTo != "" {
+			email, err := stores.Emails.Get(draft.InReplyTo)
+			if err != nil || email.AddressID != address.ID {
+				c.JSON(404, gin.H{"error": "Email being replied to not found"})
+				return
+			}
+			original = &email
+		}
+
+		messageID, err := compose.Send(stores.Domains, address, draft, original)
+		if err == compose.ErrNotConfigured || err == compose.ErrExpired || err == compose.ErrInvalidRecipient {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			log.Printf("ERROR: Failed to send mail from %s: %v", address.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to send: " + err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"messageId": messageID})
+	})
+
 	r.POST("/api/addresses", authMiddleware(), func(c *gin.Context) {
 		var req struct {
-			Name     string `json:"name"`
-			Duration int    `json:"duration"` // in hours
+			Name         string `json:"name"`
+			Duration     int    `json:"duration"` // in hours
+			Style        string `json:"style"`
+			Domain       string `json:"domain"`
+			Pool         string `json:"pool"`
+			Notifier     string `json:"notifier"`
+			NotifyTarget string `json:"notifyTarget"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+		if err := notify.Validate(req.Notifier, req.NotifyTarget); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		generate, err := addrgen.New(req.Style, req.Name)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		domain, err := domains.Pick(stores.Domains, req.Domain, req.Pool)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		duration := 24
+		if req.Duration > 0 {
+			duration = req.Duration
+		}
+
+		// The dashboard is admin-only and everyone on it shares one login,
+		// so only the lifetime limits apply, not the per-user quotas
+		if int64(duration) > int64(math.MaxInt64/time.Hour) {
+			c.JSON(400, gin.H{"error": "Invalid duration"})
+			return
+		}
+		if err := policy.CheckTTL(time.Duration(duration) * time.Hour); err != nil {
+			log.Printf("REJECT: Address request via dashboard: %v", err)
+			c.JSON(403, gin.H{"error": err.Error()})
+			return
+		}
+
+		address := db.Address{
+			Domain:       domain,
+			CreatedAt:    time.Now(),
+			ExpiresAt:    time.Now().Add(time.Duration(duration) * time.Hour),
+			Timestamp:    "",
+			User:         "dashboard",
+			Notifier:     req.Notifier,
+			NotifyTarget: req.NotifyTarget,
+		}
+
+		err = stores.Addresses.Create(&address, generate)
+		if err != nil {
+			log.Printf("ERROR: Failed to create address via dashboard: %v", err)
+			c.JSON(500, gin.H{
+				"error": "Failed to create address in database",
+				"details": err.Error(),
+			})
+			return
+		}
+		
+		log.Printf("SUCCESS: Created address %s via dashboard (expires: %s)", address.ID, address.ExpiresAt.Format(time.RFC3339))
+
+		// Dashboard addresses do NOT send to Slack, but can be pointed at
+		// another notifier. Admin can view emails directly in the dashboard
+		if err := notify.For(address).AddressCreated(address); err != nil {
+			log.Printf("ERROR: Failed to announce address %s: %v", address.ID, err)
+		}
+
+		c.JSON(200, address)
+	})
+
+	r.GET("/api/domains", authMiddleware(), func(c *gin.Context) {
+		list, _ := stores.Domains.List()
+		c.JSON(200, list)
+	})
+
+	r.POST("/api/domains", authMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Name string `json:"name"`
+			Pool string `json:"pool"`
+		}
+		if err := c.BindJSON(&req); err != nil || domains.Normalize(req.Name) == "" {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		// New domains stay disabled until their DNS records check out
+		domain := db.Domain{
+			Name:              domains.Normalize(req.Name),
+			CreatedAt:         time.Now(),
+			Pool:              req.Pool,
+			VerificationToken: domains.NewVerificationToken(),
+		}
+		if domain.Pool == "" {
+			domain.Pool = domains.DefaultPool
+		}
+
+		if err := stores.Domains.Create(&domain); err != nil {
+			log.Printf("ERROR: Failed to add domain %s: %v", domain.Name, err)
+			c.JSON(500, gin.H{"error": "Failed to add domain"})
+			return
+		}
+
+		log.Printf("SUCCESS: Added domain %s to pool %s, awaiting verification", domain.Name, domain.Pool)
+		c.JSON(200, gin.H{
+			"domain":  domain,
+			"records": domains.Records(domain),
+		})
+	})
+
+	r.GET("/api/domains/:name/records", authMiddleware(), func(c *gin.Context) {
+		domain, err := stores.Domains.Get(domains.Normalize(c.Param("name")))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Domain not found"})
+			return
+		}
+
+		res := gin.H{
+			"domain":  domain,
+			"records": domains.Records(domain),
+		}
+		if record, ok := domains.DKIMRecord(domain); ok {
+			res["dkim"] = record
+		}
+		c.JSON(200, res)
+	})
+
+	r.POST("/api/domains/:name/verify", authMiddleware(), func(c *gin.Context) {
+		domain, err := stores.Domains.Get(domains.Normalize(c.Param("name")))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Domain not found"})
+			return
+		}
+
+		checks := domains.CheckAndSave(stores.Domains, domains.DefaultResolver(), &domain)
+
+		c.JSON(200, gin.H{
+			"domain": domain,
+			"checks": checks,
+		})
+	})
+
+	r.PATCH("/api/domains/:name", authMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Pool    *string `json:"pool"`
+			Enabled *bool   `json:"enabled"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		domain, err := stores.Domains.Get(domains.Normalize(c.Param("name")))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Domain not found"})
+			return
+		}
+
+		if req.Pool != nil && *req.Pool != "" {
+			domain.Pool = *req.Pool
+		}
+		if req.Enabled != nil {
+			if *req.Enabled && !domain.Verified {
+				c.JSON(409, gin.H{"error": "Domain must pass DNS verification before it can be enabled"})
+				return
+			}
+			domain.Enabled = *req.Enabled
+		}
+		stores.Domains.Save(&domain)
+
+		log.Printf("SUCCESS: Updated domain %s (pool: %s, enabled: %t)", domain.Name, domain.Pool, domain.Enabled)
+		c.JSON(200, domain)
+	})
+
+	// Generates (or imports) the key outgoing mail from a domain is signed with
+	r.POST("/api/domains/:name/dkim", authMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Selector   string `json:"selector"`
+			PrivateKey string `json:"privateKey"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+		if req.Selector == "" {
+			req.Selector = dkim.DefaultSelector
+		}
+		if !dkim.ValidSelector(req.Selector) {
+			c.JSON(400, gin.H{"error": "Invalid selector"})
+			return
+		}
+
+		domain, err := stores.Domains.Get(domains.Normalize(c.Param("name")))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Domain not found"})
+			return
+		}
+
+		if req.PrivateKey == "" {
+			key, err := dkim.GenerateKey()
+			if err != nil {
+				log.Printf("ERROR: Failed to generate DKIM key for %s: %v", domain.Name, err)
+				c.JSON(500, gin.H{"error": "Failed to generate key"})
+				return
+			}
+			req.PrivateKey = key
+		} else if _, err := dkim.ParseKey(req.PrivateKey); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		domain.DKIMSelector = strings.ToLower(req.Selector)
+		domain.DKIMPrivateKey = req.PrivateKey
+		if err := stores.Domains.Save(&domain); err != nil {
+			log.Printf("ERROR: Failed to save DKIM key for %s: %v", domain.Name, err)
+			c.JSON(500, gin.H{"error": "Failed to save key"})
+			return
+		}
+
+		record, _ := domains.DKIMRecord(domain)
+
+		log.Printf("SUCCESS: Set DKIM key for %s with selector %s", domain.Name, domain.DKIMSelector)
+		c.JSON(200, gin.H{
+			"domain": domain,
+			"dkim":   record,
+		})
+	})
+
+	r.DELETE("/api/domains/:name/dkim", authMiddleware(), func(c *gin.Context) {
+		domain, err := stores.Domains.Get(domains.Normalize(c.Param("name")))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Domain not found"})
+			return
+		}
+
+		domain.DKIMSelector = ""
+		domain.DKIMPrivateKey = ""
+		stores.Domains.Save(&domain)
+
+		log.Printf("SUCCESS: Removed DKIM key for %s", domain.Name)
+		c.JSON(200, domain)
+	})
+
+	r.DELETE("/api/addresses/:id", authMiddleware(), func(c *gin.Context) {
+		address, err := stores.Addresses.Get(c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Address not found"})
+			return
+		}
+
+		address.ExpiresAt = time.Now()
+		stores.Addresses.Save(&address)
+
+		// Only send Slack notification if address was created via Slack (has timestamp)
+		if address.Timestamp != "" {
+			Client.PostMessage(
+				os.Getenv("SLACK_CHANNEL"),
+				slack.MsgOptionText("Admin deactivated email address", false),
+				slack.MsgOptionBlocks(
+					slack.NewSectionBlock(
+						slack.NewTextBlockObject(
+							slack.MarkdownType,
+							fmt.Sprintf("*👤 Admin Action*\n\nDeactivated email address via dashboard\n\n`%s@%s`", 
+								address.ID, 
+								address.Domain,
+							),
+							false,
+							false,
+						),
+						nil,
+						nil,
+					),
+				),
+			)
+		}
+
+		c.JSON(200, gin.H{"success": true})
+	})
+
+	r.POST("/api/addresses/:id/extend", authMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Hours int `json:"hours"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+		duration := time.Duration(req.Hours) * time.Hour
+
+		address, err := stores.Addresses.Get(c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Address not found"})
+			return
+		}
+
+		// Same limits as the Slack Extend menu
+		if err := policy.CheckExtend(address, duration); err != nil {
+			c.JSON(403, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now()
+		extend(&address, duration, now)
+		if err := stores.Addresses.Save(&address); err != nil {
+			log.Printf("ERROR: Failed to extend address %s: %v", address.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to extend address"})
+			return
+		}
+
+		log.Printf("SUCCESS: Extended address %s by %s via dashboard (expires: %s)", address.ID, duration, address.ExpiresAt.Format(time.RFC3339))
+
+		if address.Timestamp != "" {
+			Client.PostMessage(
+				os.Getenv("SLACK_CHANNEL"),
+				slack.MsgOptionTS(address.Timestamp),
+				slack.MsgOptionText(fmt.Sprintf("An admin extended this address; it will be available for another %s!", util.FormatDuration(address.ExpiresAt.Sub(now).Round(time.Hour))), false),
+			)
+			Client.RemoveReaction("clock1", slack.ItemRef{
+				Channel:   os.Getenv("SLACK_CHANNEL"),
+				Timestamp: address.Timestamp,
+			})
+		}
+
+		c.JSON(200, address)
+	})
+
+	r.PATCH("/api/addresses/:id", authMiddleware(), func(c *gin.Context) {
+		// A null retentionDays goes back to the global RETENTION_DAYS
+		var req struct {
+			RetentionDays *int `json:"retentionDays"`
+		}
+		if err := c.BindJSON(&req); err != nil || (req.RetentionDays != nil && *req.RetentionDays < 0) {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		address, err := stores.Addresses.Get(c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Address not found"})
+			return
+		}
+
+		address.RetentionDays = req.RetentionDays
+		if err := stores.Addresses.Save(&address); err != nil {
+			log.Printf("ERROR: Failed to update address %s: %v", address.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to update address"})
+			return
+		}
+
+		c.JSON(200, address)
+	})
+
+	r.PUT("/api/addresses/:id/notifier", authMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Notifier     string `json:"notifier"`
+			NotifyTarget string `json:"notifyTarget"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+		if err := notify.Validate(req.Notifier, req.NotifyTarget); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		address, err := stores.Addresses.Get(c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Address not found"})
+			return
+		}
+
+		address.Notifier = req.Notifier
+		address.NotifyTarget = req.NotifyTarget
+		if err := stores.Addresses.Save(&address); err != nil {
+			log.Printf("ERROR: Failed to update notifier for %s: %v", address.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to update address"})
+			return
+		}
+
+		log.Printf("SUCCESS: Set notifier for %s to %q", address.ID, address.Notifier)
+		c.JSON(200, address)
+	})
+
+	r.GET("/api/addresses/:id/rules", authMiddleware(), func(c *gin.Context) {
+		rules, _ := stores.Senders.Rules(c.Param("id"))
+		c.JSON(200, rules)
+	})
+
+	r.POST("/api/addresses/:id/rules", authMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Pattern string `json:"pattern"`
+			Allow   bool   `json:"allow"`
+		}
+		if err := c.BindJSON(&req); err != nil || ingest.NormalizePattern(req.Pattern) == "" {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		address, err := stores.Addresses.Get(c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Address not found"})
+			return
+		}
+
+		rule := db.SenderRule{
+			CreatedAt: time.Now(),
+			AddressID: address.ID,
+			Pattern:   ingest.NormalizePattern(req.Pattern),
+			Allow:     req.Allow,
+		}
+		if err := stores.Senders.AddRule(&rule); err != nil {
+			log.Printf("ERROR: Failed to add sender rule for %s: %v", address.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to add rule"})
+			return
+		}
+
+		log.Printf("SUCCESS: Added sender rule %q (allow: %t) for %s", rule.Pattern, rule.Allow, address.ID)
+		c.JSON(200, rule)
+	})
+
+	r.DELETE("/api/addresses/:id/rules/:ruleId", authMiddleware(), func(c *gin.Context) {
+		ruleID, ok := paramID(c, "ruleId")
+		if !ok || stores.Senders.DeleteRule(c.Param("id"), ruleID) != nil {
+			c.JSON(404, gin.H{"error": "Rule not found"})
+			return
+		}
+		c.JSON(200, gin.H{"success": true})
+	})
+
+	r.GET("/api/addresses/:id/forwards", authMiddleware(), func(c *gin.Context) {
+		forwards, _ := stores.Forwards.List(c.Param("id"))
+		c.JSON(200, forwards)
+	})
+
+	r.POST("/api/addresses/:id/forwards", authMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Destination string `json:"destination"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+		destination, err := mail.ParseAddress(req.Destination)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid email address"})
+			return
+		}
+
+		address, err := stores.Addresses.Get(c.Param("id"))
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Address not found"})
+			return
+		}
+		if strings.EqualFold(destination.Address, address.ID+"@"+address.Domain) {
+			c.JSON(400, gin.H{"error": "An address can't forward to itself"})
+			return
+		}
+
+		forward, err := ingest.AddForward(stores.Forwards, address, strings.ToLower(destination.Address))
+		if err == ingest.ErrForwardingDisabled {
+			c.JSON(400, gin.H{"error": "Forwarding isn't set up on this server"})
+			return
+		} else if err != nil {
+			log.Printf("ERROR: Failed to add forward for %s to %s: %v", address.ID, destination.Address, err)
+			c.JSON(500, gin.H{"error": "Failed to send the confirmation email"})
+			return
+		}
+
+		log.Printf("SUCCESS: Sent forwarding confirmation for %s to %s", address.ID, forward.Destination)
+		c.JSON(200, forward)
+	})
+
+	r.DELETE("/api/addresses/:id/forwards/:forwardId", authMiddleware(), func(c *gin.Context) {
+		forwardID, ok := paramID(c, "forwardId")
+		if !ok || stores.Forwards.Delete(c.Param("id"), forwardID) != nil {
+			c.JSON(404, gin.H{"error": "Forward not found"})
+			return
+		}
+		c.JSON(200, gin.H{"success": true})
+	})
+
+	// Opened from the link in the confirmation email, so no login is needed
+	// Opening the link only shows a button, so mail scanners and link
+	// previews that fetch it don't confirm anything
+	r.GET("/forward/confirm/:token", func(c *gin.Context) {
+		forward, err := stores.Forwards.FindByToken(c.Param("token"))
+		if err == store.ErrNotFound {
+			c.String(404, "404 this confirmation link isn't valid :(")
+			return
+		} else if err != nil {
+			c.String(500, "aaaaaaaaaaaaaaaaaaaa something went wrong")
+			return
+		}
+
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.String(200, getForwardConfirmHTML(forward))
+	})
+
+	r.POST("/forward/confirm/:token", func(c *gin.Context) {
+		forward, err := ingest.ConfirmForward(stores.Forwards, c.Param("token"))
+		if err == store.ErrNotFound {
+			c.String(404, "404 this confirmation link isn't valid :(")
+			return
+		} else if err != nil {
+			c.String(500, "aaaaaaaaaaaaaaaaaaaa something went wrong")
+			return
+		}
+
+		log.Printf("SUCCESS: Confirmed forwarding for %s to %s", forward.AddressID, forward.Destination)
+		c.String(200, "forwarding confirmed! mail sent to this address will now be forwarded to %s", forward.Destination)
+	})
+
+	r.GET("/api/addresses/:id/blocked", authMiddleware(), func(c *gin.Context) {
+		blocked, _ := stores.Senders.Blocked(c.Param("id"), 100)
+		c.JSON(200, blocked)
+	})
+
+	r.GET("/api/v1/search", authMiddleware(), func(c *gin.Context) {
+		query := search.Query{
+			Text:      strings.TrimSpace(c.Query("q")),
+			AddressID: c.Query("address"),
+			Sender:    c.Query("sender"),
+		}
+		if query.Text == "" {
+			c.JSON(400, gin.H{"error": "Missing search query"})
+			return
+		}
+
+		var err error
+		if query.Since, err = parseDate(c.Query("since")); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid since date"})
+			return
+		}
+		if query.Until, err = parseDate(c.Query("until")); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid until date"})
+			return
+		}
+		if limit := c.Query("limit"); limit != "" {
+			if query.Limit, err = strconv.Atoi(limit); err != nil {
+				c.JSON(400, gin.H{"error": "Invalid limit"})
+				return
+			}
+		}
+
+		hits, err := stores.Search.Search(query)
+		if err != nil {
+			log.Printf("ERROR: Search for %q failed: %v", query.Text, err)
+			c.JSON(500, gin.H{"error": "Search failed"})
+			return
+		}
+
+		c.JSON(200, hits)
+	})
+
+	r.GET("/api/blocklist", authMiddleware(), func(c *gin.Context) {
+		list, _ := stores.GlobalRules.List()
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Kind != list[j].Kind {
+				return list[i].Kind < list[j].Kind
+			}
+			return list[i].Pattern < list[j].Pattern
+		})
+		c.JSON(200, list)
+	})
+
+	r.POST("/api/blocklist", authMiddleware(), func(c *gin.Context) {
+		var req struct {
+			Kind    string `json:"kind"`
+			Pattern string `json:"pattern"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		pattern, err := blocklist.Normalize(req.Kind, req.Pattern)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		rule := db.GlobalRule{
+			CreatedAt: time.Now(),
+			Kind:      req.Kind,
+			Pattern:   pattern,
+		}
+		if err := stores.GlobalRules.Create(&rule); err != nil {
+			log.Printf("ERROR: Failed to add global %s rule %q: %v", rule.Kind, rule.Pattern, err)
+			c.JSON(500, gin.H{"error": "Failed to add rule"})
+			return
+		}
+		if err := blocklist.Reload(stores.GlobalRules); err != nil {
+			log.Printf("ERROR: Failed to reload global blocklist: %v", err)
+		}
+
+		log.Printf("SUCCESS: Added global %s rule %q", rule.Kind, rule.Pattern)
+		c.JSON(200, rule)
+	})
+
+	r.DELETE("/api/blocklist/:id", authMiddleware(), func(c *gin.Context) {
+		id, ok := paramID(c, "id")
+		if !ok || stores.GlobalRules.Delete(id) != nil {
+			c.JSON(404, gin.H{"error": "Rule not found"})
+			return
+		}
+		if err := blocklist.Reload(stores.GlobalRules); err != nil {
+			log.Printf("ERROR: Failed to reload global blocklist: %v", err)
+		}
+
+		c.JSON(200, gin.H{"success": true})
+	})
+
+	r.GET("/api/webhooks", authMiddleware(), func(c *gin.Context) {
+		list, _ := stores.Webhooks.List()
+		c.JSON(200, list)
+	})
+
+	r.POST("/api/webhooks", authMiddleware(), func(c *gin.Context) {
+		// An empty addressId makes the webhook global
+		var req struct {
+			URL       string `json:"url"`
+			AddressID string `json:"addressId"`
 		}
 		if err := c.BindJSON(&req); err != nil {
 			c.JSON(400, gin.H{"error": "Invalid request"})
 			return
 		}
 
-		prefix := ""
-		if req.Name != "" {
-			prefix = req.Name + "-"
+		target, err := url.Parse(strings.TrimSpace(req.URL))
+		if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+			c.JSON(400, gin.H{"error": "Webhook URL must be an http or https URL"})
+			return
 		}
-		duration := 24
-		if req.Duration > 0 {
-			duration = req.Duration
+		if req.AddressID != "" {
+			if _, err := stores.Addresses.Get(req.AddressID); err != nil {
+				c.JSON(404, gin.H{"error": "Address not found"})
+				return
+			}
 		}
 
-		address := db.Address{
-			ID:        prefix + util.GenerateEmailAddress(),
+		hook := db.Webhook{
 			CreatedAt: time.Now(),
-			ExpiresAt: time.Now().Add(time.Duration(duration) * time.Hour),
-			Timestamp: "",
-			User:      "dashboard",
+			AddressID: req.AddressID,
+			URL:       target.String(),
+			Secret:    webhooks.NewSecret(),
 		}
-
-		result := db.DB.Create(&address)
-		if result.Error != nil {
-			log.Printf("ERROR: Failed to create address %s via dashboard: %v", address.ID, result.Error)
-			c.JSON(500, gin.H{
-				"error": "Failed to create address in database",
-				"details": result.Error.Error(),
-			})
+		if err := stores.Webhooks.Create(&hook); err != nil {
+			log.Printf("ERROR: Failed to add webhook %s: %v", hook.URL, err)
+			c.JSON(500, gin.H{"error": "Failed to add webhook"})
 			return
 		}
-		
-		log.Printf("SUCCESS: Created address %s via dashboard (expires: %s)", address.ID, address.ExpiresAt.Format(time.RFC3339))
 
-		// Dashboard addresses do NOT send to Slack
-		// Admin can view emails directly in the dashboard
+		log.Printf("SUCCESS: Added webhook %d for %q", hook.ID, hook.AddressID)
 
-		c.JSON(200, address)
+		// The secret isn't included anywhere else, so this is the only
+		// chance to copy it
+		c.JSON(200, struct {
+			db.Webhook
+			Secret string
+		}{hook, hook.Secret})
 	})
 
-	r.DELETE("/api/addresses/:id", authMiddleware(), func(c *gin.Context) {
-		var address db.Address
-		if err := db.DB.Where("id = ?", c.Param("id")).First(&address).Error; err != nil {
-			c.JSON(404, gin.H{"error": "Address not found"})
+	r.DELETE("/api/webhooks/:id", authMiddleware(), func(c *gin.Context) {
+		id, ok := paramID(c, "id")
+		if !ok || stores.Webhooks.Delete(id) != nil {
+			c.JSON(404, gin.H{"error": "Webhook not found"})
 			return
 		}
 
-		address.ExpiresAt = time.Now()
-		db.DB.Save(&address)
+		c.JSON(200, gin.H{"success": true})
+	})
 
-		// Only send Slack notification if address was created via Slack (has timestamp)
-		if address.Timestamp != "" {
-			Client.PostMessage(
-				os.Getenv("SLACK_CHANNEL"),
-				slack.MsgOptionText("Admin deactivated email address", false),
-				slack.MsgOptionBlocks(
-					slack.NewSectionBlock(
-						slack.NewTextBlockObject(
-							slack.MarkdownType,
-							fmt.Sprintf("*👤 Admin Action*\n\nDeactivated email address via dashboard\n\n`%s@%s`", 
-								address.ID, 
-								os.Getenv("DOMAIN"),
-							),
-							false,
-							false,
-						),
-						nil,
-						nil,
-					),
-				),
-			)
+	r.GET("/api/webhooks/:id/deliveries", authMiddleware(), func(c *gin.Context) {
+		id, _ := paramID(c, "id")
+		deliveries, _ := stores.Webhooks.Deliveries(id, 100)
+		c.JSON(200, deliveries)
+	})
+
+	r.POST("/api/webhooks/deliveries/:id/replay", authMiddleware(), func(c *gin.Context) {
+		id, ok := paramID(c, "id")
+		if !ok {
+			c.JSON(404, gin.H{"error": "Delivery not found"})
+			return
 		}
 
-		c.JSON(200, gin.H{"success": true})
+		delivery, err := webhooks.Replay(stores.Webhooks, id)
+		if err == store.ErrNotFound {
+			c.JSON(404, gin.H{"error": "Delivery not found"})
+			return
+		} else if err != nil {
+			log.Printf("ERROR: Failed to replay webhook delivery %s: %v", c.Param("id"), err)
+			c.JSON(500, gin.H{"error": "Failed to replay delivery"})
+			return
+		}
+
+		c.JSON(200, delivery)
 	})
 
 	// Mailgun webhook endpoints (MUST be before /:email catch-all route)
-	r.POST("/webhook/mailgun", mailgun.HandleWebhook)
-	r.POST("/webhook/mailgun/raw", mailgun.HandleRawWebhook)
+	mailgunHandler := mailgun.Handler{Stores: stores}
+	r.POST("/webhook/mailgun", mailgunHandler.HandleWebhook)
+	r.POST("/webhook/mailgun/raw", mailgunHandler.HandleRawWebhook)
 
 	r.GET("/:email", func(c *gin.Context) {
-		var rawEmail db.Email
-		tx := db.DB.Where("id = ?", c.Param("email")).First(&rawEmail)
-		if tx.Error == gorm.ErrRecordNotFound {
+		id := c.Param("email")
+		download := strings.HasSuffix(id, ".eml")
+		id = strings.TrimSuffix(id, ".eml")
+
+		rawEmail, err := stores.Emails.Get(id)
+		if err == store.ErrNotFound {
 			c.String(404, "404 email not found :(")
 			return
-		} else if tx.Error != nil {
+		} else if err != nil {
 			c.String(500, "aaaaaaaaaaaaaaaaaaaa something went wrong")
 			return
 		}
 
+		// Quarantined mail is only shown to dashboard users
+		if rawEmail.Quarantined && !loggedIn(c) {
+			c.String(404, "404 email not found :(")
+			return
+		}
+
+		// Infected mail can't be downloaded at all
+		if download && rawEmail.Virus != "" {
+			c.String(403, "this email contains malware and can't be downloaded")
+			return
+		}
+
+		if download {
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", rawEmail.ID+".eml"))
+			c.Header("X-Content-Type-Options", "nosniff")
+			c.Data(200, "message/rfc822", []byte(rawEmail.Content))
+			return
+		}
+
 		email, err := parsemail.Parse(strings.NewReader(rawEmail.Content))
 		if err != nil {
 			c.String(500, "aaaaaaaaaaaaaaaaaaaa something went wrong")
@@ -458,23 +1338,103 @@ func Start() {
 		}
 	})
 
+	// The message exactly as it was received, shown as text rather than
+	// downloaded
+	r.GET("/:email/raw", func(c *gin.Context) {
+		rawEmail, err := stores.Emails.Get(c.Param("email"))
+		if err != nil || (rawEmail.Quarantined && !loggedIn(c)) {
+			c.String(404, "404 email not found :(")
+			return
+		}
+		if rawEmail.Virus != "" {
+			c.String(403, "this email contains malware and can't be downloaded")
+			return
+		}
+
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Data(200, "text/plain; charset=utf-8", []byte(rawEmail.Content))
+	})
+
+	// Header inspector: the Received chain as hops, plus authentication and
+	// mailing list headers. Only headers are shown, so infected mail can be
+	// inspected too.
+	r.GET("/:email/headers", func(c *gin.Context) {
+		rawEmail, err := stores.Emails.Get(c.Param("email"))
+		if err != nil || (rawEmail.Quarantined && !loggedIn(c)) {
+			c.String(404, "404 email not found :(")
+			return
+		}
+
+		report, err := inspect.Inspect(rawEmail.Content)
+		if err != nil {
+			c.String(500, "aaaaaaaaaaaaaaaaaaaa something went wrong")
+			return
+		}
+
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(200)
+		if err := headersTemplate.Execute(c.Writer, headersPage{Email: rawEmail, Report: report}); err != nil {
+			log.Printf("ERROR: Failed to render headers for %s: %v", rawEmail.ID, err)
+		}
+	})
+
+	// Attachments are numbered in the order they appear in the message, as
+	// listed in webhook payloads
+	r.GET("/:email/attachments/:index", func(c *gin.Context) {
+		rawEmail, err := stores.Emails.Get(c.Param("email"))
+		if err != nil || (rawEmail.Quarantined && !loggedIn(c)) {
+			c.String(404, "404 email not found :(")
+			return
+		}
+		if rawEmail.Virus != "" {
+			c.String(403, "this email contains malware and can't be downloaded")
+			return
+		}
+
+		email, err := parsemail.Parse(strings.NewReader(rawEmail.Content))
+		if err != nil {
+			c.String(500, "aaaaaaaaaaaaaaaaaaaa something went wrong")
+			return
+		}
+
+		index, err := strconv.Atoi(c.Param("index"))
+		if err != nil || index < 0 || index >= len(email.Attachments) {
+			c.String(404, "404 attachment not found :(")
+			return
+		}
+
+		attachment := email.Attachments[index]
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		// Always download rather than render, so attachments can't run
+		// scripts on this origin
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.Filename))
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.DataFromReader(200, -1, contentType, attachment.Data, nil)
+	})
+
 	// Debug endpoint to check if address exists
 	r.GET("/api/check/:addressId", func(c *gin.Context) {
 		addressId := c.Param("addressId")
-		var address db.Address
-		tx := db.DB.Where("id = ? AND expires_at > NOW()", addressId).First(&address)
+		address, err := stores.Addresses.Get(addressId)
+		if err == nil && !address.ExpiresAt.After(time.Now()) {
+			err = store.ErrNotFound
+		}
 		
-		if tx.Error == gorm.ErrRecordNotFound {
+		if err == store.ErrNotFound {
 			c.JSON(404, gin.H{
 				"found": false,
 				"error": "address not found or expired",
 				"id": addressId,
 			})
 			return
-		} else if tx.Error != nil {
+		} else if err != nil {
 			c.JSON(500, gin.H{
 				"found": false,
-				"error": tx.Error.Error(),
+				"error": err.Error(),
 				"id": addressId,
 			})
 			return
@@ -490,9 +1450,7 @@ func Start() {
 		})
 	})
 
-	log.Println("Starting up HTTP server...")
-
-	r.Run(":3001")
+	return r
 }
 
 func getDashboardHTML() string {
@@ -933,6 +1891,115 @@ func getDashboardHTML() string {
             color: var(--danger);
         }
 
+        .status-badge.pending {
+            background: #fef7e0;
+            color: #b06000;
+        }
+
+        .tag-badge {
+            display: inline-flex;
+            align-items: center;
+            padding: 2px 8px;
+            margin-left: 8px;
+            border-radius: 4px;
+            font-size: 12px;
+            font-weight: 500;
+            background: var(--primary-light);
+            color: var(--primary);
+        }
+
+        .search-hit {
+            cursor: pointer;
+        }
+
+        .search-snippet {
+            margin-top: 4px;
+            font-size: 13px;
+            color: var(--text-secondary);
+        }
+
+        .search-hit mark {
+            background: #fef7cd;
+            color: inherit;
+        }
+
+        .tag-badge.spam-badge {
+            background: #fce8e6;
+            color: var(--danger);
+        }
+
+        .tag-filters {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 8px;
+            margin-bottom: 16px;
+        }
+
+        .tag-filter {
+            padding: 4px 12px;
+            border-radius: 16px;
+            border: 1px solid var(--border);
+            background: var(--surface);
+            color: var(--text-secondary);
+            font-size: 13px;
+            cursor: pointer;
+            transition: var(--transition);
+        }
+
+        .tag-filter:hover {
+            background: var(--surface-hover);
+        }
+
+        .tag-filter.active {
+            background: var(--primary-light);
+            border-color: var(--primary);
+            color: var(--primary);
+        }
+
+        .thread-group {
+            border: 1px solid var(--border);
+            border-radius: 8px;
+            padding: 12px;
+            margin-bottom: 16px;
+        }
+
+        .thread-header {
+            padding: 4px 4px 12px;
+            font-size: 14px;
+        }
+
+        .sender-rules {
+            margin-top: 32px;
+        }
+
+        .sender-rule {
+            display: flex;
+            align-items: center;
+            justify-content: space-between;
+            padding: 8px 12px;
+            border: 1px solid var(--border);
+            border-radius: 4px;
+            margin-bottom: 8px;
+            font-size: 13px;
+        }
+
+        .sender-rule-form {
+            display: flex;
+            gap: 8px;
+            margin-top: 12px;
+        }
+
+        .sender-rule-form .form-input {
+            flex: 1;
+        }
+
+        .blocked-email {
+            padding: 8px 12px;
+            border-bottom: 1px solid var(--border);
+            font-size: 13px;
+            color: var(--text-secondary);
+        }
+
         /* Email Preview Pane */
         .email-preview {
             flex: 1;
@@ -1079,6 +2146,17 @@ func getDashboardHTML() string {
             display: block;
         }
 
+        .email-links {
+            margin-bottom: 12px;
+            font-size: 13px;
+        }
+
+        .email-links a {
+            color: var(--primary);
+            text-decoration: none;
+            margin-right: 16px;
+        }
+
         .email-iframe {
             width: 100%;
             border: none;
@@ -1355,7 +2433,7 @@ func getDashboardHTML() string {
             </div>
             <div class="search-bar">
                 <span class="material-icons search-icon">search</span>
-                <input type="text" class="search-input" placeholder="Search addresses..." id="searchInput" oninput="filterAddresses()">
+                <input type="text" class="search-input" placeholder="Search addresses and emails..." id="searchInput" oninput="filterAddresses()">
             </div>
             <div class="header-actions">
                 <button class="icon-btn" onclick="loadAddresses()" title="Refresh">
@@ -1390,6 +2468,14 @@ func getDashboardHTML() string {
                     <span>Expired</span>
                     <span class="badge" id="expiredBadge">0</span>
                 </div>
+                <div class="nav-item" onclick="openBlocklistModal()">
+                    <span class="material-icons">block</span>
+                    <span>Blocklist</span>
+                </div>
+                <div class="nav-item" onclick="openWebhooksModal()">
+                    <span class="material-icons">webhook</span>
+                    <span>Webhooks</span>
+                </div>
             </nav>
         </aside>
 
@@ -1428,35 +2514,147 @@ func getDashboardHTML() string {
     <div class="modal-overlay" id="composeModal">
         <div class="modal">
             <div class="modal-header">
-                <h2 class="modal-title">Create New Address</h2>
-                <button class="modal-close" onclick="closeComposeModal()">
+                <h2 class="modal-title">Create New Address</h2>
+                <button class="modal-close" onclick="closeComposeModal()">
+                    <span class="material-icons">close</span>
+                </button>
+            </div>
+            <form id="composeForm" onsubmit="createAddress(event)">
+                <div class="modal-body">
+                    <div class="form-field">
+                        <label class="form-label" for="addressName">Custom Name (Optional)</label>
+                        <input type="text" id="addressName" class="form-input" placeholder="e.g., github, newsletter, testing">
+                        <div class="form-helper">Adds a prefix to your email address</div>
+                    </div>
+                    <div class="form-field">
+                        <label class="form-label" for="addressStyle">Style</label>
+                        <select id="addressStyle" class="form-select">
+                            <option value="">Default</option>
+                            <option value="random">Random characters (x7q2k9)</option>
+                            <option value="words">Words (brave-otter-4821)</option>
+                            <option value="syllables">Syllables (bakotumide)</option>
+                        </select>
+                        <div class="form-helper">Ignored when a custom name is given</div>
+                    </div>
+                    <div class="form-field">
+                        <label class="form-label" for="addressDomain">Domain</label>
+                        <select id="addressDomain" class="form-select">
+                            <option value="">Random from pool</option>
+                        </select>
+                        <div class="form-helper">Pick a domain if a site blocks the usual one</div>
+                    </div>
+                    <div class="form-field">
+                        <label class="form-label" for="addressDuration">Duration</label>
+                        <select id="addressDuration" class="form-select">
+                            <option value="24">24 hours</option>
+                            <option value="48">2 days</option>
+                            <option value="72">3 days</option>
+                            <option value="168">1 week</option>
+                            <option value="336">2 weeks</option>
+                        </select>
+                        <div class="form-helper">How long this address should remain active</div>
+                    </div>
+                    <div class="form-field">
+                        <label class="form-label" for="addressNotifier">Notifications</label>
+                        <select id="addressNotifier" class="form-select">
+                            <option value="">None (dashboard only)</option>
+                            <option value="discord">Discord</option>
+                            <option value="teams">Microsoft Teams</option>
+                            <option value="matrix">Matrix</option>
+                        </select>
+                        <input type="text" id="addressNotifyTarget" class="form-input" style="margin-top: 8px;" placeholder="Webhook URL, Discord channel ID or Matrix room ID">
+                        <div class="form-helper">Where to post new mail and expiry reminders</div>
+                    </div>
+                </div>
+                <div class="modal-footer">
+                    <button type="button" class="btn btn-outline" onclick="closeComposeModal()">Cancel</button>
+                    <button type="submit" class="btn btn-primary">
+                        <span class="material-icons">add</span>
+                        Create Address
+                    </button>
+                </div>
+            </form>
+        </div>
+    </div>
+
+    <!-- Global Blocklist Modal -->
+    <div class="modal-overlay" id="blocklistModal">
+        <div class="modal">
+            <div class="modal-header">
+                <h2 class="modal-title">Global Blocklist</h2>
+                <button class="modal-close" onclick="closeBlocklistModal()">
+                    <span class="material-icons">close</span>
+                </button>
+            </div>
+            <div class="modal-body">
+                <div id="blocklistItems"></div>
+                <form class="sender-rule-form" onsubmit="addGlobalRule(event)">
+                    <select id="globalRuleKind" class="form-select" style="width: auto;">
+                        <option value="sender">Sender</option>
+                        <option value="domain">Domain</option>
+                        <option value="ip">IP / CIDR</option>
+                        <option value="subject">Subject regex</option>
+                    </select>
+                    <input type="text" id="globalRulePattern" class="form-input" placeholder="spam@example.com, example.com, 192.0.2.0/24 or ^win big" required>
+                    <button type="submit" class="btn btn-primary">Add</button>
+                </form>
+                <div class="form-helper">Applies to every address. IP rules only apply to mail received over SMTP.</div>
+            </div>
+        </div>
+    </div>
+
+    <!-- Webhooks Modal -->
+    <div class="modal-overlay" id="webhooksModal">
+        <div class="modal">
+            <div class="modal-header">
+                <h2 class="modal-title">Webhooks</h2>
+                <button class="modal-close" onclick="closeWebhooksModal()">
+                    <span class="material-icons">close</span>
+                </button>
+            </div>
+            <div class="modal-body">
+                <div id="webhookItems"></div>
+                <form class="sender-rule-form" onsubmit="addWebhook(event)">
+                    <input type="url" id="webhookURL" class="form-input" placeholder="https://example.com/hooks/mail" required>
+                    <input type="text" id="webhookAddress" class="form-input" style="width: 160px;" placeholder="Address ID (optional)">
+                    <button type="submit" class="btn btn-primary">Add</button>
+                </form>
+                <div class="form-helper">Each new email is POSTed as JSON, signed with the webhook's secret. Leave the address empty to receive mail for every address.</div>
+                <div id="webhookDeliveries"></div>
+            </div>
+        </div>
+    </div>
+
+    <!-- Send Mail Modal -->
+    <div class="modal-overlay" id="sendModal">
+        <div class="modal">
+            <div class="modal-header">
+                <h2 class="modal-title" id="sendTitle">New Message</h2>
+                <button class="modal-close" onclick="closeSendModal()">
                     <span class="material-icons">close</span>
                 </button>
             </div>
-            <form id="composeForm" onsubmit="createAddress(event)">
+            <form id="sendForm" onsubmit="sendMessage(event)">
                 <div class="modal-body">
+                    <div class="form-helper" id="sendFrom" style="margin-bottom: 16px;"></div>
                     <div class="form-field">
-                        <label class="form-label" for="addressName">Custom Name (Optional)</label>
-                        <input type="text" id="addressName" class="form-input" placeholder="e.g., github, newsletter, testing">
-                        <div class="form-helper">Adds a prefix to your email address</div>
+                        <label class="form-label" for="sendTo">To</label>
+                        <input type="text" id="sendTo" class="form-input" placeholder="someone@example.com" required>
                     </div>
                     <div class="form-field">
-                        <label class="form-label" for="addressDuration">Duration</label>
-                        <select id="addressDuration" class="form-select">
-                            <option value="24">24 hours</option>
-                            <option value="48">2 days</option>
-                            <option value="72">3 days</option>
-                            <option value="168">1 week</option>
-                            <option value="336">2 weeks</option>
-                        </select>
-                        <div class="form-helper">How long this address should remain active</div>
+                        <label class="form-label" for="sendSubject">Subject</label>
+                        <input type="text" id="sendSubject" class="form-input">
+                    </div>
+                    <div class="form-field">
+                        <label class="form-label" for="sendBody">Message</label>
+                        <textarea id="sendBody" class="form-input" rows="10" style="font-family: inherit; resize: vertical;"></textarea>
                     </div>
                 </div>
                 <div class="modal-footer">
-                    <button type="button" class="btn btn-outline" onclick="closeComposeModal()">Cancel</button>
-                    <button type="submit" class="btn btn-primary">
-                        <span class="material-icons">add</span>
-                        Create Address
+                    <button type="button" class="btn btn-outline" onclick="closeSendModal()">Cancel</button>
+                    <button type="submit" class="btn btn-primary" id="sendButton">
+                        <span class="material-icons">send</span>
+                        Send
                     </button>
                 </div>
             </form>
@@ -1492,6 +2690,8 @@ func getDashboardHTML() string {
         let addresses = [];
         let currentFilter = 'all';
         let selectedAddressId = null;
+        let selectedTag = null; // null shows every tag, '' shows untagged mail
+        let groupThreads = false; // group the selected address's mail into conversations
 
         // Initialize
         document.addEventListener('DOMContentLoaded', function() {
@@ -1505,8 +2705,26 @@ func getDashboardHTML() string {
         }
 
         // Compose Modal
-        function openComposeModal() {
+        async function openComposeModal() {
             document.getElementById('composeModal').classList.add('active');
+            await loadDomains();
+        }
+
+        async function loadDomains() {
+            try {
+                const res = await fetch(API_BASE + '/api/domains');
+                const domains = await res.json() || [];
+                const select = document.getElementById('addressDomain');
+                select.innerHTML = '<option value="">Random from pool</option>';
+                for (const d of domains.filter(d => d.Enabled && d.Verified)) {
+                    const option = document.createElement('option');
+                    option.value = d.Name;
+                    option.textContent = d.Name + ' (' + d.Pool + ')';
+                    select.appendChild(option);
+                }
+            } catch (error) {
+                console.error('Error loading domains:', error);
+            }
         }
 
         function closeComposeModal() {
@@ -1519,20 +2737,26 @@ func getDashboardHTML() string {
             e.preventDefault();
             const name = document.getElementById('addressName').value;
             const duration = parseInt(document.getElementById('addressDuration').value);
+            const style = name ? '' : document.getElementById('addressStyle').value;
+            const domain = document.getElementById('addressDomain').value;
+            const notifier = document.getElementById('addressNotifier').value;
+            const notifyTarget = notifier ? document.getElementById('addressNotifyTarget').value : '';
 
             try {
                 const res = await fetch(API_BASE + '/api/addresses', {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
-                    body: JSON.stringify({ name, duration })
+                    body: JSON.stringify({ name, duration, style, domain, notifier, notifyTarget })
                 });
 
+                const data = await res.json();
                 if (res.ok) {
                     closeComposeModal();
                     await loadAddresses();
                     // Auto-select the new address
-                    const data = await res.json();
                     selectAddress(data.ID);
+                } else {
+                    alert(data.error || 'Failed to create address');
                 }
             } catch (error) {
                 console.error('Error creating address:', error);
@@ -1626,7 +2850,13 @@ func getDashboardHTML() string {
         }
 
         // Select Address and Load Preview
-        async function selectAddress(addressId) {
+        async function selectAddress(addressId, tag) {
+            if (addressId !== selectedAddressId || tag === undefined) {
+                selectedTag = null;
+            }
+            if (tag !== undefined) {
+                selectedTag = tag;
+            }
             selectedAddressId = addressId;
             renderAddressList(); // Update active state in list
 
@@ -1640,12 +2870,20 @@ func getDashboardHTML() string {
 
                 const now = new Date();
                 const isActive = new Date(address.ExpiresAt) > now;
-                const domain = window.location.hostname.replace('mail.', '');
+                const domain = address.Domain || window.location.hostname.replace('mail.', '');
                 const fullEmail = addressId + '@' + domain;
 
                 // Load emails for this address
                 const emailRes = await fetch(API_BASE + '/api/emails/' + addressId);
-                const emails = await emailRes.json();
+                const allEmails = await emailRes.json() || [];
+
+                // Group by plus-address tag
+                const tagCounts = {};
+                for (const email of allEmails) {
+                    tagCounts[email.Tag || ''] = (tagCounts[email.Tag || ''] || 0) + 1;
+                }
+                const tags = Object.keys(tagCounts).sort();
+                const emails = selectedTag === null ? allEmails : allEmails.filter(e => (e.Tag || '') === selectedTag);
 
                 // Build preview HTML
                 let html = '<div class="preview-header">' +
@@ -1667,6 +2905,12 @@ func getDashboardHTML() string {
                         '<button class="btn btn-outline" onclick="copyToClipboard(\'' + fullEmail + '\')">' +
                             '<span class="material-icons">content_copy</span> Copy Address' +
                         '</button>' +
+                        (isActive ? '<button class="btn btn-outline" onclick="openSendModal(\'' + addressId + '\')">' +
+                            '<span class="material-icons">edit</span> Compose' +
+                        '</button>' : '') +
+                        '<button class="btn btn-outline" onclick="extendAddress(\'' + addressId + '\')">' +
+                            '<span class="material-icons">more_time</span> Extend' +
+                        '</button>' +
                         '<button class="btn btn-danger" onclick="deleteAddress(\'' + addressId + '\')">' +
                             '<span class="material-icons">delete</span> Delete' +
                         '</button>' +
@@ -1682,29 +2926,31 @@ func getDashboardHTML() string {
                     '</div>';
                 } else {
                     html += '<h3 style="font-size: 14px; font-weight: 500; color: var(--text-secondary); margin-bottom: 16px; text-transform: uppercase; letter-spacing: 0.5px;">Received Emails (' + emails.length + ')</h3>';
+
+                    html += '<div class="tag-filters">' +
+                        '<button class="tag-filter' + (groupThreads ? ' active' : '') + '" onclick="toggleThreads(\'' + addressId + '\')">Conversations</button>';
+                    if (tags.length > 1 || (tags.length === 1 && tags[0] !== '')) {
+                        html += '<button class="tag-filter' + (selectedTag === null ? ' active' : '') + '" onclick="selectAddress(\'' + addressId + '\', null)">All (' + allEmails.length + ')</button>';
+                        for (const tag of tags) {
+                            html += '<button class="tag-filter' + (selectedTag === tag ? ' active' : '') + '" onclick="selectAddress(\'' + addressId + '\', \'' + tag + '\')">' +
+                                (tag ? '+' + tag : 'Untagged') + ' (' + tagCounts[tag] + ')</button>';
+                        }
+                    }
+                    html += '</div>';
                     
-                    for (const email of emails) {
-                        const emailDate = formatDateTime(email.CreatedAt);
-                        html += '<div class="received-email" id="email-' + email.ID + '">' +
-                            '<div class="received-email-header" onclick="toggleEmail(\'' + email.ID + '\')">' +
-                                '<div class="received-email-info">' +
-                                    '<div class="received-email-from">' +
-                                        '<span class="material-icons" style="font-size: 16px; vertical-align: middle; margin-right: 4px;">email</span>' +
-                                        'Email #' + email.ID.substring(0, 8) +
-                                    '</div>' +
-                                    '<div class="received-email-time">' + emailDate + '</div>' +
-                                '</div>' +
-                                '<button class="btn btn-outline" style="padding: 6px 12px; font-size: 13px;">' +
-                                    '<span class="material-icons" style="font-size: 16px;">open_in_new</span> View' +
-                                '</button>' +
-                            '</div>' +
-                            '<div class="received-email-body" id="email-body-' + email.ID + '">' +
-                                '<iframe class="email-iframe" src="/' + email.ID + '" onload="resizeIframe(this)"></iframe>' +
-                            '</div>' +
-                        '</div>';
+                    if (groupThreads) {
+                        html += await renderThreads(emails, addressId, isActive);
+                    } else {
+                        for (const email of emails) {
+                            html += renderEmailRow(email, addressId, isActive);
+                        }
                     }
                 }
 
+                html += await renderSenderRules(addressId);
+                html += await renderForwards(addressId);
+                html += renderNotifier(address);
+
                 html += '</div>';
                 previewPane.innerHTML = html;
             } catch (error) {
@@ -1713,6 +2959,451 @@ func getDashboardHTML() string {
             }
         }
 
+        // One received email, collapsed until clicked
+        function renderEmailRow(email, addressId, isActive) {
+            const emailDate = formatDateTime(email.CreatedAt);
+            return '<div class="received-email" id="email-' + email.ID + '">' +
+                '<div class="received-email-header" onclick="toggleEmail(\'' + email.ID + '\')">' +
+                    '<div class="received-email-info">' +
+                        '<div class="received-email-from">' +
+                            '<span class="material-icons" style="font-size: 16px; vertical-align: middle; margin-right: 4px;">email</span>' +
+                            'Email #' + email.ID.substring(0, 8) +
+                            (email.Tag ? '<span class="tag-badge">+' + email.Tag + '</span>' : '') +
+                            (email.Quarantined ? '<span class="tag-badge spam-badge">Quarantined: ' + escapeHTML(email.Virus || email.QuarantineReason) + '</span>' : '') +
+                            (email.Spam && !email.Quarantined ? '<span class="tag-badge spam-badge">Spam</span>' : '') +
+                            (email.SpamSymbols ? '<span class="tag-badge spam-badge" title="' + escapeHTML(email.SpamSymbols) + '">Score ' + email.SpamScore.toFixed(1) + '</span>' : '') +
+                        '</div>' +
+                        '<div class="received-email-time">' + emailDate + '</div>' +
+                    '</div>' +
+                    (isActive ? '<button class="btn btn-outline" style="padding: 6px 12px; font-size: 13px; margin-right: 8px;" onclick="event.stopPropagation(); openSendModal(\'' + addressId + '\', \'' + email.ID + '\')">' +
+                        '<span class="material-icons" style="font-size: 16px;">reply</span> Reply' +
+                    '</button>' : '') +
+                    '<button class="btn btn-outline" style="padding: 6px 12px; font-size: 13px;">' +
+                        '<span class="material-icons" style="font-size: 16px;">open_in_new</span> View' +
+                    '</button>' +
+                '</div>' +
+                '<div class="received-email-body" id="email-body-' + email.ID + '">' +
+                    '<div class="email-links">' +
+                        '<a href="/' + email.ID + '/headers" target="_blank">Inspect headers</a>' +
+                        '<a href="/' + email.ID + '/raw" target="_blank">Raw source</a>' +
+                        (email.Virus ? '' : '<a href="/' + email.ID + '.eml">Download .eml</a>') +
+                    '</div>' +
+                    '<iframe class="email-iframe" src="/' + email.ID + '" onload="resizeIframe(this)"></iframe>' +
+                '</div>' +
+                '</div>';
+        }
+
+        // Emails grouped into conversations, most recently active first
+        async function renderThreads(emails, addressId, isActive) {
+            const threads = await (await fetch(API_BASE + '/api/addresses/' + addressId + '/threads')).json() || [];
+
+            let html = '';
+            for (const thread of threads) {
+                const members = emails.filter(e => (e.ThreadID || e.ID) === thread.threadId).reverse();
+                if (members.length === 0) {
+                    continue;
+                }
+
+                html += '<div class="thread-group">' +
+                    '<div class="thread-header">' +
+                        '<span class="material-icons" style="font-size: 18px; vertical-align: middle; margin-right: 4px;">forum</span>' +
+                        '<strong>' + escapeHTML(thread.subject || '(no subject)') + '</strong>' +
+                        (thread.count > 1 ? '<span class="tag-badge">' + thread.count + ' messages</span>' : '') +
+                        '<div class="received-email-time">' + escapeHTML(thread.senders.join(', ')) + ' &middot; ' + formatDateTime(thread.lastAt) + '</div>' +
+                    '</div>';
+                for (const email of members) {
+                    html += renderEmailRow(email, addressId, isActive);
+                }
+                html += '</div>';
+            }
+
+            return html;
+        }
+
+        function toggleThreads(addressId) {
+            groupThreads = !groupThreads;
+            selectAddress(addressId, selectedTag);
+        }
+
+        function escapeHTML(text) {
+            const div = document.createElement('div');
+            div.textContent = text || '';
+            return div.innerHTML;
+        }
+
+        // Sender allowlist/blocklist and recently rejected mail
+        async function renderSenderRules(addressId) {
+            const rules = await (await fetch(API_BASE + '/api/addresses/' + addressId + '/rules')).json() || [];
+            const blocked = await (await fetch(API_BASE + '/api/addresses/' + addressId + '/blocked')).json() || [];
+            const sectionTitle = 'font-size: 14px; font-weight: 500; color: var(--text-secondary); margin-bottom: 16px; text-transform: uppercase; letter-spacing: 0.5px;';
+
+            let html = '<div class="sender-rules">' +
+                '<h3 style="' + sectionTitle + '">Sender Rules</h3>';
+
+            if (rules.length === 0) {
+                html += '<div class="empty-text" style="margin-bottom: 8px;">Mail from any sender is accepted</div>';
+            }
+            for (const rule of rules) {
+                html += '<div class="sender-rule">' +
+                    '<span><span class="status-badge ' + (rule.Allow ? 'active' : 'expired') + '">' + (rule.Allow ? 'Allow' : 'Block') + '</span> ' + escapeHTML(rule.Pattern) + '</span>' +
+                    '<button class="btn btn-outline" style="padding: 4px 10px; font-size: 12px;" onclick="deleteSenderRule(\'' + addressId + '\', ' + rule.ID + ')">Remove</button>' +
+                '</div>';
+            }
+
+            html += '<form class="sender-rule-form" onsubmit="addSenderRule(event, \'' + addressId + '\')">' +
+                    '<input type="text" id="rulePattern" class="form-input" placeholder="sender@example.com or example.com" required>' +
+                    '<select id="ruleAllow" class="form-select" style="width: auto;">' +
+                        '<option value="false">Block</option>' +
+                        '<option value="true">Allow only</option>' +
+                    '</select>' +
+                    '<button type="submit" class="btn btn-primary">Add</button>' +
+                '</form>';
+
+            if (blocked.length > 0) {
+                html += '<h3 style="' + sectionTitle + ' margin-top: 24px;">Blocked (' + blocked.length + ')</h3>';
+                for (const b of blocked) {
+                    html += '<div class="blocked-email">' +
+                        formatDateTime(b.CreatedAt) + ' &middot; <strong>' + escapeHTML(b.Sender) + '</strong>' +
+                        (b.Subject ? ' &middot; ' + escapeHTML(b.Subject) : '') +
+                        ' &middot; ' + escapeHTML(b.Reason) +
+                    '</div>';
+                }
+            }
+
+            return html + '</div>';
+        }
+
+        async function addSenderRule(e, addressId) {
+            e.preventDefault();
+            const pattern = document.getElementById('rulePattern').value;
+            const allow = document.getElementById('ruleAllow').value === 'true';
+
+            const res = await fetch(API_BASE + '/api/addresses/' + addressId + '/rules', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ pattern, allow })
+            });
+            if (!res.ok) {
+                const data = await res.json();
+                alert(data.error || 'Failed to add rule');
+                return;
+            }
+            selectAddress(addressId, selectedTag);
+        }
+
+        async function deleteSenderRule(addressId, ruleId) {
+            await fetch(API_BASE + '/api/addresses/' + addressId + '/rules/' + ruleId, { method: 'DELETE' });
+            selectAddress(addressId, selectedTag);
+        }
+
+        // Mailboxes this address's mail is forwarded to
+        async function renderForwards(addressId) {
+            const forwards = await (await fetch(API_BASE + '/api/addresses/' + addressId + '/forwards')).json() || [];
+            const sectionTitle = 'font-size: 14px; font-weight: 500; color: var(--text-secondary); margin-bottom: 16px; text-transform: uppercase; letter-spacing: 0.5px;';
+
+            let html = '<div class="sender-rules">' +
+                '<h3 style="' + sectionTitle + '">Forwarding</h3>';
+
+            if (forwards.length === 0) {
+                html += '<div class="empty-text" style="margin-bottom: 8px;">Mail isn\'t forwarded anywhere</div>';
+            }
+            for (const forward of forwards) {
+                html += '<div class="sender-rule">' +
+                    '<span><span class="status-badge ' + (forward.ConfirmedAt ? 'active' : 'pending') + '">' + (forward.ConfirmedAt ? 'Confirmed' : 'Pending') + '</span> ' + escapeHTML(forward.Destination) + '</span>' +
+                    '<button class="btn btn-outline" style="padding: 4px 10px; font-size: 12px;" onclick="deleteForward(\'' + addressId + '\', ' + forward.ID + ')">Remove</button>' +
+                '</div>';
+            }
+
+            html += '<form class="sender-rule-form" onsubmit="addForward(event, \'' + addressId + '\')">' +
+                    '<input type="email" id="forwardDestination" class="form-input" placeholder="you@example.com" required>' +
+                    '<button type="submit" class="btn btn-primary">Forward</button>' +
+                '</form>';
+
+            return html + '</div>';
+        }
+
+        async function addForward(e, addressId) {
+            e.preventDefault();
+            const destination = document.getElementById('forwardDestination').value;
+
+            const res = await fetch(API_BASE + '/api/addresses/' + addressId + '/forwards', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ destination })
+            });
+            if (!res.ok) {
+                const data = await res.json();
+                alert(data.error || 'Failed to add forward');
+                return;
+            }
+            alert('A confirmation link was sent to ' + destination + '. Mail is forwarded once it\'s opened.');
+            selectAddress(addressId, selectedTag);
+        }
+
+        async function deleteForward(addressId, forwardId) {
+            await fetch(API_BASE + '/api/addresses/' + addressId + '/forwards/' + forwardId, { method: 'DELETE' });
+            selectAddress(addressId, selectedTag);
+        }
+
+        // Where this address's notifications go
+        function renderNotifier(address) {
+            const sectionTitle = 'font-size: 14px; font-weight: 500; color: var(--text-secondary); margin-bottom: 16px; text-transform: uppercase; letter-spacing: 0.5px;';
+            const options = [
+                ['', address.Timestamp ? 'Slack thread' : 'None (dashboard only)'],
+                ['discord', 'Discord'],
+                ['teams', 'Microsoft Teams'],
+                ['matrix', 'Matrix']
+            ];
+
+            let html = '<div class="sender-rules">' +
+                '<h3 style="' + sectionTitle + '">Notifications</h3>' +
+                '<form class="sender-rule-form" onsubmit="saveNotifier(event, \'' + address.ID + '\')">' +
+                    '<select id="notifierKind" class="form-select" style="width: auto;">';
+            for (const [value, label] of options) {
+                const selected = (address.Notifier === 'slack' ? '' : address.Notifier || '') === value;
+                html += '<option value="' + value + '"' + (selected ? ' selected' : '') + '>' + label + '</option>';
+            }
+            html += '</select>' +
+                    '<input type="text" id="notifierTarget" class="form-input" placeholder="Webhook URL, channel ID or room ID" value="' + escapeHTML(address.NotifyTarget) + '">' +
+                    '<button type="submit" class="btn btn-primary">Save</button>' +
+                '</form>';
+
+            return html + '</div>';
+        }
+
+        async function saveNotifier(e, addressId) {
+            e.preventDefault();
+            const notifier = document.getElementById('notifierKind').value;
+            const notifyTarget = notifier ? document.getElementById('notifierTarget').value : '';
+
+            const res = await fetch(API_BASE + '/api/addresses/' + addressId + '/notifier', {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ notifier, notifyTarget })
+            });
+            if (!res.ok) {
+                const data = await res.json();
+                alert(data.error || 'Failed to save notifications');
+                return;
+            }
+            await loadAddresses();
+            selectAddress(addressId, selectedTag);
+        }
+
+        // Global Blocklist
+        async function openBlocklistModal() {
+            document.getElementById('blocklistModal').classList.add('active');
+            await loadBlocklist();
+        }
+
+        function closeBlocklistModal() {
+            document.getElementById('blocklistModal').classList.remove('active');
+        }
+
+        async function loadBlocklist() {
+            const container = document.getElementById('blocklistItems');
+            try {
+                const rules = await (await fetch(API_BASE + '/api/blocklist')).json() || [];
+                if (rules.length === 0) {
+                    container.innerHTML = '<div class="empty-text" style="margin-bottom: 8px;">No global rules yet</div>';
+                    return;
+                }
+
+                let html = '';
+                for (const rule of rules) {
+                    html += '<div class="sender-rule">' +
+                        '<span><span class="status-badge expired">' + rule.Kind + '</span> ' + escapeHTML(rule.Pattern) +
+                            ' <span style="color: var(--text-secondary);">&middot; ' + rule.Hits + ' hit' + (rule.Hits === 1 ? '' : 's') +
+                            (rule.LastHitAt ? ', last ' + formatDateTime(rule.LastHitAt) : '') + '</span></span>' +
+                        '<button class="btn btn-outline" style="padding: 4px 10px; font-size: 12px;" onclick="deleteGlobalRule(' + rule.ID + ')">Remove</button>' +
+                    '</div>';
+                }
+                container.innerHTML = html;
+            } catch (error) {
+                console.error('Error loading blocklist:', error);
+            }
+        }
+
+        async function addGlobalRule(e) {
+            e.preventDefault();
+            const kind = document.getElementById('globalRuleKind').value;
+            const pattern = document.getElementById('globalRulePattern').value;
+
+            const res = await fetch(API_BASE + '/api/blocklist', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ kind, pattern })
+            });
+            if (!res.ok) {
+                const data = await res.json();
+                alert(data.error || 'Failed to add rule');
+                return;
+            }
+            document.getElementById('globalRulePattern').value = '';
+            await loadBlocklist();
+        }
+
+        async function deleteGlobalRule(id) {
+            await fetch(API_BASE + '/api/blocklist/' + id, { method: 'DELETE' });
+            await loadBlocklist();
+        }
+
+        // Sending mail from an address, either fresh or as a reply
+        let sending = null;
+
+        async function openSendModal(addressId, emailId) {
+            const address = addresses.find(a => a.ID === addressId);
+            let draft = { to: '', subject: '', body: '' };
+            if (emailId) {
+                const res = await fetch(API_BASE + '/api/email/' + emailId + '/reply');
+                if (res.ok) {
+                    draft = await res.json();
+                }
+            }
+
+            sending = { addressId, emailId };
+            document.getElementById('sendTitle').textContent = emailId ? 'Reply' : 'New Message';
+            document.getElementById('sendFrom').textContent = 'From ' + (address ? address.ID + '@' + address.Domain : addressId);
+            document.getElementById('sendTo').value = draft.to;
+            document.getElementById('sendSubject').value = draft.subject;
+            document.getElementById('sendBody').value = draft.body;
+            document.getElementById('sendModal').classList.add('active');
+            document.getElementById(emailId ? 'sendBody' : 'sendTo').focus();
+            if (emailId) {
+                document.getElementById('sendBody').setSelectionRange(0, 0);
+            }
+        }
+
+        function closeSendModal() {
+            document.getElementById('sendModal').classList.remove('active');
+            sending = null;
+        }
+
+        async function sendMessage(e) {
+            e.preventDefault();
+            const button = document.getElementById('sendButton');
+            button.disabled = true;
+
+            try {
+                const res = await fetch(API_BASE + '/api/addresses/' + sending.addressId + '/send', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({
+                        to: document.getElementById('sendTo').value,
+                        subject: document.getElementById('sendSubject').value,
+                        body: document.getElementById('sendBody').value,
+                        inReplyTo: sending.emailId || ''
+                    })
+                });
+                if (!res.ok) {
+                    const data = await res.json();
+                    alert(data.error || 'Failed to send');
+                    return;
+                }
+                closeSendModal();
+            } finally {
+                button.disabled = false;
+            }
+        }
+
+        // Webhooks
+        async function openWebhooksModal() {
+            document.getElementById('webhooksModal').classList.add('active');
+            document.getElementById('webhookDeliveries').innerHTML = '';
+            await loadWebhooks();
+        }
+
+        function closeWebhooksModal() {
+            document.getElementById('webhooksModal').classList.remove('active');
+        }
+
+        async function loadWebhooks() {
+            const container = document.getElementById('webhookItems');
+            try {
+                const hooks = await (await fetch(API_BASE + '/api/webhooks')).json() || [];
+                if (hooks.length === 0) {
+                    container.innerHTML = '<div class="empty-text" style="margin-bottom: 8px;">No webhooks yet</div>';
+                    return;
+                }
+
+                let html = '';
+                for (const hook of hooks) {
+                    html += '<div class="sender-rule">' +
+                        '<span><span class="status-badge active">' + (hook.AddressID ? escapeHTML(hook.AddressID) : 'All') + '</span> ' + escapeHTML(hook.URL) + '</span>' +
+                        '<span>' +
+                            '<button class="btn btn-outline" style="padding: 4px 10px; font-size: 12px;" onclick="loadDeliveries(' + hook.ID + ')">Deliveries</button> ' +
+                            '<button class="btn btn-outline" style="padding: 4px 10px; font-size: 12px;" onclick="deleteWebhook(' + hook.ID + ')">Remove</button>' +
+                        '</span>' +
+                    '</div>';
+                }
+                container.innerHTML = html;
+            } catch (error) {
+                console.error('Error loading webhooks:', error);
+            }
+        }
+
+        async function addWebhook(e) {
+            e.preventDefault();
+            const url = document.getElementById('webhookURL').value;
+            const addressId = document.getElementById('webhookAddress').value.trim();
+
+            const res = await fetch(API_BASE + '/api/webhooks', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ url, addressId })
+            });
+            if (!res.ok) {
+                const data = await res.json();
+                alert(data.error || 'Failed to add webhook');
+                return;
+            }
+            const hook = await res.json();
+            prompt('Copy the signing secret now; it won\'t be shown again.', hook.Secret);
+            document.getElementById('webhookURL').value = '';
+            document.getElementById('webhookAddress').value = '';
+            await loadWebhooks();
+        }
+
+        async function deleteWebhook(id) {
+            await fetch(API_BASE + '/api/webhooks/' + id, { method: 'DELETE' });
+            document.getElementById('webhookDeliveries').innerHTML = '';
+            await loadWebhooks();
+        }
+
+        async function loadDeliveries(webhookId) {
+            const container = document.getElementById('webhookDeliveries');
+            const deliveries = await (await fetch(API_BASE + '/api/webhooks/' + webhookId + '/deliveries')).json() || [];
+
+            let html = '<h3 style="font-size: 14px; font-weight: 500; color: var(--text-secondary); margin: 24px 0 16px; text-transform: uppercase; letter-spacing: 0.5px;">Recent Deliveries</h3>';
+            if (deliveries.length === 0) {
+                html += '<div class="empty-text">Nothing delivered yet</div>';
+            }
+            for (const d of deliveries) {
+                const badge = d.Status === 'delivered' ? 'active' : 'expired';
+                html += '<div class="blocked-email" style="display: flex; justify-content: space-between; align-items: center;">' +
+                    '<span><span class="status-badge ' + badge + '">' + d.Status + '</span> ' +
+                        formatDateTime(d.CreatedAt) + ' &middot; email ' + escapeHTML(d.EmailID.substring(0, 8)) +
+                        ' &middot; ' + d.Attempts + ' attempt' + (d.Attempts === 1 ? '' : 's') +
+                        (d.ResponseCode ? ' &middot; HTTP ' + d.ResponseCode : '') +
+                        (d.LastError ? ' &middot; ' + escapeHTML(d.LastError) : '') +
+                        (d.Status === 'pending' && d.NextAttemptAt ? ' &middot; next try ' + formatDateTime(d.NextAttemptAt) : '') +
+                    '</span>' +
+                    '<button class="btn btn-outline" style="padding: 4px 10px; font-size: 12px;" onclick="replayDelivery(' + d.ID + ', ' + webhookId + ')">Replay</button>' +
+                '</div>';
+            }
+            container.innerHTML = html;
+        }
+
+        async function replayDelivery(id, webhookId) {
+            const res = await fetch(API_BASE + '/api/webhooks/deliveries/' + id + '/replay', { method: 'POST' });
+            if (!res.ok) {
+                const data = await res.json();
+                alert(data.error || 'Failed to replay delivery');
+                return;
+            }
+            await loadDeliveries(webhookId);
+        }
+
         // Toggle Email Expand
         function toggleEmail(emailId) {
             const body = document.getElementById('email-body-' + emailId);
@@ -1729,6 +3420,28 @@ func getDashboardHTML() string {
         }
 
         // Delete Address
+        async function extendAddress(id) {
+            const hours = prompt('Extend this address by how many hours?', '24');
+            if (!hours) return;
+
+            try {
+                const res = await fetch(API_BASE + '/api/addresses/' + id + '/extend', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ hours: parseInt(hours, 10) })
+                });
+                if (!res.ok) {
+                    alert((await res.json()).error);
+                    return;
+                }
+
+                await loadAddresses();
+                await selectAddress(id);
+            } catch (error) {
+                console.error('Error extending address:', error);
+            }
+        }
+
         async function deleteAddress(id) {
             if (!confirm('Are you sure you want to delete this address? This cannot be undone.')) return;
 
@@ -1757,8 +3470,60 @@ func getDashboardHTML() string {
             renderAddressList();
         }
 
+        let searchTimer = null;
+
         function filterAddresses() {
             renderAddressList();
+
+            // Also search email contents once there's enough to go on
+            clearTimeout(searchTimer);
+            const term = document.getElementById('searchInput').value.trim();
+            if (term.length >= 3) {
+                searchTimer = setTimeout(() => searchEmails(term), 300);
+            }
+        }
+
+        // Full-text search across every address
+        async function searchEmails(term) {
+            const previewPane = document.getElementById('emailPreview');
+            try {
+                const res = await fetch(API_BASE + '/api/v1/search?q=' + encodeURIComponent(term));
+                const hits = await res.json() || [];
+                if (!res.ok) {
+                    throw new Error(hits.error);
+                }
+
+                let html = '<div class="preview-header"><h1 class="preview-title">Results for “' + escapeHTML(term) + '”</h1></div>' +
+                    '<div class="emails-container">';
+                if (hits.length === 0) {
+                    html += '<div class="empty-state"><div class="empty-icon">🔍</div><div class="empty-title">No matching emails</div></div>';
+                }
+                for (const hit of hits) {
+                    html += '<div class="received-email search-hit" onclick="openSearchHit(\'' + hit.addressId + '\', \'' + hit.id + '\')">' +
+                        '<div class="received-email-header">' +
+                            '<div class="received-email-info">' +
+                                '<div class="received-email-from">' + (hit.subjectHtml || '<em>no subject</em>') +
+                                    (hit.tag ? '<span class="tag-badge">+' + escapeHTML(hit.tag) + '</span>' : '') +
+                                '</div>' +
+                                '<div class="received-email-time">' + escapeHTML(hit.sender) + ' → ' + escapeHTML(hit.addressId) + ' &middot; ' + formatDateTime(hit.createdAt) + '</div>' +
+                                '<div class="search-snippet">' + hit.snippet + '</div>' +
+                            '</div>' +
+                        '</div>' +
+                    '</div>';
+                }
+                previewPane.innerHTML = html + '</div>';
+            } catch (error) {
+                console.error('Error searching emails:', error);
+            }
+        }
+
+        async function openSearchHit(addressId, emailId) {
+            await selectAddress(addressId);
+            const body = document.getElementById('email-body-' + emailId);
+            if (body) {
+                body.classList.add('expanded');
+                body.scrollIntoView({ behavior: 'smooth', block: 'start' });
+            }
         }
 
         // Utility Functions
@@ -1965,3 +3730,60 @@ func getLoginHTML() string {
 </body>
 </html>`
 }
+
+func getForwardConfirmHTML(forward db.ForwardRule) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Confirm forwarding - TempMail</title>
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', 'Roboto', 'Helvetica Neue', sans-serif;
+            background: #f8f9fa;
+            min-height: 100vh;
+            margin: 0;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+        }
+
+        .card {
+            background: white;
+            border-radius: 8px;
+            box-shadow: 0 1px 3px rgba(60, 64, 67, 0.3);
+            max-width: 420px;
+            padding: 2rem;
+        }
+
+        button {
+            background: #1a73e8;
+            color: white;
+            border: none;
+            border-radius: 4px;
+            padding: 10px 24px;
+            font-size: 14px;
+            cursor: pointer;
+        }
+    </style>
+</head>
+<body>
+    <div class="card">
+        <p>%s</p>
+        <form method="POST" action="/forward/confirm/%s">
+            <button type="submit">Confirm</button>
+        </form>
+    </div>
+</body>
+</html>`, confirmText(forward), html.EscapeString(forward.ConfirmToken))
+}
+
+// confirmText describes what confirming a forward rule will do
+func confirmText(forward db.ForwardRule) string {
+	if forward.ConfirmedAt != nil {
+		return fmt.Sprintf("Forwarding to %s is already confirmed.", html.EscapeString(forward.Destination))
+	}
+
+	return fmt.Sprintf("Forward mail sent to %s to %s?", html.EscapeString(forward.AddressID), html.EscapeString(forward.Destination))
+}
@@ -0,0 +1,61 @@
+package slackevents
+
+import (
+	"log"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// interactions receives interaction payloads from both Socket Mode and the
+// HTTP endpoint, after they've been acked; tests can swap in a recorder
+var interactions = handleInteraction
+
+// startSocketMode connects to Slack over a Socket Mode websocket and feeds
+// events and interactions into the same handlers as the HTTP endpoints. It
+// blocks until the connection is closed for good.
+func startSocketMode(client *socketmode.Client) {
+	go func() {
+		for evt := range client.Events {
+			switch evt.Type {
+			case socketmode.EventTypeConnecting:
+				log.Println("Connecting to Slack with Socket Mode...")
+			case socketmode.EventTypeConnectionError:
+				log.Println("Socket Mode connection failed, retrying...")
+			case socketmode.EventTypeConnected:
+				log.Println("Connected to Slack with Socket Mode")
+			case socketmode.EventTypeEventsAPI:
+				eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
+				if !ok {
+					log.Printf("Ignored unexpected Socket Mode event data: %+v", evt.Data)
+					continue
+				}
+
+				// An event the queue has no room for is left unacked, so
+				// Slack delivers it again
+				if eventsAPIEvent.Type == slackevents.CallbackEvent && !enqueueEvent(eventsAPIEvent, evt.Request.RetryAttempt) {
+					continue
+				}
+
+				client.Ack(*evt.Request)
+			case socketmode.EventTypeInteractive:
+				payload, ok := evt.Data.(slack.InteractionCallback)
+				if !ok {
+					log.Printf("Ignored unexpected Socket Mode interaction data: %+v", evt.Data)
+					continue
+				}
+
+				client.Ack(*evt.Request)
+
+				// Handlers may send mail, which mustn't hold up the next
+				// envelope
+				go interactions(payload)
+			}
+		}
+	}()
+
+	if err := client.Run(); err != nil {
+		log.Printf("ERROR: Socket Mode client stopped: %v", err)
+	}
+}
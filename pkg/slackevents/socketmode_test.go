@@ -0,0 +1,148 @@
+package slackevents
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// socketStub stands in for Slack: apps.connections.open hands out a
+// websocket URL, and the websocket sends whatever envelopes the test queues
+// and reports the acks it gets back
+type socketStub struct {
+	server    *httptest.Server
+	envelopes chan string
+	acks      chan string
+}
+
+func newSocketStub(t *testing.T) *socketStub {
+	stub := &socketStub{envelopes: make(chan string, 10), acks: make(chan string, 10)}
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		url := "ws" + strings.TrimPrefix(stub.server.URL, "http") + "/link"
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "url": url})
+	})
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","num_connections":1}`))
+
+		go func() {
+			for {
+				_, msg, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				var ack struct {
+					EnvelopeID string `json:"envelope_id"`
+				}
+				json.Unmarshal(msg, &ack)
+				stub.acks <- ack.EnvelopeID
+			}
+		}()
+
+		for envelope := range stub.envelopes {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(envelope)); err != nil {
+				return
+			}
+		}
+	})
+
+	stub.server = httptest.NewServer(mux)
+	t.Cleanup(stub.server.Close)
+
+	return stub
+}
+
+func (s *socketStub) ack(t *testing.T) string {
+	select {
+	case id := <-s.acks:
+		return id
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ack received")
+		return ""
+	}
+}
+
+func TestSocketModeDispatch(t *testing.T) {
+	stores = store.Memory()
+
+	var got []slack.InteractionCallback
+	done := make(chan bool, 1)
+	interactions = func(payload slack.InteractionCallback) {
+		got = append(got, payload)
+		done <- true
+	}
+	defer func() { interactions = handleInteraction }()
+
+	stub := newSocketStub(t)
+	api := slack.New("xoxb-test", slack.OptionAppLevelToken("xapp-test"), slack.OptionAPIURL(stub.server.URL+"/"))
+	go startSocketMode(socketmode.New(api))
+
+	// An events_api envelope is acked and queued for the workers
+	stub.envelopes <- `{"envelope_id":"env-1","type":"events_api","retry_attempt":0,"payload":{` +
+		`"type":"event_callback","event_id":"Ev1","team_id":"T1","api_app_id":"A1",` +
+		`"event":{"type":"message","channel":"C1","user":"U1","text":"gib email","ts":"1.000100"}}}`
+
+	if id := stub.ack(t); id != "env-1" {
+		t.Fatalf("acked %q, want env-1", id)
+	}
+	select {
+	case ev := <-eventQueue:
+		if ev.Type != slackevents.CallbackEvent {
+			t.Errorf("queued event type %q, want %q", ev.Type, slackevents.CallbackEvent)
+		}
+		if msg, ok := ev.InnerEvent.Data.(*slackevents.MessageEvent); !ok || msg.Text != "gib email" {
+			t.Errorf("queued inner event %+v, want the message", ev.InnerEvent.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not queued")
+	}
+
+	// An interactive envelope is acked and handed to the interaction handler
+	stub.envelopes <- `{"envelope_id":"env-2","type":"interactive","payload":{` +
+		`"type":"block_actions","user":{"id":"U1"},` +
+		`"actions":[{"action_id":"delete_email","block_id":"email_actions","value":"abc123","type":"button"}]}}`
+
+	if id := stub.ack(t); id != "env-2" {
+		t.Fatalf("acked %q, want env-2", id)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("interaction was not dispatched")
+	}
+	if len(got) != 1 || len(got[0].ActionCallback.BlockActions) != 1 || got[0].ActionCallback.BlockActions[0].Value != "abc123" {
+		t.Errorf("dispatched %+v, want the delete_email action", got)
+	}
+
+	// A retried delivery of the same event is acked but not queued again
+	stub.envelopes <- `{"envelope_id":"env-3","type":"events_api","retry_attempt":1,"payload":{` +
+		`"type":"event_callback","event_id":"Ev1","team_id":"T1","api_app_id":"A1",` +
+		`"event":{"type":"message","channel":"C1","user":"U1","text":"gib email","ts":"1.000100"}}}`
+
+	if id := stub.ack(t); id != "env-3" {
+		t.Fatalf("acked %q, want env-3", id)
+	}
+	select {
+	case ev := <-eventQueue:
+		t.Errorf("duplicate event was queued: %+v", ev)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,57 @@
+package spam
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rspamd checks mail with rspamd's normal worker over its HTTP protocol
+type Rspamd struct {
+	URL      string
+	Password string
+	Timeout  time.Duration
+}
+
+// Check posts the message to /checkv2
+func (s Rspamd) Check(raw []byte) (Result, error) {
+	req, err := http.NewRequest("POST", strings.TrimSuffix(s.URL, "/")+"/checkv2", bytes.NewReader(raw))
+	if err != nil {
+		return Result{}, err
+	}
+	if s.Password != "" {
+		req.Header.Set("Password", s.Password)
+	}
+
+	res, err := (&http.Client{Timeout: s.Timeout}).Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("rspamd returned %s", res.Status)
+	}
+
+	var body struct {
+		Score   *float64 `json:"score"`
+		Symbols map[string]struct {
+			Score float64 `json:"score"`
+		} `json:"symbols"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil || body.Score == nil {
+		return Result{}, ErrProtocol
+	}
+
+	result := Result{Score: *body.Score}
+	for name := range body.Symbols {
+		result.Symbols = append(result.Symbols, name)
+	}
+	sort.Strings(result.Symbols)
+
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package spam
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions taken on a scored message, from least to most severe
+const (
+	ActionNone       = ""
+	ActionTag        = "tag"
+	ActionQuarantine = "quarantine"
+	ActionReject     = "reject"
+)
+
+// ErrProtocol is returned when the checker's response can't be understood
+var ErrProtocol = errors.New("unexpected response from spam checker")
+
+// Result is a checker's verdict on a message
+type Result struct {
+	Score   float64
+	Symbols []string
+}
+
+// Checker scores a raw message. Spamd and Rspamd talk to real daemons; tests
+// and local setups can substitute their own.
+type Checker interface {
+	Check(raw []byte) (Result, error)
+}
+
+// timeout bounds each check, set with SPAM_TIMEOUT_SECONDS (default 10)
+func timeout() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("SPAM_TIMEOUT_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = 10
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// FromEnv returns the checker chosen by SPAM_CHECKER ("spamd" or "rspamd"),
+// or nil if spam checking is off
+func FromEnv() Checker {
+	switch strings.ToLower(os.Getenv("SPAM_CHECKER")) {
+	case "spamd", "spamassassin":
+		addr := os.Getenv("SPAMD_ADDR")
+		if addr == "" {
+			addr = "localhost:783"
+		}
+		return Spamd{Addr: addr, Timeout: timeout()}
+	case "rspamd":
+		url := os.Getenv("RSPAMD_URL")
+		if url == "" {
+			url = "http://localhost:11333"
+		}
+		return Rspamd{URL: url, Password: os.Getenv("RSPAMD_PASSWORD"), Timeout: timeout()}
+	}
+
+	return nil
+}
+
+// threshold reads a score threshold; unset means the action is never taken
+func threshold(key string) (float64, bool) {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return value, true
+}
+
+// Action picks what to do with a message with the given score, using
+// SPAM_REJECT_SCORE, SPAM_QUARANTINE_SCORE and SPAM_TAG_SCORE
+func Action(score float64) string {
+	if t, ok := threshold("SPAM_REJECT_SCORE"); ok && score >= t {
+		return ActionReject
+	}
+	if t, ok := threshold("SPAM_QUARANTINE_SCORE"); ok && score >= t {
+		return ActionQuarantine
+	}
+	if t, ok := threshold("SPAM_TAG_SCORE"); ok && score >= t {
+		return ActionTag
+	}
+
+	return ActionNone
+}
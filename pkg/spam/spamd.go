@@ -0,0 +1,93 @@
+package spam
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spamd checks mail with SpamAssassin's spamd using the SPAMC protocol
+type Spamd struct {
+	Addr    string
+	Timeout time.Duration
+}
+
+// Check sends a SYMBOLS request, which returns the score in a "Spam" header
+// and the matched rules as a comma-separated body
+func (s Spamd) Check(raw []byte) (Result, error) {
+	conn, err := net.DialTimeout("tcp", s.Addr, s.Timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.Timeout))
+
+	fmt.Fprintf(conn, "SYMBOLS SPAMC/1.5\r\nContent-length: %d\r\n\r\n", len(raw))
+	if _, err := conn.Write(raw); err != nil {
+		return Result{}, err
+	}
+	// spamd reads until the client half-closes the connection
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+
+	r := bufio.NewReader(conn)
+
+	status, err := r.ReadString('\n')
+	if err != nil {
+		return Result{}, err
+	}
+	// e.g. "SPAMD/1.1 0 EX_OK"
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "SPAMD/") {
+		return Result{}, ErrProtocol
+	}
+	if fields[1] != "0" {
+		return Result{}, fmt.Errorf("spamd error: %s", strings.TrimSpace(status))
+	}
+
+	var result Result
+	scored := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return Result{}, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		// e.g. "Spam: True ; 15.3 / 5.0"
+		if strings.HasPrefix(strings.ToLower(line), "spam:") {
+			parts := strings.Split(line, ";")
+			if len(parts) != 2 {
+				return Result{}, ErrProtocol
+			}
+			score := strings.TrimSpace(strings.Split(parts[1], "/")[0])
+			if result.Score, err = strconv.ParseFloat(score, 64); err != nil {
+				return Result{}, ErrProtocol
+			}
+			scored = true
+		}
+	}
+	if !scored {
+		return Result{}, ErrProtocol
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	for _, symbol := range strings.Split(strings.TrimSpace(string(body)), ",") {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			result.Symbols = append(result.Symbols, symbol)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,162 @@
+package srs
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// The Sender Rewriting Scheme lets forwarded mail pass SPF. The envelope
+// sender user@example.com becomes SRS0=HHHH=TT=example.com=user@ourdomain,
+// where TT is the day it was rewritten and HHHH a MAC over the rest, so
+// bounces can be routed back to the original sender without becoming an
+// open relay.
+//
+// Mail that was already forwarded arrives with an SRS0 sender. Wrapping that
+// again would grow the address with every hop, so it becomes
+// SRS1=HHHH=forwarder.com==HHHH=TT=example.com=user@ourdomain instead, which
+// bounces back to the SRS0 address at the first forwarder. A later forwarder
+// only swaps the hash and domain of an SRS1 address.
+
+const (
+	prefix  = "SRS0="
+	prefix1 = "SRS1="
+
+	// Timestamps count days and wrap around every 1024 of them
+	timestampAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	timestampPeriod   = 1024
+
+	// How many days a rewritten address is honoured for
+	maxAge = 21
+
+	hashLength = 4
+)
+
+// ErrInvalid is returned for an address that isn't a valid SRS address, or
+// whose hash doesn't match
+var ErrInvalid = errors.New("invalid SRS address")
+
+// ErrExpired is returned for an SRS address older than the maximum age
+var ErrExpired = errors.New("expired SRS address")
+
+func today() int {
+	return int(time.Now().Unix()/86400) % timestampPeriod
+}
+
+func encodeTimestamp(day int) string {
+	return string([]byte{timestampAlphabet[day>>5&31], timestampAlphabet[day&31]})
+}
+
+func decodeTimestamp(tt string) (int, bool) {
+	tt = strings.ToUpper(tt)
+	if len(tt) != 2 {
+		return 0, false
+	}
+
+	hi := strings.IndexByte(timestampAlphabet, tt[0])
+	lo := strings.IndexByte(timestampAlphabet, tt[1])
+	if hi < 0 || lo < 0 {
+		return 0, false
+	}
+
+	return hi<<5 | lo, true
+}
+
+func hash(secret string, parts ...string) string {
+	h := hmac.New(sha1.New, []byte(secret))
+	h.Write([]byte(strings.ToLower(strings.Join(parts, ""))))
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))[:hashLength]
+}
+
+// Forward rewrites sender to an SRS address at domain. The null sender used
+// by bounces is left alone, and SRS senders become SRS1 addresses.
+func Forward(secret, sender, domain string) string {
+	at := strings.LastIndex(sender, "@")
+	if sender == "" || at <= 0 {
+		return sender
+	}
+
+	local, origDomain := sender[:at], sender[at+1:]
+
+	// SRS0=rest@first becomes SRS1=HHHH=first==rest@domain
+	if hasPrefix(local, prefix) {
+		rest := local[len(prefix)-1:]
+		return prefix1 + hash(secret, origDomain, rest) + "=" + origDomain + "=" + rest + "@" + domain
+	}
+
+	// SRS1=HHHH=first==rest@previous keeps the first forwarder
+	if hasPrefix(local, prefix1) {
+		parts := strings.SplitN(local[len(prefix1):], "=", 3)
+		if len(parts) == 3 && parts[1] != "" {
+			first, rest := parts[1], parts[2]
+			return prefix1 + hash(secret, first, rest) + "=" + first + "=" + rest + "@" + domain
+		}
+	}
+
+	timestamp := encodeTimestamp(today())
+
+	return prefix + hash(secret, timestamp, origDomain, local) + "=" + timestamp + "=" + origDomain + "=" + local + "@" + domain
+}
+
+func hasPrefix(s, prefix string) bool {
+	return len(s) > len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// IsSRS reports whether address looks like one made by Forward
+func IsSRS(address string) bool {
+	return hasPrefix(address, prefix) || hasPrefix(address, prefix1)
+}
+
+// Reverse recovers the original sender from an SRS address, checking its
+// hash and age. An SRS1 address reverses to the SRS0 address at the first
+// forwarder, which checks the age itself.
+func Reverse(secret, address string) (string, error) {
+	if !IsSRS(address) {
+		return "", ErrInvalid
+	}
+
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return "", ErrInvalid
+	}
+
+	if hasPrefix(address, prefix1) {
+		// HHHH=first==rest
+		parts := strings.SplitN(address[len(prefix1):at], "=", 3)
+		if len(parts) != 3 || parts[1] == "" || len(parts[2]) < 2 || parts[2][0] != '=' {
+			return "", ErrInvalid
+		}
+		hh, first, rest := parts[0], parts[1], parts[2]
+
+		if !hmac.Equal([]byte(strings.ToLower(hh)), []byte(strings.ToLower(hash(secret, first, rest)))) {
+			return "", ErrInvalid
+		}
+
+		return prefix[:len(prefix)-1] + rest + "@" + first, nil
+	}
+
+	// HHHH=TT=domain=local, where local may itself contain "="
+	parts := strings.SplitN(address[len(prefix):at], "=", 4)
+	if len(parts) != 4 || parts[2] == "" || parts[3] == "" {
+		return "", ErrInvalid
+	}
+	hh, timestamp, domain, local := parts[0], parts[1], parts[2], parts[3]
+
+	if !hmac.Equal([]byte(strings.ToLower(hh)), []byte(strings.ToLower(hash(secret, timestamp, domain, local)))) {
+		return "", ErrInvalid
+	}
+
+	day, ok := decodeTimestamp(timestamp)
+	if !ok {
+		return "", ErrInvalid
+	}
+	if (today()-day+timestampPeriod)%timestampPeriod > maxAge {
+		return "", ErrExpired
+	}
+
+	return local + "@" + domain, nil
+}
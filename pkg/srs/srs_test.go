@@ -0,0 +1,54 @@
+package srs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestForwardAndReverse(t *testing.T) {
+	srs0 := Forward("secret", "user@example.com", "first.example")
+	if !strings.HasPrefix(srs0, "SRS0=") || !strings.HasSuffix(srs0, "=example.com=user@first.example") {
+		t.Fatalf("Forward = %q, want an SRS0 address at first.example", srs0)
+	}
+	if original, err := Reverse("secret", srs0); err != nil || original != "user@example.com" {
+		t.Errorf("Reverse(%q) = %q, %v", srs0, original, err)
+	}
+
+	// Forwarding again wraps it as SRS1, bouncing back to the first forwarder
+	srs1 := Forward("second-secret", srs0, "second.example")
+	if want := "=first.example=" + strings.TrimPrefix(srs0[:strings.LastIndex(srs0, "@")], "SRS0") + "@second.example"; !strings.HasPrefix(srs1, "SRS1=") || !strings.HasSuffix(srs1, want) {
+		t.Fatalf("Forward(%q) = %q, want an SRS1 address ending %q", srs0, srs1, want)
+	}
+	if original, err := Reverse("second-secret", srs1); err != nil || original != srs0 {
+		t.Errorf("Reverse(%q) = %q, %v; want %q", srs1, original, err, srs0)
+	}
+
+	// and a third forwarder only swaps the hash and domain
+	third := Forward("third-secret", srs1, "third.example")
+	if strings.Count(third, "SRS") != 1 || !strings.Contains(third, "=first.example==") || !strings.HasSuffix(third, "@third.example") {
+		t.Errorf("Forward(%q) = %q, want it still pointing at first.example", srs1, third)
+	}
+	if original, err := Reverse("third-secret", third); err != nil || original != srs0 {
+		t.Errorf("Reverse(%q) = %q, %v; want %q", third, original, err, srs0)
+	}
+
+	if Forward("secret", "", "first.example") != "" {
+		t.Error("null sender was rewritten")
+	}
+}
+
+func TestReverseRejectsForgeries(t *testing.T) {
+	srs1 := Forward("secret", Forward("other", "user@example.com", "first.example"), "second.example")
+
+	for _, address := range []string{
+		"user@example.com",
+		strings.Replace(srs1, "first.example", "evil.example", 1),
+		"SRS1=AAAA=first.example==x@second.example",
+		"SRS1=garbage@second.example",
+		"SRS0=AAAA=AA=example.com=user@first.example",
+	} {
+		if _, err := Reverse("secret", address); err == nil {
+			t.Errorf("Reverse(%q) succeeded", address)
+		}
+	}
+}
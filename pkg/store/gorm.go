@@ -0,0 +1,519 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// createWithID inserts value, assigning a fresh ID with setID until the
+// insert doesn't collide with an existing primary key
+func createWithID(conn *gorm.DB, value interface{}, setID func()) error {
+	for i := 0; i < maxIDAttempts; i++ {
+		setID()
+
+		tx := conn.Clauses(clause.OnConflict{DoNothing: true}).Create(value)
+		if tx.Error != nil {
+			return tx.Error
+		}
+		if tx.RowsAffected > 0 {
+			return nil
+		}
+	}
+
+	return ErrIDExhausted
+}
+
+// affected turns a delete that matched nothing into ErrNotFound
+func affected(tx *gorm.DB) error {
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GormAddresses is an AddressStore backed by the addresses table
+type GormAddresses struct {
+	DB *gorm.DB
+}
+
+func (s *GormAddresses) Create(address *db.Address, newID func() string) error {
+	return createWithID(s.DB, address, func() {
+		address.ID = newID()
+	})
+}
+
+func (s *GormAddresses) Get(id string) (db.Address, error) {
+	var address db.Address
+	err := s.DB.Where("id = ?", id).First(&address).Error
+	return address, err
+}
+
+func (s *GormAddresses) FindActive(id, domain string, now time.Time) (db.Address, error) {
+	var address db.Address
+	err := s.DB.Where("id = ? AND domain = ? AND expires_at > ?", id, domain, now).First(&address).Error
+	return address, err
+}
+
+func (s *GormAddresses) FindActiveByTimestamp(timestamp string, now time.Time) (db.Address, error) {
+	var address db.Address
+	err := s.DB.Where("timestamp = ? AND expires_at > ?", timestamp, now).First(&address).Error
+	return address, err
+}
+
+func (s *GormAddresses) Save(address *db.Address) error {
+	return s.DB.Save(address).Error
+}
+
+func (s *GormAddresses) List() ([]db.Address, error) {
+	var addresses []db.Address
+	err := s.DB.Order("created_at DESC").Find(&addresses).Error
+	return addresses, err
+}
+
+func (s *GormAddresses) ExpiringBetween(from, to time.Time) ([]db.Address, error) {
+	var addresses []db.Address
+	err := s.DB.Where("expires_at > ? AND expires_at <= ? AND NOT warning_sent", from, to).Find(&addresses).Error
+	return addresses, err
+}
+
+func (s *GormAddresses) ExpiredUnnotified(now time.Time) ([]db.Address, error) {
+	var addresses []db.Address
+	err := s.DB.Where("expires_at < ? AND NOT expired_message_sent", now).Find(&addresses).Error
+	return addresses, err
+}
+
+func (s *GormAddresses) Count(now time.Time) (total, active int64, err error) {
+	if err = s.DB.Model(&db.Address{}).Count(&total).Error; err != nil {
+		return
+	}
+	err = s.DB.Model(&db.Address{}).Where("expires_at > ?", now).Count(&active).Error
+	return
+}
+
+func (s *GormAddresses) CountActiveByUser(user string, now time.Time) (int64, error) {
+	var count int64
+	err := s.DB.Model(&db.Address{}).Where("\"user\" = ? AND expires_at > ?", user, now).Count(&count).Error
+	return count, err
+}
+
+func (s *GormAddresses) CountCreatedByUser(user string, since time.Time) (int64, error) {
+	var count int64
+	err := s.DB.Model(&db.Address{}).Where("\"user\" = ? AND created_at > ?", user, since).Count(&count).Error
+	return count, err
+}
+
+func (s *GormAddresses) CountCreatedInChannel(channel string, since time.Time) (int64, error) {
+	var count int64
+	err := s.DB.Model(&db.Address{}).Where("channel = ? AND created_at > ?", channel, since).Count(&count).Error
+	return count, err
+}
+
+func (s *GormAddresses) ExpiredBefore(now time.Time) ([]db.Address, error) {
+	var addresses []db.Address
+	err := s.DB.Where("expires_at < ?", now).Order("expires_at").Find(&addresses).Error
+	return addresses, err
+}
+
+func (s *GormAddresses) AssignDomain(domain string) error {
+	return s.DB.Model(&db.Address{}).Where("domain = '' OR domain IS NULL").Update("domain", domain).Error
+}
+
+func (s *GormAddresses) Delete(id string) error {
+	return s.DB.Where("id = ?", id).Delete(&db.Address{}).Error
+}
+
+// GormEmails is an EmailStore backed by the emails table
+type GormEmails struct {
+	DB *gorm.DB
+}
+
+func (s *GormEmails) Create(email *db.Email, newID func() string) error {
+	return createWithID(s.DB, email, func() {
+		email.ID = newID()
+	})
+}
+
+func (s *GormEmails) Get(id string) (db.Email, error) {
+	var email db.Email
+	err := s.DB.Preload("Address").Where("id = ?", id).First(&email).Error
+	return email, err
+}
+
+func (s *GormEmails) List(addressID string, tag *string) ([]db.Email, error) {
+	query := s.DB.Where("address_id = ?", addressID)
+	if tag != nil {
+		query = query.Where("tag = ?", *tag)
+	}
+
+	var emails []db.Email
+	err := query.Order("created_at DESC").Find(&emails).Error
+	return emails, err
+}
+
+func (s *GormEmails) Tags(addressID string) ([]TagCount, error) {
+	var tags []TagCount
+	err := s.DB.Model(&db.Email{}).Select("tag, COUNT(*) AS count").Where("address_id = ?", addressID).Group("tag").Order("tag").Scan(&tags).Error
+	return tags, err
+}
+
+func (s *GormEmails) Delete(id string) error {
+	return s.DB.Where("id = ?", id).Delete(&db.Email{}).Error
+}
+
+func (s *GormEmails) Count() (int64, error) {
+	var count int64
+	err := s.DB.Model(&db.Email{}).Count(&count).Error
+	return count, err
+}
+
+func (s *GormEmails) Related(addressID, messageID string, parents []string) ([]db.Email, error) {
+	var emails []db.Email
+	if len(parents) > 0 {
+		if err := s.DB.Where("address_id = ? AND message_id IN ?", addressID, parents).Find(&emails).Error; err != nil {
+			return nil, err
+		}
+	}
+	if messageID == "" {
+		return emails, nil
+	}
+
+	// LIKE can match more than the one ID, so children are checked again below
+	var children []db.Email
+	err := s.DB.Where("address_id = ? AND (in_reply_to = ? OR reference_ids LIKE ?)", addressID, messageID, "%"+messageID+"%").Find(&children).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if refersTo(child, messageID) {
+			emails = append(emails, child)
+		}
+	}
+
+	return emails, nil
+}
+
+func (s *GormEmails) LatestWithSubject(addressID, threadSubject, senderDomain string, since time.Time) (db.Email, error) {
+	domain := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(senderDomain))
+
+	// Find rather than First, since no match is the usual case and First
+	// logs it as an error
+	var emails []db.Email
+	err := s.DB.Where("address_id = ? AND thread_subject = ? AND created_at > ?", addressID, threadSubject, since).
+		Where(`LOWER(sender) LIKE ? ESCAPE '\'`, "%@"+domain).
+		Order("created_at DESC").Limit(1).Find(&emails).Error
+	if err != nil {
+		return db.Email{}, err
+	}
+	if len(emails) == 0 {
+		return db.Email{}, ErrNotFound
+	}
+
+	return emails[0], nil
+}
+
+func (s *GormEmails) MergeThreads(addressID string, from []string, to string) error {
+	return s.DB.Model(&db.Email{}).Where("address_id = ? AND thread_id IN ?", addressID, from).Update("thread_id", to).Error
+}
+
+func (s *GormEmails) Thread(addressID, threadID string) ([]db.Email, error) {
+	var emails []db.Email
+	err := s.DB.Where("address_id = ? AND thread_id = ?", addressID, threadID).Order("created_at").Find(&emails).Error
+	return emails, err
+}
+
+func (s *GormEmails) CountFor(addressID string) (int64, error) {
+	var count int64
+	err := s.DB.Model(&db.Email{}).Where("address_id = ?", addressID).Count(&count).Error
+	return count, err
+}
+
+func (s *GormEmails) DeleteFor(addressID string, limit int) (int64, error) {
+	// Emails hold the raw message, so they're picked out first to keep the
+	// delete itself small
+	var ids []string
+	if err := s.DB.Model(&db.Email{}).Where("address_id = ?", addressID).Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx := s.DB.Where("id IN ?", ids).Delete(&db.Email{})
+	return tx.RowsAffected, tx.Error
+}
+
+// GormDomains is a DomainStore backed by the domains table
+type GormDomains struct {
+	DB *gorm.DB
+}
+
+func (s *GormDomains) Create(domain *db.Domain) error {
+	return s.DB.Create(domain).Error
+}
+
+func (s *GormDomains) Get(name string) (db.Domain, error) {
+	// Find rather than First, since mail for unknown domains is routine and
+	// First logs every miss as an error
+	var domains []db.Domain
+	if err := s.DB.Where("name = ?", name).Limit(1).Find(&domains).Error; err != nil {
+		return db.Domain{}, err
+	}
+	if len(domains) == 0 {
+		return db.Domain{}, ErrNotFound
+	}
+
+	return domains[0], nil
+}
+
+func (s *GormDomains) Save(domain *db.Domain) error {
+	return s.DB.Save(domain).Error
+}
+
+func (s *GormDomains) List() ([]db.Domain, error) {
+	var domains []db.Domain
+	err := s.DB.Order("pool, name").Find(&domains).Error
+	return domains, err
+}
+
+func (s *GormDomains) InPool(pool string) ([]db.Domain, error) {
+	var domains []db.Domain
+	err := s.DB.Where("pool = ? AND enabled AND verified", pool).Find(&domains).Error
+	return domains, err
+}
+
+func (s *GormDomains) Unverified() ([]db.Domain, error) {
+	var domains []db.Domain
+	err := s.DB.Where("NOT verified").Find(&domains).Error
+	return domains, err
+}
+
+// GormSenders is a SenderStore backed by the sender_rules and
+// blocked_emails tables
+type GormSenders struct {
+	DB *gorm.DB
+}
+
+func (s *GormSenders) Rules(addressID string) ([]db.SenderRule, error) {
+	var rules []db.SenderRule
+	err := s.DB.Where("address_id = ?", addressID).Order("created_at").Find(&rules).Error
+	return rules, err
+}
+
+func (s *GormSenders) AddRule(rule *db.SenderRule) error {
+	return s.DB.Create(rule).Error
+}
+
+func (s *GormSenders) DeleteRule(addressID string, id uint) error {
+	return affected(s.DB.Where("id = ? AND address_id = ?", id, addressID).Delete(&db.SenderRule{}))
+}
+
+func (s *GormSenders) LogBlocked(blocked *db.BlockedEmail) error {
+	return s.DB.Create(blocked).Error
+}
+
+func (s *GormSenders) Blocked(addressID string, limit int) ([]db.BlockedEmail, error) {
+	var blocked []db.BlockedEmail
+	err := s.DB.Where("address_id = ?", addressID).Order("created_at DESC").Limit(limit).Find(&blocked).Error
+	return blocked, err
+}
+
+func (s *GormSenders) CountBlocked(addressID string) (int64, error) {
+	var count int64
+	err := s.DB.Model(&db.BlockedEmail{}).Where("address_id = ?", addressID).Count(&count).Error
+	return count, err
+}
+
+func (s *GormSenders) DeleteFor(addressID string) (int64, error) {
+	tx := s.DB.Where("address_id = ?", addressID).Delete(&db.BlockedEmail{})
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+
+	return tx.RowsAffected, s.DB.Where("address_id = ?", addressID).Delete(&db.SenderRule{}).Error
+}
+
+// GormForwards is a ForwardStore backed by the forward_rules table
+type GormForwards struct {
+	DB *gorm.DB
+}
+
+func (s *GormForwards) List(addressID string) ([]db.ForwardRule, error) {
+	var rules []db.ForwardRule
+	err := s.DB.Where("address_id = ?", addressID).Order("created_at").Find(&rules).Error
+	return rules, err
+}
+
+func (s *GormForwards) Confirmed(addressID string) ([]db.ForwardRule, error) {
+	var rules []db.ForwardRule
+	err := s.DB.Where("address_id = ? AND confirmed_at IS NOT NULL", addressID).Find(&rules).Error
+	return rules, err
+}
+
+func (s *GormForwards) FindByToken(token string) (db.ForwardRule, error) {
+	var rule db.ForwardRule
+	err := s.DB.Where("confirm_token = ?", token).First(&rule).Error
+	return rule, err
+}
+
+func (s *GormForwards) Create(rule *db.ForwardRule) error {
+	return s.DB.Create(rule).Error
+}
+
+func (s *GormForwards) Save(rule *db.ForwardRule) error {
+	return s.DB.Save(rule).Error
+}
+
+func (s *GormForwards) Delete(addressID string, id uint) error {
+	return affected(s.DB.Where("id = ? AND address_id = ?", id, addressID).Delete(&db.ForwardRule{}))
+}
+
+func (s *GormForwards) DeleteFor(addressID string) error {
+	return s.DB.Where("address_id = ?", addressID).Delete(&db.ForwardRule{}).Error
+}
+
+// GormWebhooks is a WebhookStore backed by the webhooks and
+// webhook_deliveries tables
+type GormWebhooks struct {
+	DB *gorm.DB
+}
+
+func (s *GormWebhooks) List() ([]db.Webhook, error) {
+	var hooks []db.Webhook
+	err := s.DB.Order("address_id, created_at").Find(&hooks).Error
+	return hooks, err
+}
+
+func (s *GormWebhooks) For(addressID string) ([]db.Webhook, error) {
+	var hooks []db.Webhook
+	err := s.DB.Where("address_id = ? OR address_id = ''", addressID).Find(&hooks).Error
+	return hooks, err
+}
+
+func (s *GormWebhooks) Get(id uint) (db.Webhook, error) {
+	var hook db.Webhook
+	err := s.DB.Where("id = ?", id).First(&hook).Error
+	return hook, err
+}
+
+func (s *GormWebhooks) Create(hook *db.Webhook) error {
+	return s.DB.Create(hook).Error
+}
+
+func (s *GormWebhooks) Delete(id uint) error {
+	return affected(s.DB.Where("id = ?", id).Delete(&db.Webhook{}))
+}
+
+func (s *GormWebhooks) Deliveries(webhookID uint, limit int) ([]db.WebhookDelivery, error) {
+	var deliveries []db.WebhookDelivery
+	err := s.DB.Where("webhook_id = ?", webhookID).Order("created_at DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (s *GormWebhooks) GetDelivery(id uint) (db.WebhookDelivery, error) {
+	var delivery db.WebhookDelivery
+	err := s.DB.Where("id = ?", id).First(&delivery).Error
+	return delivery, err
+}
+
+func (s *GormWebhooks) CreateDelivery(delivery *db.WebhookDelivery) error {
+	return s.DB.Create(delivery).Error
+}
+
+func (s *GormWebhooks) SaveDelivery(delivery *db.WebhookDelivery) error {
+	return s.DB.Save(delivery).Error
+}
+
+func (s *GormWebhooks) Due(status string, now time.Time, limit int) ([]db.WebhookDelivery, error) {
+	var deliveries []db.WebhookDelivery
+	err := s.DB.Where("status = ? AND next_attempt_at <= ?", status, now).Order("next_attempt_at").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (s *GormWebhooks) Claim(id uint, status string, now, until time.Time) (bool, error) {
+	tx := s.DB.Model(&db.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, status, now).
+		Update("next_attempt_at", until)
+	return tx.RowsAffected > 0, tx.Error
+}
+
+func (s *GormWebhooks) DeleteFor(addressID string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		hooks := s.DB.Model(&db.Webhook{}).Select("id").Where("address_id = ?", addressID)
+		emails := s.DB.Model(&db.Email{}).Select("id").Where("address_id = ?", addressID)
+		if err := tx.Where("webhook_id IN (?) OR email_id IN (?)", hooks, emails).Delete(&db.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("address_id = ?", addressID).Delete(&db.Webhook{}).Error
+	})
+}
+
+// GormGlobalRules is a GlobalRuleStore backed by the global_rules table
+type GormGlobalRules struct {
+	DB *gorm.DB
+}
+
+func (s *GormGlobalRules) List() ([]db.GlobalRule, error) {
+	var rules []db.GlobalRule
+	err := s.DB.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (s *GormGlobalRules) Create(rule *db.GlobalRule) error {
+	return s.DB.Create(rule).Error
+}
+
+func (s *GormGlobalRules) Delete(id uint) error {
+	return affected(s.DB.Where("id = ?", id).Delete(&db.GlobalRule{}))
+}
+
+func (s *GormGlobalRules) RecordHit(id uint, at time.Time) error {
+	return s.DB.Model(&db.GlobalRule{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"hits":        gorm.Expr("hits + 1"),
+		"last_hit_at": at,
+	}).Error
+}
+
+// GormEvents is an EventStore backed by the seen_events table
+type GormEvents struct {
+	DB *gorm.DB
+}
+
+func (s *GormEvents) MarkSeen(eventID string, at time.Time) (bool, error) {
+	tx := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&db.SeenEvent{
+		EventID:   eventID,
+		CreatedAt: at,
+	})
+	return tx.RowsAffected > 0, tx.Error
+}
+
+func (s *GormEvents) Forget(eventID string) error {
+	return s.DB.Delete(&db.SeenEvent{EventID: eventID}).Error
+}
+
+func (s *GormEvents) Prune(before time.Time) error {
+	return s.DB.Where("created_at < ?", before).Delete(&db.SeenEvent{}).Error
+}
+
+// GormSearch is a SearchStore backed by the emails table, using full-text
+// search on Postgres
+type GormSearch struct {
+	DB *gorm.DB
+}
+
+func (s *GormSearch) Index(emailID string) error {
+	return search.Index(s.DB, emailID)
+}
+
+func (s *GormSearch) Search(q search.Query) ([]search.Hit, error) {
+	return search.Search(s.DB, q)
+}
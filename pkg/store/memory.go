@@ -0,0 +1,993 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/search"
+)
+
+// MemoryAddresses is an AddressStore kept in a map, for tests
+type MemoryAddresses struct {
+	mu        sync.RWMutex
+	addresses map[string]db.Address
+}
+
+// NewMemoryAddresses returns an empty MemoryAddresses
+func NewMemoryAddresses() *MemoryAddresses {
+	return &MemoryAddresses{addresses: map[string]db.Address{}}
+}
+
+// filter returns the addresses matching keep
+func (s *MemoryAddresses) filter(keep func(db.Address) bool) []db.Address {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []db.Address
+	for _, address := range s.addresses {
+		if keep(address) {
+			matched = append(matched, address)
+		}
+	}
+
+	return matched
+}
+
+func (s *MemoryAddresses) Create(address *db.Address, newID func() string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < maxIDAttempts; i++ {
+		address.ID = newID()
+		if _, taken := s.addresses[address.ID]; !taken {
+			s.addresses[address.ID] = *address
+			return nil
+		}
+	}
+
+	return ErrIDExhausted
+}
+
+func (s *MemoryAddresses) Get(id string) (db.Address, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	address, ok := s.addresses[id]
+	if !ok {
+		return db.Address{}, ErrNotFound
+	}
+
+	return address, nil
+}
+
+func (s *MemoryAddresses) FindActive(id, domain string, now time.Time) (db.Address, error) {
+	address, err := s.Get(id)
+	if err != nil || address.Domain != domain || !address.ExpiresAt.After(now) {
+		return db.Address{}, ErrNotFound
+	}
+
+	return address, nil
+}
+
+func (s *MemoryAddresses) FindActiveByTimestamp(timestamp string, now time.Time) (db.Address, error) {
+	matched := s.filter(func(a db.Address) bool {
+		return a.Timestamp == timestamp && a.ExpiresAt.After(now)
+	})
+	if len(matched) == 0 {
+		return db.Address{}, ErrNotFound
+	}
+
+	return matched[0], nil
+}
+
+func (s *MemoryAddresses) Save(address *db.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addresses[address.ID] = *address
+	return nil
+}
+
+func (s *MemoryAddresses) List() ([]db.Address, error) {
+	addresses := s.filter(func(db.Address) bool { return true })
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].CreatedAt.After(addresses[j].CreatedAt)
+	})
+
+	return addresses, nil
+}
+
+func (s *MemoryAddresses) ExpiringBetween(from, to time.Time) ([]db.Address, error) {
+	return s.filter(func(a db.Address) bool {
+		return a.ExpiresAt.After(from) && !a.ExpiresAt.After(to) && !a.WarningSent
+	}), nil
+}
+
+func (s *MemoryAddresses) ExpiredUnnotified(now time.Time) ([]db.Address, error) {
+	return s.filter(func(a db.Address) bool {
+		return a.ExpiresAt.Before(now) && !a.ExpiredMessageSent
+	}), nil
+}
+
+func (s *MemoryAddresses) Count(now time.Time) (total, active int64, err error) {
+	for _, address := range s.filter(func(db.Address) bool { return true }) {
+		total++
+		if address.ExpiresAt.After(now) {
+			active++
+		}
+	}
+
+	return total, active, nil
+}
+
+func (s *MemoryAddresses) CountActiveByUser(user string, now time.Time) (int64, error) {
+	return int64(len(s.filter(func(a db.Address) bool {
+		return a.User == user && a.ExpiresAt.After(now)
+	}))), nil
+}
+
+func (s *MemoryAddresses) CountCreatedByUser(user string, since time.Time) (int64, error) {
+	return int64(len(s.filter(func(a db.Address) bool {
+		return a.User == user && a.CreatedAt.After(since)
+	}))), nil
+}
+
+func (s *MemoryAddresses) CountCreatedInChannel(channel string, since time.Time) (int64, error) {
+	return int64(len(s.filter(func(a db.Address) bool {
+		return a.Channel == channel && a.CreatedAt.After(since)
+	}))), nil
+}
+
+func (s *MemoryAddresses) ExpiredBefore(now time.Time) ([]db.Address, error) {
+	addresses := s.filter(func(a db.Address) bool {
+		return a.ExpiresAt.Before(now)
+	})
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].ExpiresAt.Before(addresses[j].ExpiresAt)
+	})
+
+	return addresses, nil
+}
+
+func (s *MemoryAddresses) AssignDomain(domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, address := range s.addresses {
+		if address.Domain == "" {
+			address.Domain = domain
+			s.addresses[id] = address
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryAddresses) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.addresses, id)
+	return nil
+}
+
+// MemoryEmails is an EmailStore kept in a map, for tests. Addresses are
+// looked up in the given address store to fill in Email.Address.
+type MemoryEmails struct {
+	mu        sync.RWMutex
+	emails    map[string]db.Email
+	addresses *MemoryAddresses
+}
+
+// NewMemoryEmails returns an empty MemoryEmails
+func NewMemoryEmails(addresses *MemoryAddresses) *MemoryEmails {
+	return &MemoryEmails{emails: map[string]db.Email{}, addresses: addresses}
+}
+
+func (s *MemoryEmails) Create(email *db.Email, newID func() string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if email.CreatedAt.IsZero() {
+		email.CreatedAt = time.Now()
+	}
+
+	for i := 0; i < maxIDAttempts; i++ {
+		email.ID = newID()
+		if _, taken := s.emails[email.ID]; !taken {
+			s.emails[email.ID] = *email
+			return nil
+		}
+	}
+
+	return ErrIDExhausted
+}
+
+func (s *MemoryEmails) Get(id string) (db.Email, error) {
+	s.mu.RLock()
+	email, ok := s.emails[id]
+	s.mu.RUnlock()
+	if !ok {
+		return db.Email{}, ErrNotFound
+	}
+
+	if address, err := s.addresses.Get(email.AddressID); err == nil {
+		email.Address = address
+	}
+
+	return email, nil
+}
+
+func (s *MemoryEmails) List(addressID string, tag *string) ([]db.Email, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var emails []db.Email
+	for _, email := range s.emails {
+		if email.AddressID == addressID && (tag == nil || email.Tag == *tag) {
+			emails = append(emails, email)
+		}
+	}
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i].CreatedAt.After(emails[j].CreatedAt)
+	})
+
+	return emails, nil
+}
+
+func (s *MemoryEmails) Tags(addressID string) ([]TagCount, error) {
+	emails, _ := s.List(addressID, nil)
+
+	counts := map[string]int64{}
+	for _, email := range emails {
+		counts[email.Tag]++
+	}
+
+	var tags []TagCount
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Tag < tags[j].Tag
+	})
+
+	return tags, nil
+}
+
+func (s *MemoryEmails) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.emails, id)
+	return nil
+}
+
+func (s *MemoryEmails) Count() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.emails)), nil
+}
+
+func (s *MemoryEmails) Related(addressID, messageID string, parents []string) ([]db.Email, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var emails []db.Email
+	for _, email := range s.emails {
+		if email.AddressID != addressID {
+			continue
+		}
+		if (messageID != "" && refersTo(email, messageID)) || (email.MessageID != "" && contains(parents, email.MessageID)) {
+			emails = append(emails, email)
+		}
+	}
+
+	return emails, nil
+}
+
+func (s *MemoryEmails) LatestWithSubject(addressID, threadSubject, senderDomain string, since time.Time) (db.Email, error) {
+	emails, _ := s.List(addressID, nil)
+	for _, email := range emails {
+		if email.ThreadSubject == threadSubject && email.CreatedAt.After(since) &&
+			strings.HasSuffix(strings.ToLower(email.Sender), "@"+strings.ToLower(senderDomain)) {
+			return email, nil
+		}
+	}
+
+	return db.Email{}, ErrNotFound
+}
+
+func (s *MemoryEmails) MergeThreads(addressID string, from []string, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, email := range s.emails {
+		if email.AddressID == addressID && contains(from, email.ThreadID) {
+			email.ThreadID = to
+			s.emails[id] = email
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryEmails) Thread(addressID, threadID string) ([]db.Email, error) {
+	emails, _ := s.List(addressID, nil)
+
+	var thread []db.Email
+	for i := len(emails) - 1; i >= 0; i-- {
+		if emails[i].ThreadID == threadID {
+			thread = append(thread, emails[i])
+		}
+	}
+
+	return thread, nil
+}
+
+func (s *MemoryEmails) CountFor(addressID string) (int64, error) {
+	emails, _ := s.List(addressID, nil)
+	return int64(len(emails)), nil
+}
+
+func (s *MemoryEmails) DeleteFor(addressID string, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, email := range s.emails {
+		if deleted == int64(limit) {
+			break
+		}
+		if email.AddressID == addressID {
+			delete(s.emails, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// MemoryDomains is a DomainStore kept in a map, for tests
+type MemoryDomains struct {
+	mu      sync.RWMutex
+	domains map[string]db.Domain
+}
+
+// NewMemoryDomains returns an empty MemoryDomains
+func NewMemoryDomains() *MemoryDomains {
+	return &MemoryDomains{domains: map[string]db.Domain{}}
+}
+
+// filter returns the domains matching keep, by pool and then name
+func (s *MemoryDomains) filter(keep func(db.Domain) bool) []db.Domain {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []db.Domain
+	for _, domain := range s.domains {
+		if keep(domain) {
+			matched = append(matched, domain)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Pool != matched[j].Pool {
+			return matched[i].Pool < matched[j].Pool
+		}
+		return matched[i].Name < matched[j].Name
+	})
+
+	return matched
+}
+
+func (s *MemoryDomains) Create(domain *db.Domain) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, taken := s.domains[domain.Name]; taken {
+		return errors.New("domain already exists")
+	}
+	s.domains[domain.Name] = *domain
+
+	return nil
+}
+
+func (s *MemoryDomains) Get(name string) (db.Domain, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domain, ok := s.domains[name]
+	if !ok {
+		return db.Domain{}, ErrNotFound
+	}
+
+	return domain, nil
+}
+
+func (s *MemoryDomains) Save(domain *db.Domain) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.domains[domain.Name] = *domain
+	return nil
+}
+
+func (s *MemoryDomains) List() ([]db.Domain, error) {
+	return s.filter(func(db.Domain) bool { return true }), nil
+}
+
+func (s *MemoryDomains) InPool(pool string) ([]db.Domain, error) {
+	return s.filter(func(d db.Domain) bool {
+		return d.Pool == pool && d.Enabled && d.Verified
+	}), nil
+}
+
+func (s *MemoryDomains) Unverified() ([]db.Domain, error) {
+	return s.filter(func(d db.Domain) bool { return !d.Verified }), nil
+}
+
+// MemorySenders is a SenderStore kept in slices, for tests
+type MemorySenders struct {
+	mu      sync.RWMutex
+	nextID  uint
+	rules   []db.SenderRule
+	blocked []db.BlockedEmail
+}
+
+// NewMemorySenders returns an empty MemorySenders
+func NewMemorySenders() *MemorySenders {
+	return &MemorySenders{}
+}
+
+func (s *MemorySenders) Rules(addressID string) ([]db.SenderRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rules []db.SenderRule
+	for _, rule := range s.rules {
+		if rule.AddressID == addressID {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+func (s *MemorySenders) AddRule(rule *db.SenderRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	rule.ID = s.nextID
+	s.rules = append(s.rules, *rule)
+
+	return nil
+}
+
+func (s *MemorySenders) DeleteRule(addressID string, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, rule := range s.rules {
+		if rule.ID == id && rule.AddressID == addressID {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *MemorySenders) LogBlocked(blocked *db.BlockedEmail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	blocked.ID = s.nextID
+	s.blocked = append(s.blocked, *blocked)
+
+	return nil
+}
+
+func (s *MemorySenders) Blocked(addressID string, limit int) ([]db.BlockedEmail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var blocked []db.BlockedEmail
+	for i := len(s.blocked) - 1; i >= 0 && len(blocked) < limit; i-- {
+		if s.blocked[i].AddressID == addressID {
+			blocked = append(blocked, s.blocked[i])
+		}
+	}
+
+	return blocked, nil
+}
+
+func (s *MemorySenders) CountBlocked(addressID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, blocked := range s.blocked {
+		if blocked.AddressID == addressID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *MemorySenders) DeleteFor(addressID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rules []db.SenderRule
+	for _, rule := range s.rules {
+		if rule.AddressID != addressID {
+			rules = append(rules, rule)
+		}
+	}
+	s.rules = rules
+
+	var kept []db.BlockedEmail
+	for _, blocked := range s.blocked {
+		if blocked.AddressID != addressID {
+			kept = append(kept, blocked)
+		}
+	}
+	deleted := int64(len(s.blocked) - len(kept))
+	s.blocked = kept
+
+	return deleted, nil
+}
+
+// MemoryForwards is a ForwardStore kept in a slice, for tests
+type MemoryForwards struct {
+	mu     sync.RWMutex
+	nextID uint
+	rules  []db.ForwardRule
+}
+
+// NewMemoryForwards returns an empty MemoryForwards
+func NewMemoryForwards() *MemoryForwards {
+	return &MemoryForwards{}
+}
+
+// filter returns the rules matching keep, oldest first
+func (s *MemoryForwards) filter(keep func(db.ForwardRule) bool) []db.ForwardRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []db.ForwardRule
+	for _, rule := range s.rules {
+		if keep(rule) {
+			matched = append(matched, rule)
+		}
+	}
+
+	return matched
+}
+
+func (s *MemoryForwards) List(addressID string) ([]db.ForwardRule, error) {
+	return s.filter(func(r db.ForwardRule) bool { return r.AddressID == addressID }), nil
+}
+
+func (s *MemoryForwards) Confirmed(addressID string) ([]db.ForwardRule, error) {
+	return s.filter(func(r db.ForwardRule) bool {
+		return r.AddressID == addressID && r.ConfirmedAt != nil
+	}), nil
+}
+
+func (s *MemoryForwards) FindByToken(token string) (db.ForwardRule, error) {
+	matched := s.filter(func(r db.ForwardRule) bool { return r.ConfirmToken == token })
+	if len(matched) == 0 {
+		return db.ForwardRule{}, ErrNotFound
+	}
+
+	return matched[0], nil
+}
+
+func (s *MemoryForwards) Create(rule *db.ForwardRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	rule.ID = s.nextID
+	s.rules = append(s.rules, *rule)
+
+	return nil
+}
+
+func (s *MemoryForwards) Save(rule *db.ForwardRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.rules {
+		if s.rules[i].ID == rule.ID {
+			s.rules[i] = *rule
+			return nil
+		}
+	}
+	s.rules = append(s.rules, *rule)
+
+	return nil
+}
+
+func (s *MemoryForwards) Delete(addressID string, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, rule := range s.rules {
+		if rule.ID == id && rule.AddressID == addressID {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *MemoryForwards) DeleteFor(addressID string) error {
+	kept := s.filter(func(r db.ForwardRule) bool { return r.AddressID != addressID })
+
+	s.mu.Lock()
+	s.rules = kept
+	s.mu.Unlock()
+
+	return nil
+}
+
+// MemoryWebhooks is a WebhookStore kept in slices, for tests. Emails are
+// looked up in the given email store to find an address's deliveries.
+type MemoryWebhooks struct {
+	mu         sync.RWMutex
+	nextID     uint
+	hooks      []db.Webhook
+	deliveries []db.WebhookDelivery
+	emails     *MemoryEmails
+}
+
+// NewMemoryWebhooks returns an empty MemoryWebhooks
+func NewMemoryWebhooks(emails *MemoryEmails) *MemoryWebhooks {
+	return &MemoryWebhooks{emails: emails}
+}
+
+func (s *MemoryWebhooks) List() ([]db.Webhook, error) {
+	s.mu.RLock()
+	hooks := append([]db.Webhook(nil), s.hooks...)
+	s.mu.RUnlock()
+
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].AddressID < hooks[j].AddressID
+	})
+
+	return hooks, nil
+}
+
+func (s *MemoryWebhooks) For(addressID string) ([]db.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hooks []db.Webhook
+	for _, hook := range s.hooks {
+		if hook.AddressID == addressID || hook.AddressID == "" {
+			hooks = append(hooks, hook)
+		}
+	}
+
+	return hooks, nil
+}
+
+func (s *MemoryWebhooks) Get(id uint) (db.Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, hook := range s.hooks {
+		if hook.ID == id {
+			return hook, nil
+		}
+	}
+
+	return db.Webhook{}, ErrNotFound
+}
+
+func (s *MemoryWebhooks) Create(hook *db.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	hook.ID = s.nextID
+	s.hooks = append(s.hooks, *hook)
+
+	return nil
+}
+
+func (s *MemoryWebhooks) Delete(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, hook := range s.hooks {
+		if hook.ID == id {
+			s.hooks = append(s.hooks[:i], s.hooks[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *MemoryWebhooks) Deliveries(webhookID uint, limit int) ([]db.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var deliveries []db.WebhookDelivery
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if s.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, s.deliveries[i])
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (s *MemoryWebhooks) GetDelivery(id uint) (db.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, delivery := range s.deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+
+	return db.WebhookDelivery{}, ErrNotFound
+}
+
+func (s *MemoryWebhooks) CreateDelivery(delivery *db.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	delivery.ID = s.nextID
+	s.deliveries = append(s.deliveries, *delivery)
+
+	return nil
+}
+
+func (s *MemoryWebhooks) SaveDelivery(delivery *db.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == delivery.ID {
+			s.deliveries[i] = *delivery
+			return nil
+		}
+	}
+	s.deliveries = append(s.deliveries, *delivery)
+
+	return nil
+}
+
+// due reports whether a delivery has the given status and is due by now
+func due(delivery db.WebhookDelivery, status string, now time.Time) bool {
+	return delivery.Status == status && delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now)
+}
+
+func (s *MemoryWebhooks) Due(status string, now time.Time, limit int) ([]db.WebhookDelivery, error) {
+	s.mu.RLock()
+	var deliveries []db.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if due(delivery, status, now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(*deliveries[j].NextAttemptAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+func (s *MemoryWebhooks) Claim(id uint, status string, now, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == id && due(s.deliveries[i], status, now) {
+			s.deliveries[i].NextAttemptAt = &until
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *MemoryWebhooks) DeleteFor(addressID string) error {
+	emails, _ := s.emails.List(addressID, nil)
+	emailIDs := map[string]bool{}
+	for _, email := range emails {
+		emailIDs[email.ID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hookIDs := map[uint]bool{}
+	hooks := s.hooks[:0]
+	for _, hook := range s.hooks {
+		if hook.AddressID == addressID {
+			hookIDs[hook.ID] = true
+		} else {
+			hooks = append(hooks, hook)
+		}
+	}
+	s.hooks = hooks
+
+	deliveries := s.deliveries[:0]
+	for _, delivery := range s.deliveries {
+		if !hookIDs[delivery.WebhookID] && !emailIDs[delivery.EmailID] {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	s.deliveries = deliveries
+
+	return nil
+}
+
+// MemoryGlobalRules is a GlobalRuleStore kept in a slice, for tests
+type MemoryGlobalRules struct {
+	mu     sync.RWMutex
+	nextID uint
+	rules  []db.GlobalRule
+}
+
+// NewMemoryGlobalRules returns an empty MemoryGlobalRules
+func NewMemoryGlobalRules() *MemoryGlobalRules {
+	return &MemoryGlobalRules{}
+}
+
+func (s *MemoryGlobalRules) List() ([]db.GlobalRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]db.GlobalRule(nil), s.rules...), nil
+}
+
+func (s *MemoryGlobalRules) Create(rule *db.GlobalRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	rule.ID = s.nextID
+	s.rules = append(s.rules, *rule)
+
+	return nil
+}
+
+func (s *MemoryGlobalRules) Delete(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, rule := range s.rules {
+		if rule.ID == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *MemoryGlobalRules) RecordHit(id uint, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.rules {
+		if s.rules[i].ID == id {
+			s.rules[i].Hits++
+			s.rules[i].LastHitAt = &at
+		}
+	}
+
+	return nil
+}
+
+// MemoryEvents is an EventStore kept in a map, for tests
+type MemoryEvents struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewMemoryEvents returns an empty MemoryEvents
+func NewMemoryEvents() *MemoryEvents {
+	return &MemoryEvents{seen: map[string]time.Time{}}
+}
+
+func (s *MemoryEvents) MarkSeen(eventID string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, seen := s.seen[eventID]; seen {
+		return false, nil
+	}
+	s.seen[eventID] = at
+
+	return true, nil
+}
+
+func (s *MemoryEvents) Forget(eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.seen, eventID)
+	return nil
+}
+
+func (s *MemoryEvents) Prune(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for eventID, at := range s.seen {
+		if at.Before(before) {
+			delete(s.seen, eventID)
+		}
+	}
+
+	return nil
+}
+
+// MemorySearch is a SearchStore over a MemoryEmails, matching the way the
+// simpler database search does
+type MemorySearch struct {
+	emails *MemoryEmails
+}
+
+// NewMemorySearch returns a MemorySearch over emails
+func NewMemorySearch(emails *MemoryEmails) *MemorySearch {
+	return &MemorySearch{emails: emails}
+}
+
+// Index does nothing, since emails are searched directly
+func (s *MemorySearch) Index(emailID string) error {
+	return nil
+}
+
+func (s *MemorySearch) Search(q search.Query) ([]search.Hit, error) {
+	s.emails.mu.RLock()
+	var matched []db.Email
+	for _, email := range s.emails.emails {
+		if search.Matches(q, email) {
+			matched = append(matched, email)
+		}
+	}
+	s.emails.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+	if len(matched) > q.MaxHits() {
+		matched = matched[:q.MaxHits()]
+	}
+
+	return search.Highlight(matched, q.Text), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
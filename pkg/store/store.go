@@ -0,0 +1,260 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/search"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned when a lookup matches nothing. It's the same error
+// Gorm returns, so callers can check for either.
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// ErrIDExhausted is returned when every generated ID collided with an
+// existing record
+var ErrIDExhausted = errors.New("could not generate an unused ID")
+
+// How many fresh IDs to try before giving up on an insert
+const maxIDAttempts = 5
+
+// AddressStore holds temporary addresses
+type AddressStore interface {
+	// Create inserts an address under the first ID from newID that isn't
+	// already taken on any domain
+	Create(address *db.Address, newID func() string) error
+	Get(id string) (db.Address, error)
+	// FindActive looks up an address by local part and domain that hasn't
+	// expired by now
+	FindActive(id, domain string, now time.Time) (db.Address, error)
+	// FindActiveByTimestamp looks up the unexpired address requested by a
+	// Slack message
+	FindActiveByTimestamp(timestamp string, now time.Time) (db.Address, error)
+	Save(address *db.Address) error
+	// List returns every address, newest first
+	List() ([]db.Address, error)
+	// ExpiringBetween returns addresses expiring after from and no later than
+	// to that haven't been warned yet
+	ExpiringBetween(from, to time.Time) ([]db.Address, error)
+	// ExpiredUnnotified returns addresses expired by now whose owners haven't
+	// been told yet
+	ExpiredUnnotified(now time.Time) ([]db.Address, error)
+	// Count returns how many addresses exist and how many are active now
+	Count(now time.Time) (total, active int64, err error)
+	CountActiveByUser(user string, now time.Time) (int64, error)
+	CountCreatedByUser(user string, since time.Time) (int64, error)
+	CountCreatedInChannel(channel string, since time.Time) (int64, error)
+	// ExpiredBefore returns every address expired by now, longest expired
+	// first
+	ExpiredBefore(now time.Time) ([]db.Address, error)
+	// AssignDomain gives addresses created before domains were tracked the
+	// given domain
+	AssignDomain(domain string) error
+	Delete(id string) error
+}
+
+// TagCount is how many emails an address received with one plus-address tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// EmailStore holds received emails
+type EmailStore interface {
+	// Create inserts an email under the first ID from newID that isn't
+	// already taken
+	Create(email *db.Email, newID func() string) error
+	// Get returns an email along with the address it was sent to
+	Get(id string) (db.Email, error)
+	// List returns an address's emails, newest first, optionally only those
+	// with the given tag
+	List(addressID string, tag *string) ([]db.Email, error)
+	// Tags counts an address's emails by tag, in tag order
+	Tags(addressID string) ([]TagCount, error)
+	Delete(id string) error
+	Count() (int64, error)
+
+	// Related returns an address's emails that are either one of parents,
+	// by Message-ID, or that name messageID in In-Reply-To or References
+	Related(addressID, messageID string, parents []string) ([]db.Email, error)
+	// LatestWithSubject returns an address's newest email received since the
+	// given time with the given ThreadSubject, from a sender at senderDomain
+	LatestWithSubject(addressID, threadSubject, senderDomain string, since time.Time) (db.Email, error)
+	// MergeThreads moves an address's emails in any of the from threads into
+	// thread to
+	MergeThreads(addressID string, from []string, to string) error
+	// Thread returns the emails in one of an address's threads, oldest first
+	Thread(addressID, threadID string) ([]db.Email, error)
+
+	// CountFor returns how many emails an address has
+	CountFor(addressID string) (int64, error)
+	// DeleteFor deletes up to limit of an address's emails and returns how
+	// many it deleted
+	DeleteFor(addressID string, limit int) (int64, error)
+}
+
+// DomainStore holds receiving domains
+type DomainStore interface {
+	Create(domain *db.Domain) error
+	Get(name string) (db.Domain, error)
+	Save(domain *db.Domain) error
+	// List returns every domain, by pool and then name
+	List() ([]db.Domain, error)
+	// InPool returns a pool's enabled, verified domains
+	InPool(pool string) ([]db.Domain, error)
+	// Unverified returns domains still waiting on DNS verification
+	Unverified() ([]db.Domain, error)
+}
+
+// SenderStore holds each address's sender rules and the log of mail they
+// turned away
+type SenderStore interface {
+	// Rules returns an address's sender rules, oldest first
+	Rules(addressID string) ([]db.SenderRule, error)
+	AddRule(rule *db.SenderRule) error
+	// DeleteRule deletes one of an address's rules, or returns ErrNotFound
+	DeleteRule(addressID string, id uint) error
+
+	LogBlocked(blocked *db.BlockedEmail) error
+	// Blocked returns up to limit of an address's blocked mail, newest first
+	Blocked(addressID string, limit int) ([]db.BlockedEmail, error)
+	CountBlocked(addressID string) (int64, error)
+
+	// DeleteFor deletes an address's rules and blocked mail log, and returns
+	// how much blocked mail it deleted
+	DeleteFor(addressID string) (int64, error)
+}
+
+// ForwardStore holds each address's forward rules
+type ForwardStore interface {
+	// List returns an address's forward rules, oldest first
+	List(addressID string) ([]db.ForwardRule, error)
+	// Confirmed returns an address's forward rules whose destination has
+	// confirmed them
+	Confirmed(addressID string) ([]db.ForwardRule, error)
+	FindByToken(token string) (db.ForwardRule, error)
+	Create(rule *db.ForwardRule) error
+	Save(rule *db.ForwardRule) error
+	// Delete deletes one of an address's rules, or returns ErrNotFound
+	Delete(addressID string, id uint) error
+	DeleteFor(addressID string) error
+}
+
+// WebhookStore holds webhooks and their queued deliveries
+type WebhookStore interface {
+	// List returns every webhook, by address and then age
+	List() ([]db.Webhook, error)
+	// For returns an address's own webhooks along with the global ones
+	For(addressID string) ([]db.Webhook, error)
+	Get(id uint) (db.Webhook, error)
+	Create(hook *db.Webhook) error
+	// Delete deletes a webhook, or returns ErrNotFound
+	Delete(id uint) error
+
+	// Deliveries returns up to limit of a webhook's deliveries, newest first
+	Deliveries(webhookID uint, limit int) ([]db.WebhookDelivery, error)
+	GetDelivery(id uint) (db.WebhookDelivery, error)
+	CreateDelivery(delivery *db.WebhookDelivery) error
+	SaveDelivery(delivery *db.WebhookDelivery) error
+	// Due returns up to limit of the deliveries with the given status whose
+	// next attempt is due by now, most overdue first
+	Due(status string, now time.Time, limit int) ([]db.WebhookDelivery, error)
+	// Claim pushes a due delivery's next attempt back to until, reporting
+	// false if it's no longer due or has changed status
+	Claim(id uint, status string, now, until time.Time) (bool, error)
+	// DeleteFor deletes an address's webhooks, their deliveries and every
+	// delivery of the address's emails, global webhooks' included. It must
+	// run before the emails themselves are deleted.
+	DeleteFor(addressID string) error
+}
+
+// GlobalRuleStore holds the server-wide blocklist
+type GlobalRuleStore interface {
+	// List returns every rule in the order they were added
+	List() ([]db.GlobalRule, error)
+	Create(rule *db.GlobalRule) error
+	// Delete deletes a rule, or returns ErrNotFound
+	Delete(id uint) error
+	// RecordHit counts a match against a rule
+	RecordHit(id uint, at time.Time) error
+}
+
+// EventStore remembers which Slack events have been handled
+type EventStore interface {
+	// MarkSeen records an event ID, reporting false if it was already
+	// recorded
+	MarkSeen(eventID string, at time.Time) (bool, error)
+	Forget(eventID string) error
+	// Prune forgets events recorded before the given time
+	Prune(before time.Time) error
+}
+
+// SearchStore indexes emails and searches them
+type SearchStore interface {
+	// Index refreshes an email's entry in the index once it's saved
+	Index(emailID string) error
+	// Search returns the emails matching a query, best matches first
+	Search(q search.Query) ([]search.Hit, error)
+}
+
+// Stores bundles the stores handed to each part of the app
+type Stores struct {
+	Addresses   AddressStore
+	Emails      EmailStore
+	Domains     DomainStore
+	Senders     SenderStore
+	Forwards    ForwardStore
+	Webhooks    WebhookStore
+	GlobalRules GlobalRuleStore
+	Events      EventStore
+	Search      SearchStore
+}
+
+// Gorm returns stores backed by a Gorm database
+func Gorm(conn *gorm.DB) Stores {
+	return Stores{
+		Addresses:   &GormAddresses{DB: conn},
+		Emails:      &GormEmails{DB: conn},
+		Domains:     &GormDomains{DB: conn},
+		Senders:     &GormSenders{DB: conn},
+		Forwards:    &GormForwards{DB: conn},
+		Webhooks:    &GormWebhooks{DB: conn},
+		GlobalRules: &GormGlobalRules{DB: conn},
+		Events:      &GormEvents{DB: conn},
+		Search:      &GormSearch{DB: conn},
+	}
+}
+
+// Memory returns empty in-memory stores, for tests
+func Memory() Stores {
+	addresses := NewMemoryAddresses()
+	emails := NewMemoryEmails(addresses)
+	return Stores{
+		Addresses:   addresses,
+		Emails:      emails,
+		Domains:     NewMemoryDomains(),
+		Senders:     NewMemorySenders(),
+		Forwards:    NewMemoryForwards(),
+		Webhooks:    NewMemoryWebhooks(emails),
+		GlobalRules: NewMemoryGlobalRules(),
+		Events:      NewMemoryEvents(),
+		Search:      NewMemorySearch(emails),
+	}
+}
+
+// refersTo reports whether email names messageID in In-Reply-To or References
+func refersTo(email db.Email, messageID string) bool {
+	if email.InReplyTo == messageID {
+		return true
+	}
+	for _, id := range strings.Fields(email.ReferenceIDs) {
+		if id == messageID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/search"
+)
+
+// backends returns a fresh store of each kind
+func backends(t *testing.T) map[string]Stores {
+	t.Setenv("DATABASE_URL", "sqlite::memory:")
+	db.Connect()
+
+	return map[string]Stores{
+		"gorm":   Gorm(db.DB),
+		"memory": Memory(),
+	}
+}
+
+// sequence returns a newID func handing out ids in order
+func sequence(ids ...string) func() string {
+	i := 0
+	return func() string {
+		id := ids[i%len(ids)]
+		i++
+		return id
+	}
+}
+
+func TestCreateRedrawsLocalPartTakenOnAnotherDomain(t *testing.T) {
+	for name, stores := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			expires := time.Now().Add(time.Hour)
+
+			first := db.Address{Domain: "one.example", ExpiresAt: expires}
+			if err := stores.Addresses.Create(&first, sequence("shared")); err != nil {
+				t.Fatal(err)
+			}
+
+			second := db.Address{Domain: "two.example", ExpiresAt: expires}
+			if err := stores.Addresses.Create(&second, sequence("shared", "fresh")); err != nil {
+				t.Fatal(err)
+			}
+			if second.ID != "fresh" {
+				t.Fatalf("second address got local part %q, want it redrawn to %q", second.ID, "fresh")
+			}
+
+			if _, err := stores.Addresses.FindActive("shared", "two.example", time.Now()); err != ErrNotFound {
+				t.Errorf("shared@two.example was found (err %v), want ErrNotFound", err)
+			}
+			if a, err := stores.Addresses.FindActive("shared", "one.example", time.Now()); err != nil || a.Domain != "one.example" {
+				t.Errorf("shared@one.example = %+v, %v", a, err)
+			}
+
+			third := db.Address{Domain: "two.example", ExpiresAt: expires}
+			if err := stores.Addresses.Create(&third, sequence("shared")); err != ErrIDExhausted {
+				t.Errorf("creating with only a taken local part returned %v, want ErrIDExhausted", err)
+			}
+		})
+	}
+}
+
+func TestWebhooksDeleteForRemovesAddressDeliveries(t *testing.T) {
+	for name, stores := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			var emailIDs []string
+			for _, address := range []string{"gone", "kept"} {
+				if err := stores.Addresses.Save(&db.Address{ID: address, ExpiresAt: time.Now()}); err != nil {
+					t.Fatal(err)
+				}
+				email := db.Email{AddressID: address}
+				if err := stores.Emails.Create(&email, sequence(address+"-email")); err != nil {
+					t.Fatal(err)
+				}
+				emailIDs = append(emailIDs, email.ID)
+			}
+
+			global := db.Webhook{URL: "https://hooks.example/all"}
+			own := db.Webhook{AddressID: "gone", URL: "https://hooks.example/gone"}
+			other := db.Webhook{AddressID: "kept", URL: "https://hooks.example/kept"}
+			for _, hook := range []*db.Webhook{&global, &own, &other} {
+				if err := stores.Webhooks.Create(hook); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, d := range []db.WebhookDelivery{
+				{WebhookID: global.ID, EmailID: emailIDs[0], Payload: "gone's email"},
+				{WebhookID: global.ID, EmailID: emailIDs[1], Payload: "kept's email"},
+				{WebhookID: own.ID, EmailID: emailIDs[0], Payload: "gone's email"},
+				{WebhookID: other.ID, EmailID: emailIDs[1], Payload: "kept's email"},
+			} {
+				d := d
+				if err := stores.Webhooks.CreateDelivery(&d); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := stores.Webhooks.DeleteFor("gone"); err != nil {
+				t.Fatal(err)
+			}
+
+			hooks, _ := stores.Webhooks.List()
+			if len(hooks) != 2 || hooks[0].ID != global.ID || hooks[1].ID != other.ID {
+				t.Errorf("webhooks left = %+v, want the global one and kept's", hooks)
+			}
+			for _, hook := range []db.Webhook{global, own, other} {
+				deliveries, _ := stores.Webhooks.Deliveries(hook.ID, 10)
+				for _, d := range deliveries {
+					if d.Payload != "kept's email" {
+						t.Errorf("webhook %d still has delivery %+v", hook.ID, d)
+					}
+				}
+				if hook.ID != own.ID && len(deliveries) != 1 {
+					t.Errorf("webhook %d has %d deliveries, want kept's one", hook.ID, len(deliveries))
+				}
+			}
+		})
+	}
+}
+
+func TestSearchFindsMatchingEmails(t *testing.T) {
+	for name, stores := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, address := range []string{"inbox", "other"} {
+				if err := stores.Addresses.Save(&db.Address{ID: address, ExpiresAt: time.Now()}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			now := time.Now()
+			for _, email := range []db.Email{
+				{AddressID: "inbox", CreatedAt: now.Add(-time.Hour), Sender: "noreply@github.com", Subject: "Reset your password", BodyText: "Click the link to reset it"},
+				{AddressID: "inbox", CreatedAt: now, Sender: "receipts@stripe.com", Subject: "Your receipt", BodyText: "Thanks for the password reset payment"},
+				{AddressID: "other", CreatedAt: now, Sender: "noreply@github.com", Subject: "Reset your password", BodyText: "Not yours"},
+			} {
+				email := email
+				id := email.Sender[:strings.Index(email.Sender, "@")] + "-" + email.AddressID
+				if err := stores.Emails.Create(&email, sequence(id)); err != nil {
+					t.Fatal(err)
+				}
+				if err := stores.Search.Index(email.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				query search.Query
+				want  string
+			}{
+				{search.Query{Text: "password reset", AddressID: "inbox"}, "receipts-inbox noreply-inbox"},
+				{search.Query{Text: "RESET", Sender: "github"}, "noreply-other noreply-inbox"},
+				{search.Query{Text: "reset", AddressID: "inbox", Since: now.Add(-time.Minute)}, "receipts-inbox"},
+				{search.Query{Text: "invoice"}, ""},
+			}
+			for _, tt := range tests {
+				hits, err := stores.Search.Search(tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []string
+				for _, hit := range hits {
+					ids = append(ids, hit.ID)
+				}
+				if got := strings.Join(ids, " "); got != tt.want {
+					t.Errorf("Search(%+v) = %q, want %q", tt.query, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLatestWithSubjectMatchesSenderDomain(t *testing.T) {
+	for name, stores := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := stores.Addresses.Save(&db.Address{ID: "inbox", ExpiresAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+
+			now := time.Now()
+			for i, sender := range []string{"alerts@bank.example", "alerts@my_bank.example", "Alerts@NOTBANK.example"} {
+				email := db.Email{AddressID: "inbox", CreatedAt: now.Add(time.Duration(i) * time.Minute), Sender: sender, ThreadSubject: "security alert", ThreadID: sender}
+				if err := stores.Emails.Create(&email, sequence(sender)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				domain, want string
+			}{
+				{"bank.example", "alerts@bank.example"},
+				{"BANK.example", "alerts@bank.example"},
+				{"notbank.example", "Alerts@NOTBANK.example"},
+				{"my_bank.example", "alerts@my_bank.example"},
+				// "_" and "%" are only themselves, not LIKE wildcards
+				{"my%bank.example", ""},
+				{"myxbank.example", ""},
+				{"shop.example", ""},
+			}
+			for _, tt := range tests {
+				email, err := stores.Emails.LatestWithSubject("inbox", "security alert", tt.domain, now.Add(-time.Hour))
+				if tt.want == "" {
+					if err != ErrNotFound {
+						t.Errorf("LatestWithSubject(%q) = %q, %v; want ErrNotFound", tt.domain, email.Sender, err)
+					}
+				} else if err != nil || email.Sender != tt.want {
+					t.Errorf("LatestWithSubject(%q) = %q, %v; want %q", tt.domain, email.Sender, err, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package threading
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/util"
+)
+
+// Conversations are built along the lines of Jamie Zawinski's threading
+// algorithm (https://www.jwz.org/doc/threading.html), one message at a time
+// as mail arrives. A message's thread is rooted at the first ID in its
+// References, even if that message never arrived here, so replies join up
+// with whatever part of the conversation has been received. Messages that
+// name no parents fall back to grouping by subject, but only with mail from
+// the same domain, so unrelated "Your order" receipts stay apart.
+
+// How far back a subject-only match can reach
+const subjectWindow = 30 * 24 * time.Hour
+
+// MessageIDs pulls the IDs out of a Message-ID, In-Reply-To or References
+// header, without their angle brackets
+func MessageIDs(header string) []string {
+	var ids []string
+	for {
+		start := strings.IndexByte(header, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(header[start:], '>')
+		if end < 0 {
+			break
+		}
+
+		if id := strings.TrimSpace(header[start+1 : start+end]); id != "" {
+			ids = append(ids, id)
+		}
+		header = header[start+end+1:]
+	}
+
+	// Some senders leave the brackets, or one of them, off a lone ID
+	if len(ids) == 0 {
+		if id := strings.Trim(strings.TrimSpace(header), "<>"); id != "" && !strings.ContainsAny(id, " \t") {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// NormalizeSubject strips reply and forward prefixes from a subject, so
+// "Re: Fwd: Your order" and "your order" match
+func NormalizeSubject(subject string) string {
+	s := strings.ToLower(strings.Join(strings.Fields(subject), " "))
+	for {
+		trimmed := s
+		for _, prefix := range []string{"re:", "fwd:", "fw:", "aw:", "re :", "fwd :"} {
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, prefix))
+		}
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
+	}
+}
+
+// senderDomain returns the lowercased domain of a sender's address, or ""
+// if it has none
+func senderDomain(sender string) string {
+	at := strings.LastIndex(sender, "@")
+	if at < 0 || at == len(sender)-1 {
+		return ""
+	}
+
+	return strings.ToLower(sender[at+1:])
+}
+
+// key turns a root Message-ID into a thread ID
+func key(messageID string) string {
+	sum := sha1.Sum([]byte(messageID))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// parents lists the messages email replies to, oldest first: its
+// References, then In-Reply-To if References didn't already end with it
+func parents(email db.Email) []string {
+	refs := strings.Fields(email.ReferenceIDs)
+	if email.InReplyTo != "" && !contains(refs, email.InReplyTo) {
+		refs = append(refs, email.InReplyTo)
+	}
+
+	// A message can't be its own ancestor
+	var ids []string
+	for _, id := range refs {
+		if id != email.MessageID {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Assign reads email's threading headers from its content and picks its
+// ThreadID. It's called before the email is stored. Threads the email turns
+// out to connect, such as a reply that arrived before its parent, are merged
+// into one.
+func Assign(emails store.EmailStore, email *db.Email) error {
+	if msg, err := mail.ReadMessage(strings.NewReader(email.Content)); err == nil {
+		if ids := MessageIDs(msg.Header.Get("Message-ID")); len(ids) > 0 {
+			email.MessageID = ids[0]
+		}
+		if ids := MessageIDs(msg.Header.Get("In-Reply-To")); len(ids) > 0 {
+			email.InReplyTo = ids[0]
+		}
+		email.ReferenceIDs = strings.Join(MessageIDs(msg.Header.Get("References")), " ")
+	}
+	email.ThreadSubject = NormalizeSubject(email.Subject)
+
+	ancestors := parents(*email)
+	related, err := emails.Related(email.AddressID, email.MessageID, ancestors)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(related) > 0:
+		// Join the conversation of the earliest related message
+		sort.Slice(related, func(i, j int) bool {
+			return related[i].CreatedAt.Before(related[j].CreatedAt)
+		})
+		email.ThreadID = related[0].ThreadID
+	case len(ancestors) > 0:
+		email.ThreadID = key(ancestors[0])
+	default:
+		if domain := senderDomain(email.Sender); email.ThreadSubject != "" && domain != "" {
+			match, err := emails.LatestWithSubject(email.AddressID, email.ThreadSubject, domain, time.Now().Add(-subjectWindow))
+			if err == nil {
+				email.ThreadID = match.ThreadID
+				return nil
+			} else if err != store.ErrNotFound {
+				return err
+			}
+		}
+
+		if email.MessageID != "" {
+			email.ThreadID = key(email.MessageID)
+		} else {
+			email.ThreadID = util.GenerateEmailID()
+		}
+	}
+
+	var others []string
+	for _, r := range related {
+		if r.ThreadID != email.ThreadID && !contains(others, r.ThreadID) {
+			others = append(others, r.ThreadID)
+		}
+	}
+	if len(others) > 0 {
+		return emails.MergeThreads(email.AddressID, others, email.ThreadID)
+	}
+
+	return nil
+}
+
+// Summary describes one conversation
+type Summary struct {
+	ThreadID string    `json:"threadId"`
+	Subject  string    `json:"subject"`
+	Count    int       `json:"count"`
+	Senders  []string  `json:"senders"`
+	FirstAt  time.Time `json:"firstAt"`
+	LastAt   time.Time `json:"lastAt"`
+	LatestID string    `json:"latestId"`
+}
+
+// Summarize groups emails into conversations, most recently active first.
+// Each is named after the subject of its earliest email.
+func Summarize(emails []db.Email) []Summary {
+	byThread := map[string]*Summary{}
+	var order []*Summary
+
+	for _, email := range emails {
+		id := email.ThreadID
+		if id == "" {
+			id = email.ID
+		}
+
+		s, ok := byThread[id]
+		if !ok {
+			s = &Summary{
+				ThreadID: id,
+				Subject:  email.Subject,
+				Senders:  []string{},
+				FirstAt:  email.CreatedAt,
+				LastAt:   email.CreatedAt,
+				LatestID: email.ID,
+			}
+			byThread[id] = s
+			order = append(order, s)
+		}
+
+		s.Count++
+		if email.CreatedAt.Before(s.FirstAt) {
+			s.FirstAt = email.CreatedAt
+			s.Subject = email.Subject
+		}
+		if email.CreatedAt.After(s.LastAt) {
+			s.LastAt = email.CreatedAt
+			s.LatestID = email.ID
+		}
+		if email.Sender != "" && !contains(s.Senders, email.Sender) {
+			s.Senders = append(s.Senders, email.Sender)
+		}
+	}
+
+	summaries := make([]Summary, 0, len(order))
+	for _, s := range order {
+		summaries = append(summaries, *s)
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].LastAt.After(summaries[j].LastAt)
+	})
+
+	return summaries
+}
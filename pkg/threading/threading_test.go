@@ -0,0 +1,236 @@
+package threading
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+func TestMessageIDs(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"<a@example.com>", []string{"a@example.com"}},
+		{"<a@example.com> <b@example.com>\r\n\t<c@example.com>", []string{"a@example.com", "b@example.com", "c@example.com"}},
+		{"<a@example.com>,<b@example.com>", []string{"a@example.com", "b@example.com"}},
+		{"< a@example.com >", []string{"a@example.com"}},
+		{"a@example.com", []string{"a@example.com"}},
+		{"  a@example.com  ", []string{"a@example.com"}},
+		{"Your message of Tue, 1 Oct", nil},
+		{"<> <a@example.com>", []string{"a@example.com"}},
+		{"<a@example.com", []string{"a@example.com"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := MessageIDs(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MessageIDs(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSubject(t *testing.T) {
+	tests := []struct {
+		subject, want string
+	}{
+		{"Your order", "your order"},
+		{"Re: Your order", "your order"},
+		{"RE: Fwd: re:  Your   order", "your order"},
+		{"FW: AW: Your order", "your order"},
+		{"Re : Your order", "your order"},
+		{"  \tYour order\r\n", "your order"},
+		{"Regarding your order", "regarding your order"},
+		{"Re:", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeSubject(tt.subject); got != tt.want {
+			t.Errorf("NormalizeSubject(%q) = %q, want %q", tt.subject, got, tt.want)
+		}
+	}
+}
+
+// arrival is one email delivered to the inbox address
+type arrival struct {
+	id, sender, subject string
+	headers             string
+}
+
+// receive threads and stores each arrival in order, a minute apart, and
+// returns the thread each one ended up in
+func receive(t *testing.T, emails store.EmailStore, arrivals ...arrival) map[string]string {
+	t.Helper()
+
+	start := time.Now().Add(-time.Hour)
+	for i, a := range arrivals {
+		email := db.Email{
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+			AddressID: "inbox",
+			Sender:    a.sender,
+			Subject:   a.subject,
+			Content:   "From: " + a.sender + "\r\nSubject: " + a.subject + "\r\n" + a.headers + "\r\nHello\r\n",
+		}
+		if err := Assign(emails, &email); err != nil {
+			t.Fatal(err)
+		}
+		id := a.id
+		if err := emails.Create(&email, func() string { return id }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	threads := map[string]string{}
+	for _, a := range arrivals {
+		email, err := emails.Get(a.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		threads[a.id] = email.ThreadID
+	}
+
+	return threads
+}
+
+func newEmails() store.EmailStore {
+	return store.NewMemoryEmails(store.NewMemoryAddresses())
+}
+
+func TestAssign(t *testing.T) {
+	tests := []struct {
+		name     string
+		arrivals []arrival
+		// Groups of email IDs that should share a thread, each apart from
+		// the others
+		want [][]string
+	}{
+		{
+			"reply by In-Reply-To",
+			[]arrival{
+				{"first", "a@shop.example", "Your order", "Message-ID: <1@shop.example>\r\n"},
+				{"reply", "b@me.example", "Re: Your order", "Message-ID: <2@me.example>\r\nIn-Reply-To: <1@shop.example>\r\n"},
+			},
+			[][]string{{"first", "reply"}},
+		},
+		{
+			"reply by References to a message that never arrived",
+			[]arrival{
+				{"second", "a@shop.example", "Re: Hi", "Message-ID: <2@shop.example>\r\nReferences: <1@shop.example>\r\n"},
+				{"third", "b@me.example", "Re: Hi", "Message-ID: <3@me.example>\r\nReferences: <1@shop.example> <2@shop.example>\r\n"},
+			},
+			[][]string{{"second", "third"}},
+		},
+		{
+			"reply arriving before its parent",
+			[]arrival{
+				{"reply", "b@me.example", "Re: Plans", "Message-ID: <2@me.example>\r\nIn-Reply-To: <1@shop.example>\r\n"},
+				{"other", "c@elsewhere.example", "Plans", "Message-ID: <9@elsewhere.example>\r\n"},
+				{"parent", "a@shop.example", "Plans", "Message-ID: <1@shop.example>\r\n"},
+			},
+			[][]string{{"reply", "parent"}, {"other"}},
+		},
+		{
+			"parent joining two replies that started their own threads",
+			[]arrival{
+				{"reply1", "b@me.example", "Re: Plans", "Message-ID: <2@me.example>\r\nIn-Reply-To: <1@shop.example>\r\n"},
+				{"reply2", "c@you.example", "Re: Re: Plans", "Message-ID: <3@you.example>\r\nIn-Reply-To: <2@me.example>\r\n"},
+				{"parent", "a@shop.example", "Plans", "Message-ID: <1@shop.example>\r\n"},
+			},
+			[][]string{{"reply1", "reply2", "parent"}},
+		},
+		{
+			"subject fallback from the same sender",
+			[]arrival{
+				{"first", "alerts@bank.example", "Security alert", "Message-ID: <1@bank.example>\r\n"},
+				{"second", "alerts@bank.example", "Re: Security alert", "Message-ID: <2@bank.example>\r\n"},
+			},
+			[][]string{{"first", "second"}},
+		},
+		{
+			"subject fallback from the same domain",
+			[]arrival{
+				{"first", "alerts@bank.example", "Security alert", ""},
+				{"second", "Support@BANK.example", "Security alert", ""},
+			},
+			[][]string{{"first", "second"}},
+		},
+		{
+			"subject fallback refused for another domain",
+			[]arrival{
+				{"shop", "orders@shop.example", "Your order", "Message-ID: <1@shop.example>\r\n"},
+				{"other", "orders@other.example", "Your order", "Message-ID: <1@other.example>\r\n"},
+			},
+			[][]string{{"shop"}, {"other"}},
+		},
+		{
+			"subject fallback refused for a lookalike domain",
+			[]arrival{
+				{"bank", "alerts@bank.example", "Security alert", ""},
+				{"fake", "alerts@notbank.example", "Security alert", ""},
+			},
+			[][]string{{"bank"}, {"fake"}},
+		},
+		{
+			"subject fallback refused without a sender",
+			[]arrival{
+				{"first", "", "Hello", ""},
+				{"second", "", "Hello", ""},
+			},
+			[][]string{{"first"}, {"second"}},
+		},
+		{
+			"no subject fallback for replies",
+			[]arrival{
+				{"first", "a@shop.example", "Your order", "Message-ID: <1@shop.example>\r\n"},
+				{"second", "a@shop.example", "Your order", "Message-ID: <5@shop.example>\r\nIn-Reply-To: <4@shop.example>\r\n"},
+			},
+			[][]string{{"first"}, {"second"}},
+		},
+	}
+	for _, tt := range tests {
+		threads := receive(t, newEmails(), tt.arrivals...)
+
+		seen := map[string]string{}
+		for _, group := range tt.want {
+			thread := threads[group[0]]
+			if thread == "" {
+				t.Errorf("%s: %s has no thread", tt.name, group[0])
+			}
+			for _, id := range group[1:] {
+				if threads[id] != thread {
+					t.Errorf("%s: %s and %s are in threads %q and %q, want the same one", tt.name, group[0], id, thread, threads[id])
+				}
+			}
+			if other, ok := seen[thread]; ok {
+				t.Errorf("%s: %s and %s share thread %q, want them apart", tt.name, other, group[0], thread)
+			}
+			seen[thread] = group[0]
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	now := time.Now()
+	emails := []db.Email{
+		{ID: "3", ThreadID: "a", Subject: "Re: Plans", Sender: "b@me.example", CreatedAt: now.Add(-time.Minute)},
+		{ID: "5", ThreadID: "b", Subject: "Receipt", Sender: "shop@store.example", CreatedAt: now.Add(-30 * time.Minute)},
+		{ID: "1", ThreadID: "a", Subject: "Plans", Sender: "a@shop.example", CreatedAt: now.Add(-time.Hour)},
+		{ID: "2", ThreadID: "a", Subject: "Re: Plans", Sender: "a@shop.example", CreatedAt: now.Add(-50 * time.Minute)},
+		{ID: "legacy", Subject: "Old mail", CreatedAt: now.Add(-2 * time.Hour)},
+	}
+
+	want := []Summary{
+		{ThreadID: "a", Subject: "Plans", Count: 3, Senders: []string{"b@me.example", "a@shop.example"}, FirstAt: now.Add(-time.Hour), LastAt: now.Add(-time.Minute), LatestID: "3"},
+		{ThreadID: "b", Subject: "Receipt", Count: 1, Senders: []string{"shop@store.example"}, FirstAt: now.Add(-30 * time.Minute), LastAt: now.Add(-30 * time.Minute), LatestID: "5"},
+		{ThreadID: "legacy", Subject: "Old mail", Count: 1, Senders: []string{}, FirstAt: now.Add(-2 * time.Hour), LastAt: now.Add(-2 * time.Hour), LatestID: "legacy"},
+	}
+	if got := Summarize(emails); !reflect.DeepEqual(got, want) {
+		t.Errorf("Summarize =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got := Summarize(nil); got == nil || len(got) != 0 {
+		t.Errorf("Summarize(nil) = %#v, want an empty list", got)
+	}
+}
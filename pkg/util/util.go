@@ -1,20 +1,47 @@
 package util
 
 import (
-	"math/rand"
+	"crypto/rand"
+	"fmt"
+	"math/big"
 	"strings"
+	"time"
 )
 
-func GenerateEmailAddress() string {
-	chars := []rune("abcdefghijklmnopqrstuvwxyz0123456789")
+const (
+	// Email IDs double as public viewer URLs, so they get 130 bits of
+	// entropy regardless of the address settings
+	emailIDAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	emailIDLength   = 26
+)
+
+// GenerateEmailID returns an unguessable ID for a received email
+func GenerateEmailID() string {
+	return RandomString(emailIDAlphabet, emailIDLength)
+}
 
-	generated := ""
+// RandomString draws length characters uniformly from alphabet using
+// crypto/rand
+func RandomString(alphabet string, length int) string {
+	chars := []rune(alphabet)
 
-	for i := 0; i < 6; i++ {
-		generated = generated + string(chars[rand.Intn(len(chars))])
+	generated := make([]rune, length)
+	for i := range generated {
+		generated[i] = chars[RandomInt(len(chars))]
 	}
 
-	return generated
+	return string(generated)
+}
+
+// RandomInt returns a uniformly random integer in [0, n) using crypto/rand
+func RandomInt(n int) int {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		// The system's CSPRNG is broken; nothing sensible to fall back to
+		panic(err)
+	}
+
+	return int(i.Int64())
 }
 
 // Removes @everyone, @channel, and @here
@@ -30,3 +57,27 @@ func SanitizeInput(input string) string {
 
 	return input
 }
+
+// FormatDuration formats a whole number of minutes, hours or days, e.g.
+// "1 hour" or "7 days"
+func FormatDuration(d time.Duration) string {
+	hours := int(d.Hours())
+
+	if hours == 0 {
+		return pluralize(int(d.Minutes()), "minute")
+	}
+
+	if hours > 24 && hours%24 == 0 {
+		return pluralize(hours/24, "day")
+	}
+
+	return pluralize(hours, "hour")
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,351 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DusanKasan/parsemail"
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/otp"
+	"github.com/cjdenio/temp-email/pkg/store"
+	"github.com/cjdenio/temp-email/pkg/util"
+)
+
+// EventEmailReceived is sent for each new email
+const EventEmailReceived = "email.received"
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+const (
+	// Delay before the first retry, doubled after each failure
+	retryBase = 30 * time.Second
+	retryMax  = 6 * time.Hour
+
+	// How long a delivery is claimed for while it's being sent
+	claimTimeout = time.Minute
+
+	secretAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Attachment is an attachment listed in a Payload
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+// Payload is the JSON body POSTed to webhooks
+type Payload struct {
+	Event       string       `json:"event"`
+	ID          string       `json:"id"`
+	Address     string       `json:"address"`
+	Tag         string       `json:"tag,omitempty"`
+	ThreadID    string       `json:"threadId,omitempty"`
+	From        string       `json:"from"`
+	To          []string     `json:"to"`
+	Subject     string       `json:"subject"`
+	Text        string       `json:"text"`
+	HTML        string       `json:"html,omitempty"`
+	OTP         string       `json:"otp,omitempty"`
+	Attachments []Attachment `json:"attachments"`
+	Spam        bool         `json:"spam"`
+	SpamScore   float64      `json:"spamScore"`
+	URL         string       `json:"url"`
+	ReceivedAt  time.Time    `json:"receivedAt"`
+}
+
+// NewSecret returns a random signing secret for a new webhook
+func NewSecret() string {
+	return util.RandomString(secretAlphabet, 40)
+}
+
+// Sign returns the X-Webhook-Signature for a request: the hex HMAC-SHA256
+// of the timestamp, token and body, keyed with the webhook's secret
+func Sign(secret, timestamp, token string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte(token))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks a signature made by Sign, for receivers written in Go
+func Verify(secret, timestamp, token, signature string, body []byte) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, token, body)))
+}
+
+// BuildPayload describes a received email for webhooks
+func BuildPayload(address db.Address, email db.Email) (Payload, error) {
+	payload := Payload{
+		Event:       EventEmailReceived,
+		ID:          email.ID,
+		Address:     address.ID + "@" + address.Domain,
+		Tag:         email.Tag,
+		ThreadID:    email.ThreadID,
+		From:        email.Sender,
+		Subject:     email.Subject,
+		Text:        email.BodyText,
+		Attachments: []Attachment{},
+		Spam:        email.Spam,
+		SpamScore:   email.SpamScore,
+		URL:         fmt.Sprintf("%s/%s", os.Getenv("APP_DOMAIN"), email.ID),
+		ReceivedAt:  email.CreatedAt,
+	}
+
+	parsed, err := parsemail.Parse(strings.NewReader(email.Content))
+	if err != nil {
+		return payload, err
+	}
+
+	for _, to := range parsed.To {
+		payload.To = append(payload.To, to.Address)
+	}
+	if parsed.TextBody != "" {
+		payload.Text = parsed.TextBody
+	}
+	payload.HTML = parsed.HTMLBody
+	payload.OTP = otp.Extract(payload.Subject, payload.Text)
+
+	for i, attachment := range parsed.Attachments {
+		size, _ := io.Copy(io.Discard, attachment.Data)
+		payload.Attachments = append(payload.Attachments, Attachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Size:        size,
+			URL:         fmt.Sprintf("%s/%s/attachments/%d", os.Getenv("APP_DOMAIN"), email.ID, i),
+		})
+	}
+
+	return payload, nil
+}
+
+// Enqueue queues a delivery of email to each webhook registered for its
+// address, and to each global webhook
+func Enqueue(webhooks store.WebhookStore, address db.Address, email db.Email) {
+	hooks, err := webhooks.For(address.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to look up webhooks for %s: %v", address.ID, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	payload, err := BuildPayload(address, email)
+	if err != nil {
+		// Still deliver what was pulled out at ingest
+		log.Printf("ERROR: Failed to parse email %s for webhooks: %v", email.ID, err)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("ERROR: Failed to encode webhook payload for %s: %v", email.ID, err)
+		return
+	}
+
+	now := time.Now()
+	for _, hook := range hooks {
+		delivery := db.WebhookDelivery{
+			CreatedAt:     now,
+			WebhookID:     hook.ID,
+			EmailID:       email.ID,
+			Payload:       string(body),
+			Status:        StatusPending,
+			NextAttemptAt: &now,
+		}
+		if err := webhooks.CreateDelivery(&delivery); err != nil {
+			log.Printf("ERROR: Failed to queue webhook %d for email %s: %v", hook.ID, email.ID, err)
+		}
+	}
+
+	wake()
+}
+
+// Replay queues a fresh delivery of the same payload as an earlier one
+func Replay(webhooks store.WebhookStore, deliveryID uint) (db.WebhookDelivery, error) {
+	original, err := webhooks.GetDelivery(deliveryID)
+	if err != nil {
+		return original, err
+	}
+
+	now := time.Now()
+	replay := db.WebhookDelivery{
+		CreatedAt:     now,
+		WebhookID:     original.WebhookID,
+		EmailID:       original.EmailID,
+		Payload:       original.Payload,
+		Status:        StatusPending,
+		NextAttemptAt: &now,
+	}
+	if err := webhooks.CreateDelivery(&replay); err != nil {
+		return replay, err
+	}
+
+	wake()
+	return replay, nil
+}
+
+var wakeup = make(chan struct{}, 1)
+
+func wake() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Start delivers queued webhooks in the background, checking every few
+// seconds and straight after new mail is queued
+func Start(webhooks store.WebhookStore) {
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		for {
+			deliverDue(webhooks)
+
+			select {
+			case <-ticker.C:
+			case <-wakeup:
+			}
+		}
+	}()
+}
+
+// maxAttempts is how many times a delivery is tried before it's marked
+// failed, set with WEBHOOK_MAX_ATTEMPTS (default 8)
+func maxAttempts() int {
+	n, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+	if err != nil || n < 1 {
+		return 8
+	}
+
+	return n
+}
+
+// backoff is how long to wait after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	d := retryBase
+	for i := 1; i < attempts && d < retryMax; i++ {
+		d *= 2
+	}
+	if d > retryMax {
+		d = retryMax
+	}
+
+	return d
+}
+
+func deliverDue(webhooks store.WebhookStore) {
+	now := time.Now()
+
+	due, err := webhooks.Due(StatusPending, now, 50)
+	if err != nil {
+		log.Printf("ERROR: Failed to load due webhook deliveries: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range due {
+		// Claim it first so another replica doesn't send it too
+		if claimed, err := webhooks.Claim(delivery.ID, StatusPending, now, now.Add(claimTimeout)); err != nil || !claimed {
+			continue
+		}
+
+		wg.Add(1)
+		go func(delivery db.WebhookDelivery) {
+			defer wg.Done()
+			attempt(webhooks, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+// attempt sends a delivery once and records the outcome
+func attempt(webhooks store.WebhookStore, delivery db.WebhookDelivery) {
+	hook, err := webhooks.Get(delivery.WebhookID)
+
+	code := 0
+	if err == nil {
+		code, err = send(hook, delivery)
+	} else {
+		err = fmt.Errorf("webhook no longer exists")
+		delivery.Attempts = maxAttempts()
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	delivery.LastError = ""
+
+	if err == nil {
+		delivery.Status = StatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= maxAttempts() {
+			delivery.Status = StatusFailed
+			delivery.NextAttemptAt = nil
+			log.Printf("ERROR: Giving up on webhook delivery %d after %d attempts: %v", delivery.ID, delivery.Attempts, err)
+		} else {
+			next := now.Add(backoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	if err := webhooks.SaveDelivery(&delivery); err != nil {
+		log.Printf("ERROR: Failed to record webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs a delivery's payload, signed with the webhook's secret, and
+// returns the response status code
+func send(hook db.Webhook, delivery db.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	token := util.RandomString(secretAlphabet, 32)
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "temp-email-webhooks")
+	req.Header.Set("X-Webhook-Event", EventEmailReceived)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Token", token)
+	req.Header.Set("X-Webhook-Signature", Sign(hook.Secret, timestamp, token, body))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("endpoint responded %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
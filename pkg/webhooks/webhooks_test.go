@@ -0,0 +1,232 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cjdenio/temp-email/pkg/db"
+	"github.com/cjdenio/temp-email/pkg/store"
+)
+
+// endpoint is a webhook receiver answering with a fixed status and
+// remembering the requests it got
+type endpoint struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func newEndpoint(t *testing.T, status int) (*endpoint, *httptest.Server) {
+	e := &endpoint{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		e.mu.Lock()
+		e.requests = append(e.requests, r)
+		e.bodies = append(e.bodies, string(body))
+		e.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return e, server
+}
+
+// queue stores a webhook for url with one delivery that's due now
+func queue(t *testing.T, webhooks store.WebhookStore, url string) (db.Webhook, db.WebhookDelivery) {
+	t.Helper()
+
+	hook := db.Webhook{URL: url, Secret: "hook-secret"}
+	if err := webhooks.Create(&hook); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	delivery := db.WebhookDelivery{
+		WebhookID:     hook.ID,
+		EmailID:       "email1",
+		Payload:       `{"event":"email.received","id":"email1"}`,
+		Status:        StatusPending,
+		NextAttemptAt: &now,
+	}
+	if err := webhooks.CreateDelivery(&delivery); err != nil {
+		t.Fatal(err)
+	}
+
+	return hook, delivery
+}
+
+func TestSignCoversTimestampTokenAndBody(t *testing.T) {
+	body := []byte(`{"id":"email1"}`)
+	signature := Sign("hook-secret", "1700000000", "token", body)
+
+	if !Verify("hook-secret", "1700000000", "token", signature, body) {
+		t.Fatal("signature didn't verify")
+	}
+
+	tests := []struct {
+		name                     string
+		secret, timestamp, token string
+		body                     []byte
+	}{
+		{"other secret", "other-secret", "1700000000", "token", body},
+		{"replayed later", "hook-secret", "1700000300", "token", body},
+		{"other token", "hook-secret", "1700000000", "other", body},
+		{"tampered body", "hook-secret", "1700000000", "token", []byte(`{"id":"email2"}`)},
+	}
+	for _, tt := range tests {
+		if Verify(tt.secret, tt.timestamp, tt.token, signature, tt.body) {
+			t.Errorf("%s: signature still verified", tt.name)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverySignedAndMarkedDelivered(t *testing.T) {
+	received, server := newEndpoint(t, http.StatusNoContent)
+	webhooks := store.Memory().Webhooks
+	_, delivery := queue(t, webhooks, server.URL)
+
+	deliverDue(webhooks)
+
+	if len(received.requests) != 1 {
+		t.Fatalf("endpoint got %d requests, want 1", len(received.requests))
+	}
+	r := received.requests[0]
+	if !Verify("hook-secret", r.Header.Get("X-Webhook-Timestamp"), r.Header.Get("X-Webhook-Token"), r.Header.Get("X-Webhook-Signature"), []byte(received.bodies[0])) {
+		t.Errorf("request with headers %v didn't verify", r.Header)
+	}
+	if received.bodies[0] != delivery.Payload {
+		t.Errorf("body = %s, want the queued payload", received.bodies[0])
+	}
+
+	delivery, _ = webhooks.GetDelivery(delivery.ID)
+	if delivery.Status != StatusDelivered || delivery.Attempts != 1 || delivery.ResponseCode != 204 || delivery.NextAttemptAt != nil || delivery.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want it delivered on the first attempt", delivery)
+	}
+}
+
+func TestDeliveryFailsOnceAttemptsRunOut(t *testing.T) {
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "2")
+	received, server := newEndpoint(t, http.StatusInternalServerError)
+	webhooks := store.Memory().Webhooks
+	_, delivery := queue(t, webhooks, server.URL)
+
+	before := time.Now()
+	deliverDue(webhooks)
+
+	delivery, _ = webhooks.GetDelivery(delivery.ID)
+	if delivery.Status != StatusPending || delivery.Attempts != 1 || delivery.ResponseCode != 500 || delivery.LastError == "" {
+		t.Fatalf("delivery after one failure = %+v, want it pending with the error", delivery)
+	}
+	if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.Before(before.Add(retryBase)) {
+		t.Fatalf("next attempt at %v, want it backed off by %s", delivery.NextAttemptAt, retryBase)
+	}
+
+	// Not due yet, so nothing's sent
+	deliverDue(webhooks)
+	if len(received.requests) != 1 {
+		t.Fatalf("endpoint got %d requests before the retry was due, want 1", len(received.requests))
+	}
+
+	now := time.Now()
+	delivery.NextAttemptAt = &now
+	webhooks.SaveDelivery(&delivery)
+	deliverDue(webhooks)
+
+	delivery, _ = webhooks.GetDelivery(delivery.ID)
+	if delivery.Status != StatusFailed || delivery.Attempts != 2 || delivery.NextAttemptAt != nil {
+		t.Errorf("delivery after the last attempt = %+v, want it failed", delivery)
+	}
+	if len(received.requests) != 2 {
+		t.Errorf("endpoint got %d requests, want 2", len(received.requests))
+	}
+}
+
+func TestClaimRefusesClaimedAndUndueDeliveries(t *testing.T) {
+	webhooks := store.Memory().Webhooks
+	_, delivery := queue(t, webhooks, "http://hooks.example/")
+	now := time.Now()
+
+	if claimed, _ := webhooks.Claim(delivery.ID, StatusPending, now, now.Add(claimTimeout)); !claimed {
+		t.Fatal("due delivery wasn't claimed")
+	}
+	if claimed, _ := webhooks.Claim(delivery.ID, StatusPending, now, now.Add(claimTimeout)); claimed {
+		t.Error("delivery was claimed twice")
+	}
+	if claimed, _ := webhooks.Claim(delivery.ID, StatusPending, now.Add(claimTimeout), now.Add(2*claimTimeout)); !claimed {
+		t.Error("delivery wasn't claimable once the claim timed out")
+	}
+
+	later := now.Add(time.Hour)
+	delivery, _ = webhooks.GetDelivery(delivery.ID)
+	delivery.NextAttemptAt = &later
+	webhooks.SaveDelivery(&delivery)
+	if claimed, _ := webhooks.Claim(delivery.ID, StatusPending, now, now.Add(claimTimeout)); claimed {
+		t.Error("delivery was claimed before it was due")
+	}
+
+	delivery.Status = StatusDelivered
+	delivery.NextAttemptAt = &now
+	webhooks.SaveDelivery(&delivery)
+	if claimed, _ := webhooks.Claim(delivery.ID, StatusPending, now, now.Add(claimTimeout)); claimed {
+		t.Error("delivered delivery was claimed")
+	}
+}
+
+func TestReplayQueuesAFreshDelivery(t *testing.T) {
+	webhooks := store.Memory().Webhooks
+	hook, original := queue(t, webhooks, "http://hooks.example/")
+
+	original.Status = StatusFailed
+	original.Attempts = 8
+	original.LastError = "endpoint responded 500"
+	original.NextAttemptAt = nil
+	webhooks.SaveDelivery(&original)
+
+	replay, err := Replay(webhooks, original.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.ID == original.ID || replay.WebhookID != hook.ID || replay.EmailID != original.EmailID || replay.Payload != original.Payload {
+		t.Errorf("replay = %+v, want a new delivery of the same payload", replay)
+	}
+	if replay.Status != StatusPending || replay.Attempts != 0 || replay.NextAttemptAt == nil {
+		t.Errorf("replay = %+v, want it pending and due", replay)
+	}
+
+	if original, _ = webhooks.GetDelivery(original.ID); original.Status != StatusFailed {
+		t.Errorf("original = %+v, want it left failed", original)
+	}
+	if deliveries, _ := webhooks.Deliveries(hook.ID, 10); len(deliveries) != 2 {
+		t.Errorf("webhook has %d deliveries, want 2", len(deliveries))
+	}
+
+	if _, err := Replay(webhooks, 999); err != store.ErrNotFound {
+		t.Errorf("replaying a missing delivery got %v, want ErrNotFound", err)
+	}
+}